@@ -0,0 +1,36 @@
+package analysis
+
+import "github.com/guslan/xip8"
+
+// Access is the range of memory that an instruction reads or writes as data
+type Access struct {
+	First, Last uint16
+	Write       bool
+}
+
+// MemoryAccess returns the bytes that the instruction reads or writes through
+// I. It must be called before the instruction runs, with the I it uses.
+func MemoryAccess(cpu *xip8.Cpu, ins Instruction) (Access, bool) {
+	first, last, writes, found := memoryAccess(ins)
+	return Access{First: cpu.I + first, Last: cpu.I + last, Write: writes}, found
+}
+
+// memoryAccess returns the range [I+first, I+last] accessed by the
+// instruction, if it accesses memory through I
+func memoryAccess(ins Instruction) (first, last uint16, writes, found bool) {
+	x := (ins.OpCode & 0x0F00) >> 8
+	n := ins.OpCode & 0x000F
+
+	switch {
+	case ins.OpCode&0xF0FF == 0xF055:
+		return 0, x, true, true
+	case ins.OpCode&0xF0FF == 0xF033:
+		return 0, 2, true, true
+	case ins.OpCode&0xF0FF == 0xF065:
+		return 0, x, false, true
+	case ins.OpCode&0xF000 == 0xD000 && n > 0:
+		return 0, n - 1, false, true
+	}
+
+	return 0, 0, false, false
+}
@@ -0,0 +1,286 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/symbols"
+)
+
+const StartOfProgram = 0x200
+
+// Maximum number of entries followed in a BNNN jump table
+const maxJumpTableEntries = 128
+
+// Minimum number of unreachable instructions reported as unreachable code
+const minUnreachableInstructions = 4
+
+// ByteKind classifies the bytes of the program
+type ByteKind byte
+
+const (
+	ByteData ByteKind = iota
+	ByteCode
+)
+
+type IssueKind string
+
+const (
+	IssueJumpIntoData        IssueKind = "jump-into-data"
+	IssueJumpIntoInstruction IssueKind = "jump-into-instruction"
+	IssueJumpOutsideProgram  IssueKind = "jump-outside-program"
+	IssueOddAlignedJump      IssueKind = "odd-aligned-jump"
+	IssueUnknownOpCode       IssueKind = "unknown-opcode"
+	IssueUnreachableCode     IssueKind = "unreachable-code"
+)
+
+// Issue is a suspicious construct found in the program
+type Issue struct {
+	Address uint16
+	Kind    IssueKind
+	Message string
+}
+
+// Analysis of the reachable code of a program
+type Analysis struct {
+	// Memory image with the program loaded
+	Memory []byte
+	// The program occupies [Start, End)
+	Start, End uint16
+	// Reachable instructions by address
+	Instructions map[uint16]Instruction
+	// Addresses loaded into I
+	DataReferences map[uint16]bool
+
+	Blocks      map[uint16]*Block
+	Subroutines []*Subroutine
+	Issues      []Issue
+	// Labels used when formatting the instructions
+	Symbols *symbols.Table
+
+	// Jump and call targets and who jumps there
+	targets map[uint16][]uint16
+}
+
+// Analyze follows the reachable code of a program loaded at 0x200
+func Analyze(program []byte) *Analysis {
+	return AnalyzeAt(program, StartOfProgram)
+}
+
+// AnalyzeAt follows the reachable code of a program loaded at the given address
+func AnalyzeAt(program []byte, start uint16) *Analysis {
+	mem := make([]byte, xip8.MEMORY_SIZE)
+	copy(mem[start:], program)
+
+	a := &Analysis{
+		Memory:         mem,
+		Start:          start,
+		End:            start + uint16(min(len(program), len(mem)-int(start))),
+		Instructions:   map[uint16]Instruction{},
+		DataReferences: map[uint16]bool{},
+		Blocks:         map[uint16]*Block{},
+		Subroutines:    make([]*Subroutine, 0),
+		Issues:         make([]Issue, 0),
+		targets:        map[uint16][]uint16{},
+	}
+
+	a.followCode()
+	a.checkTargets()
+	a.findUnreachableCode()
+	a.buildGraph()
+
+	sort.SliceStable(a.Issues, func(i, j int) bool {
+		return a.Issues[i].Address < a.Issues[j].Address
+	})
+
+	return a
+}
+
+// ApplySymbols names the subroutines after the labels of their entries and
+// formats the instructions with the labels from now on
+func (a *Analysis) ApplySymbols(table *symbols.Table) {
+	a.Symbols = table
+	for _, sub := range a.Subroutines {
+		if name, found := table.Label(sub.Entry); found {
+			sub.Name = name
+		}
+	}
+}
+
+// ByteKind returns whether the byte at the address is part of an instruction
+func (a *Analysis) ByteKind(address uint16) ByteKind {
+	// Instructions are at most 4 bytes long
+	for back := uint16(0); back < 4 && back <= address; back++ {
+		if ins, found := a.Instructions[address-back]; found && ins.Size > back {
+			return ByteCode
+		}
+	}
+
+	return ByteData
+}
+
+// CodeSize returns the number of bytes of the program that are code
+func (a *Analysis) CodeSize() int {
+	size := 0
+	for addr := a.Start; addr < a.End; addr++ {
+		if a.ByteKind(addr) == ByteCode {
+			size++
+		}
+	}
+
+	return size
+}
+
+// SortedInstructions returns the reachable instructions in address order
+func (a *Analysis) SortedInstructions() []Instruction {
+	list := make([]Instruction, 0, len(a.Instructions))
+	for _, ins := range a.Instructions {
+		list = append(list, ins)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Address < list[j].Address
+	})
+
+	return list
+}
+
+func (a *Analysis) addIssue(address uint16, kind IssueKind, format string, args ...any) {
+	a.Issues = append(a.Issues, Issue{
+		Address: address,
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (a *Analysis) inProgram(address uint16) bool {
+	return address >= a.Start && address < a.End
+}
+
+// successors returns the addresses where the execution can continue after
+// the instruction, without following calls
+func (a *Analysis) successors(ins Instruction) []uint16 {
+	switch ins.Kind {
+	case KindJump:
+		return []uint16{ins.Target}
+	case KindCall:
+		return []uint16{ins.Next()}
+	case KindReturn, KindExit, KindUnknown:
+		return nil
+	case KindSkip:
+		next := ins.Next()
+		return []uint16{next, Decode(a.Memory, next).Next()}
+	case KindJumpIndexed:
+		return a.jumpTable(ins.Target)
+	}
+
+	return []uint16{ins.Next()}
+}
+
+// jumpTable returns the entries of the jump table used by a BNNN.
+// Tables are usually made of JP instructions, otherwise only the base
+// address is known to be reachable.
+func (a *Analysis) jumpTable(base uint16) []uint16 {
+	entries := []uint16{base}
+	if Decode(a.Memory, base).Kind != KindJump {
+		return entries
+	}
+
+	for addr := base + 2; len(entries) < maxJumpTableEntries && a.inProgram(addr); addr += 2 {
+		if Decode(a.Memory, addr).Kind != KindJump {
+			break
+		}
+		entries = append(entries, addr)
+	}
+
+	return entries
+}
+
+// followCode decodes every instruction reachable from the start of the program
+func (a *Analysis) followCode() {
+	pending := []uint16{a.Start}
+	visited := map[uint16]bool{}
+
+	for len(pending) > 0 {
+		addr := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		// The code outside of the program is unknown until the program writes it
+		if visited[addr] || !a.inProgram(addr) {
+			continue
+		}
+		visited[addr] = true
+
+		ins := Decode(a.Memory, addr)
+		a.Instructions[addr] = ins
+
+		if !ins.IsKnown() {
+			a.addIssue(addr, IssueUnknownOpCode, "unknown opcode %04X", ins.OpCode)
+		}
+		if ins.HasTarget && ins.Kind == KindOther {
+			a.DataReferences[ins.Target] = true
+		}
+		if ins.Kind == KindJump || ins.Kind == KindCall || ins.Kind == KindJumpIndexed {
+			a.targets[ins.Target] = append(a.targets[ins.Target], addr)
+		}
+
+		next := a.successors(ins)
+		if ins.Kind == KindCall {
+			next = append(next, ins.Target)
+		}
+		for i := len(next) - 1; i >= 0; i-- {
+			if !visited[next[i]] {
+				pending = append(pending, next[i])
+			}
+		}
+	}
+}
+
+// checkTargets flags the jumps and calls to suspicious addresses
+func (a *Analysis) checkTargets() {
+	for target, sources := range a.targets {
+		for _, src := range sources {
+			switch {
+			case !a.inProgram(target):
+				a.addIssue(src, IssueJumpOutsideProgram, "jump to 0x%03X outside of the program [0x%03X, 0x%03X)", target, a.Start, a.End)
+			case a.DataReferences[target]:
+				a.addIssue(src, IssueJumpIntoData, "jump to 0x%03X, which is also loaded into I", target)
+			}
+
+			if target%2 != 0 {
+				a.addIssue(src, IssueOddAlignedJump, "jump to the odd address 0x%03X", target)
+			}
+			if ins, found := a.Instructions[target-1]; found && ins.Size > 1 {
+				a.addIssue(src, IssueJumpIntoInstruction, "jump to 0x%03X, in the middle of the instruction at 0x%03X", target, target-1)
+			}
+		}
+	}
+}
+
+// findUnreachableCode flags the runs of data that decode into valid
+// instructions and end in a jump or a return, which is how code looks
+func (a *Analysis) findUnreachableCode() {
+	runStart, runLength := uint16(0), 0
+
+	for addr := a.Start; addr+1 < a.End; addr += 2 {
+		if a.ByteKind(addr) == ByteCode || a.ByteKind(addr+1) == ByteCode || a.DataReferences[addr] {
+			runLength = 0
+			continue
+		}
+
+		ins := Decode(a.Memory, addr)
+		if !ins.IsKnown() || ins.OpCode == 0x0000 {
+			runLength = 0
+			continue
+		}
+		if runLength == 0 {
+			runStart = addr
+		}
+		runLength++
+
+		if (ins.Kind == KindJump || ins.Kind == KindReturn) && runLength >= minUnreachableInstructions {
+			a.addIssue(runStart, IssueUnreachableCode, "%d unreachable bytes look like code [0x%03X, 0x%03X]", 2*runLength, runStart, addr+1)
+			runLength = 0
+		}
+	}
+}
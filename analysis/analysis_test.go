@@ -0,0 +1,172 @@
+package analysis_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/analysis"
+	"github.com/guslan/xip8/symbols"
+)
+
+func hasIssue(a *analysis.Analysis, addr uint16, kind analysis.IssueKind) bool {
+	for _, issue := range a.Issues {
+		if issue.Address == addr && issue.Kind == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TestAnalyze follows a program with a subroutine, a skip, sprite data and dead code
+func TestAnalyze(t *testing.T) {
+	program := []byte{
+		// 0x200: call the subroutine at 0x208
+		0x22, 0x08,
+		// 0x202: point I to the sprite
+		0xA2, 0x10,
+		// 0x204: draw it
+		0xD0, 0x11,
+		// 0x206: loop forever
+		0x12, 0x06,
+		// 0x208: skip the next instruction if V0 == 0
+		0x30, 0x00,
+		// 0x20A: set V0 to 1
+		0x60, 0x01,
+		// 0x20C: return
+		0x00, 0xEE,
+		// 0x20E: padding
+		0x00, 0x00,
+		// 0x210: sprite
+		0xFF,
+		// 0x211: padding
+		0x00,
+		// 0x212: dead code
+		0x61, 0x01, 0x62, 0x02, 0x71, 0x01, 0x00, 0xEE,
+	}
+
+	a := analysis.Analyze(program)
+
+	if len(a.Instructions) != 7 {
+		t.Fatalf(`len(a.Instructions) = %d, expected 7`, len(a.Instructions))
+	}
+	if a.ByteKind(0x20A) != analysis.ByteCode || a.ByteKind(0x210) != analysis.ByteData {
+		t.Fatalf(`expected 0x20A to be code and 0x210 to be data`)
+	}
+	if !a.DataReferences[0x210] {
+		t.Fatalf(`expected 0x210 to be referenced as data`)
+	}
+
+	if len(a.Subroutines) != 2 {
+		t.Fatalf(`len(a.Subroutines) = %d, expected 2`, len(a.Subroutines))
+	}
+	sub, found := a.SubroutineAt(0x208)
+	if !found || len(sub.Blocks) != 3 {
+		t.Fatalf(`expected the subroutine at 0x208 to have 3 blocks, got %v`, sub)
+	}
+
+	if !hasIssue(a, 0x212, analysis.IssueUnreachableCode) {
+		t.Fatalf(`expected unreachable code at 0x212, got %v`, a.Issues)
+	}
+
+	buf := bytes.Buffer{}
+	if err := a.WriteDot(&buf); err != nil {
+		t.Fatalf(`WriteDot() returned an error %v`, err)
+	}
+	if !strings.Contains(buf.String(), `b200 -> b208 [label="call", style=dashed];`) {
+		t.Fatalf(`the DOT output is missing the call edge:\n%s`, buf.String())
+	}
+
+	// Quotes and backslashes of the labels are escaped
+	table := symbols.NewTable()
+	table.Add(`say"hi\`, 0x208)
+	a.ApplySymbols(table)
+	buf.Reset()
+	if err := a.WriteDot(&buf); err != nil {
+		t.Fatalf(`WriteDot() returned an error %v`, err)
+	}
+	if !strings.Contains(buf.String(), `b208 [label="say\"hi\\:\l`) || !strings.Contains(buf.String(), `CALL say\"hi\\\l`) {
+		t.Fatalf(`the DOT output does not escape the label:\n%s`, buf.String())
+	}
+}
+
+// TestSuspiciousJumps checks the jumps into data and into the middle of instructions
+func TestSuspiciousJumps(t *testing.T) {
+	program := []byte{
+		// 0x200: point I to 0x206
+		0xA2, 0x06,
+		// 0x202: skip the next instruction if V0 == 0
+		0x30, 0x00,
+		// 0x204: jump into the data
+		0x12, 0x06,
+		// 0x206: jump into the middle of the previous instruction
+		0x12, 0x03,
+	}
+
+	a := analysis.Analyze(program)
+
+	if !hasIssue(a, 0x204, analysis.IssueJumpIntoData) {
+		t.Fatalf(`expected a jump into data at 0x204, got %v`, a.Issues)
+	}
+	if !hasIssue(a, 0x206, analysis.IssueOddAlignedJump) || !hasIssue(a, 0x206, analysis.IssueJumpIntoInstruction) {
+		t.Fatalf(`expected an odd aligned jump into an instruction at 0x206, got %v`, a.Issues)
+	}
+}
+
+func hasFinding(findings []analysis.Finding, addr uint16, rule string) bool {
+	for _, f := range findings {
+		if f.Address == addr && f.Rule == rule {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TestLintStackOverflow nests 17 calls, one more than the stack can hold
+func TestLintStackOverflow(t *testing.T) {
+	program := make([]byte, 0)
+	for i := 0; i < 17; i++ {
+		// Every subroutine calls the next one
+		next := uint16(0x200 + 4*(i+1))
+		program = append(program, 0x20|byte(next>>8), byte(next), 0x00, 0xEE)
+	}
+	program = append(program, 0x00, 0xEE)
+
+	findings := analysis.Analyze(program).Lint(analysis.LintOptions{Extension: analysis.Chip8})
+
+	if !hasFinding(findings, 0x240, analysis.RuleStackOverflow) {
+		t.Fatalf(`expected a stack overflow at 0x240, got %v`, findings)
+	}
+	if len(findings) != 1 {
+		t.Fatalf(`len(findings) = %d, expected 1: %v`, len(findings), findings)
+	}
+}
+
+// TestLintFontOverwrite writes below the load address of the ETI-660 and over a font moved past the program
+func TestLintFontOverwrite(t *testing.T) {
+	program := []byte{
+		0xA4, 0x00, // 0x600: LD I, 0x400
+		0xF0, 0x55, // 0x602: LD [I], V0
+		0xA7, 0x00, // 0x604: LD I, 0x700
+		0xF0, 0x55, // 0x606: LD [I], V0
+		0xA8, 0x00, // 0x608: LD I, 0x800
+		0xF0, 0x55, // 0x60A: LD [I], V0
+		0x16, 0x0C, // 0x60C: JP 0x60C
+	}
+
+	findings := analysis.AnalyzeAt(program, 0x600).Lint(analysis.LintOptions{
+		Extension:   analysis.Chip8,
+		Font:        xip8.VipFont,
+		FontAddress: 0x700,
+	})
+
+	if !hasFinding(findings, 0x602, analysis.RuleFontOverwrite) || !hasFinding(findings, 0x606, analysis.RuleFontOverwrite) {
+		t.Fatalf(`expected font overwrites at 0x602 and 0x606, got %v`, findings)
+	}
+	if hasFinding(findings, 0x60A, analysis.RuleFontOverwrite) {
+		t.Fatalf(`expected no font overwrite at 0x60A past the font, got %v`, findings)
+	}
+}
@@ -0,0 +1,211 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+)
+
+type EdgeKind byte
+
+const (
+	// The execution continues with the next instruction
+	EdgeFallthrough EdgeKind = iota
+	EdgeJump
+	// The next instruction was skipped
+	EdgeSkip
+	// Entry of a BNNN jump table
+	EdgeTable
+	EdgeCall
+)
+
+func (k EdgeKind) String() string {
+	switch k {
+	case EdgeFallthrough:
+		return "fallthrough"
+	case EdgeJump:
+		return "jump"
+	case EdgeSkip:
+		return "skip"
+	case EdgeTable:
+		return "table"
+	case EdgeCall:
+		return "call"
+	}
+
+	return fmt.Sprintf("EdgeKind(%d)", byte(k))
+}
+
+type Edge struct {
+	To   uint16
+	Kind EdgeKind
+}
+
+// Block is a sequence of instructions that always run one after the other
+type Block struct {
+	Start        uint16
+	Instructions []Instruction
+	Successors   []Edge
+}
+
+// Last returns the instruction that ends the block
+func (b *Block) Last() Instruction {
+	return b.Instructions[len(b.Instructions)-1]
+}
+
+// Subroutine is the set of blocks reachable from the start of the program
+// or from the target of a CALL without following other calls
+type Subroutine struct {
+	Entry  uint16
+	Name   string
+	Blocks []*Block
+	// Entries of the subroutines it calls
+	Calls []uint16
+}
+
+// SubroutineAt returns the subroutine with the given entry
+func (a *Analysis) SubroutineAt(entry uint16) (*Subroutine, bool) {
+	for _, s := range a.Subroutines {
+		if s.Entry == entry {
+			return s, true
+		}
+	}
+
+	return nil, false
+}
+
+// leaders returns the addresses that start a block
+func (a *Analysis) leaders() map[uint16]bool {
+	leaders := map[uint16]bool{a.Start: true}
+
+	for _, ins := range a.Instructions {
+		switch ins.Kind {
+		case KindOther, KindSys:
+			continue
+		case KindCall:
+			leaders[ins.Target] = true
+		}
+
+		for _, next := range a.successors(ins) {
+			leaders[next] = true
+		}
+	}
+
+	return leaders
+}
+
+func (a *Analysis) blockEdges(ins Instruction) []Edge {
+	edges := make([]Edge, 0, 2)
+
+	switch ins.Kind {
+	case KindJump:
+		edges = append(edges, Edge{To: ins.Target, Kind: EdgeJump})
+	case KindCall:
+		edges = append(edges, Edge{To: ins.Target, Kind: EdgeCall}, Edge{To: ins.Next(), Kind: EdgeFallthrough})
+	case KindSkip:
+		next := a.successors(ins)
+		edges = append(edges, Edge{To: next[0], Kind: EdgeFallthrough}, Edge{To: next[1], Kind: EdgeSkip})
+	case KindJumpIndexed:
+		for _, to := range a.successors(ins) {
+			edges = append(edges, Edge{To: to, Kind: EdgeTable})
+		}
+	case KindReturn, KindExit, KindUnknown:
+	default:
+		edges = append(edges, Edge{To: ins.Next(), Kind: EdgeFallthrough})
+	}
+
+	// Edges to addresses that were never decoded, like the ones outside of memory, are dropped
+	valid := edges[:0]
+	for _, e := range edges {
+		if _, found := a.Instructions[e.To]; found {
+			valid = append(valid, e)
+		}
+	}
+
+	return valid
+}
+
+// buildGraph splits the reachable code into basic blocks and subroutines
+func (a *Analysis) buildGraph() {
+	leaders := a.leaders()
+
+	for leader := range leaders {
+		if _, found := a.Instructions[leader]; !found {
+			continue
+		}
+
+		block := &Block{Start: leader, Instructions: make([]Instruction, 0)}
+		for addr := leader; ; {
+			ins := a.Instructions[addr]
+			block.Instructions = append(block.Instructions, ins)
+
+			next := ins.Next()
+			_, decoded := a.Instructions[next]
+			if (ins.Kind != KindOther && ins.Kind != KindSys) || leaders[next] || !decoded {
+				break
+			}
+			addr = next
+		}
+		block.Successors = a.blockEdges(block.Last())
+
+		a.Blocks[leader] = block
+	}
+
+	entries := []uint16{a.Start}
+	for _, ins := range a.Instructions {
+		if ins.Kind == KindCall {
+			entries = append(entries, ins.Target)
+		}
+	}
+	sort.Slice(entries[1:], func(i, j int) bool { return entries[1+i] < entries[1+j] })
+
+	for _, entry := range entries {
+		if _, found := a.SubroutineAt(entry); found {
+			continue
+		}
+		if _, found := a.Blocks[entry]; !found {
+			continue
+		}
+
+		sub := &Subroutine{Entry: entry, Name: fmt.Sprintf("sub_%03X", entry)}
+		if entry == a.Start {
+			sub.Name = "main"
+		}
+		a.collectBlocks(sub)
+		a.Subroutines = append(a.Subroutines, sub)
+	}
+}
+
+func (a *Analysis) collectBlocks(sub *Subroutine) {
+	visited := map[uint16]bool{}
+	calls := map[uint16]bool{}
+	pending := []uint16{sub.Entry}
+
+	for len(pending) > 0 {
+		addr := pending[0]
+		pending = pending[1:]
+		if visited[addr] {
+			continue
+		}
+		visited[addr] = true
+
+		block, found := a.Blocks[addr]
+		if !found {
+			continue
+		}
+		sub.Blocks = append(sub.Blocks, block)
+
+		for _, e := range block.Successors {
+			if e.Kind == EdgeCall {
+				calls[e.To] = true
+			} else {
+				pending = append(pending, e.To)
+			}
+		}
+	}
+
+	sort.Slice(sub.Blocks, func(i, j int) bool { return sub.Blocks[i].Start < sub.Blocks[j].Start })
+	for entry := range calls {
+		sub.Calls = append(sub.Calls, entry)
+	}
+	sort.Slice(sub.Calls, func(i, j int) bool { return sub.Calls[i] < sub.Calls[j] })
+}
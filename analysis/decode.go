@@ -0,0 +1,326 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/guslan/xip8/symbols"
+)
+
+// Extension of the CHIP-8 instruction set an instruction belongs to
+type Extension byte
+
+const (
+	Chip8 Extension = iota
+	SuperChip
+	XoChip
+)
+
+func (e Extension) String() string {
+	switch e {
+	case Chip8:
+		return "CHIP-8"
+	case SuperChip:
+		return "SUPER-CHIP"
+	case XoChip:
+		return "XO-CHIP"
+	}
+
+	return fmt.Sprintf("Extension(%d)", byte(e))
+}
+
+// Kind of instruction regarding the control flow
+type Kind byte
+
+const (
+	KindOther Kind = iota
+	// JP addr
+	KindJump
+	// CALL addr
+	KindCall
+	// RET
+	KindReturn
+	// Conditional skip of the next instruction
+	KindSkip
+	// JP V0, addr
+	KindJumpIndexed
+	// SYS addr
+	KindSys
+	// EXIT
+	KindExit
+	KindUnknown
+)
+
+// Instruction decoded from memory
+type Instruction struct {
+	Address uint16
+	OpCode  uint16
+	// Second word of the XO-CHIP long load of I
+	Operand uint16
+	// Size in bytes
+	Size      uint16
+	Kind      Kind
+	Extension Extension
+	Mnemonic  string
+	// Address the instruction jumps to, calls or loads into I
+	Target    uint16
+	HasTarget bool
+}
+
+// IsKnown returns whether the opcode is defined by any extension
+func (ins Instruction) IsKnown() bool {
+	return ins.Kind != KindUnknown
+}
+
+// Next returns the address of the next instruction in memory
+func (ins Instruction) Next() uint16 {
+	return ins.Address + ins.Size
+}
+
+// Format returns the mnemonic with the target address replaced by its label
+func (ins Instruction) Format(table *symbols.Table) string {
+	if !ins.HasTarget || table.Len() == 0 {
+		return ins.Mnemonic
+	}
+
+	var addr string
+	if ins.OpCode == 0xF000 {
+		addr = fmt.Sprintf("0x%04X", ins.Target)
+	} else {
+		addr = fmt.Sprintf("0x%03X", ins.Target)
+	}
+	if _, _, found := table.Lookup(ins.Target); !found {
+		return ins.Mnemonic
+	}
+
+	return strings.Replace(ins.Mnemonic, addr, table.Format(ins.Target), 1)
+}
+
+// Decode decodes the instruction at the given address of the memory
+func Decode(mem []byte, address uint16) Instruction {
+	if int(address)+1 >= len(mem) {
+		return Instruction{Address: address, Size: 2, Kind: KindUnknown, Mnemonic: "???"}
+	}
+
+	opCode := uint16(mem[address])<<8 | uint16(mem[address+1])
+	ins := DecodeOpCode(opCode)
+	ins.Address = address
+
+	if opCode == 0xF000 && int(address)+3 < len(mem) {
+		ins.Operand = uint16(mem[address+2])<<8 | uint16(mem[address+3])
+		ins.Target = ins.Operand
+		ins.Mnemonic = fmt.Sprintf("LD I, long 0x%04X", ins.Operand)
+	}
+
+	return ins
+}
+
+// DecodeOpCode decodes a single opcode.
+// The operand of the XO-CHIP long load of I is not known at this point.
+func DecodeOpCode(opCode uint16) Instruction {
+	x := (opCode & 0x0F00) >> 8
+	y := (opCode & 0x00F0) >> 4
+	n := opCode & 0x000F
+	kk := opCode & 0x00FF
+	nnn := opCode & 0x0FFF
+
+	ins := Instruction{OpCode: opCode, Size: 2, Kind: KindOther, Extension: Chip8}
+	set := func(mnemonic string, args ...any) {
+		ins.Mnemonic = fmt.Sprintf(mnemonic, args...)
+	}
+	target := func(kind Kind, addr uint16) {
+		ins.Kind = kind
+		ins.Target = addr
+		ins.HasTarget = true
+	}
+	unknown := func() {
+		ins.Kind = KindUnknown
+		set("??? 0x%04X", opCode)
+	}
+
+	switch opCode & 0xF000 {
+	case 0x0000:
+		switch {
+		case opCode == 0x00E0:
+			set("CLS")
+		case opCode == 0x00EE:
+			ins.Kind = KindReturn
+			set("RET")
+		case opCode&0xFFF0 == 0x00C0:
+			ins.Extension = SuperChip
+			set("SCD %d", n)
+		case opCode&0xFFF0 == 0x00D0:
+			ins.Extension = XoChip
+			set("SCU %d", n)
+		case opCode == 0x00FB:
+			ins.Extension = SuperChip
+			set("SCR")
+		case opCode == 0x00FC:
+			ins.Extension = SuperChip
+			set("SCL")
+		case opCode == 0x00FD:
+			ins.Extension = SuperChip
+			ins.Kind = KindExit
+			set("EXIT")
+		case opCode == 0x00FE:
+			ins.Extension = SuperChip
+			set("LOW")
+		case opCode == 0x00FF:
+			ins.Extension = SuperChip
+			set("HIGH")
+		default:
+			target(KindSys, nnn)
+			set("SYS 0x%03X", nnn)
+		}
+
+	case 0x1000:
+		target(KindJump, nnn)
+		set("JP 0x%03X", nnn)
+
+	case 0x2000:
+		target(KindCall, nnn)
+		set("CALL 0x%03X", nnn)
+
+	case 0x3000:
+		ins.Kind = KindSkip
+		set("SE V%X, 0x%02X", x, kk)
+
+	case 0x4000:
+		ins.Kind = KindSkip
+		set("SNE V%X, 0x%02X", x, kk)
+
+	case 0x5000:
+		switch n {
+		case 0x0:
+			ins.Kind = KindSkip
+			set("SE V%X, V%X", x, y)
+		case 0x2:
+			ins.Extension = XoChip
+			set("SAVE V%X - V%X", x, y)
+		case 0x3:
+			ins.Extension = XoChip
+			set("LOAD V%X - V%X", x, y)
+		default:
+			unknown()
+		}
+
+	case 0x6000:
+		set("LD V%X, 0x%02X", x, kk)
+
+	case 0x7000:
+		set("ADD V%X, 0x%02X", x, kk)
+
+	case 0x8000:
+		switch n {
+		case 0x0:
+			set("LD V%X, V%X", x, y)
+		case 0x1:
+			set("OR V%X, V%X", x, y)
+		case 0x2:
+			set("AND V%X, V%X", x, y)
+		case 0x3:
+			set("XOR V%X, V%X", x, y)
+		case 0x4:
+			set("ADD V%X, V%X", x, y)
+		case 0x5:
+			set("SUB V%X, V%X", x, y)
+		case 0x6:
+			set("SHR V%X, V%X", x, y)
+		case 0x7:
+			set("SUBN V%X, V%X", x, y)
+		case 0xE:
+			set("SHL V%X, V%X", x, y)
+		default:
+			unknown()
+		}
+
+	case 0x9000:
+		if n != 0 {
+			unknown()
+			break
+		}
+		ins.Kind = KindSkip
+		set("SNE V%X, V%X", x, y)
+
+	case 0xA000:
+		ins.Target = nnn
+		ins.HasTarget = true
+		set("LD I, 0x%03X", nnn)
+
+	case 0xB000:
+		target(KindJumpIndexed, nnn)
+		set("JP V0, 0x%03X", nnn)
+
+	case 0xC000:
+		set("RND V%X, 0x%02X", x, kk)
+
+	case 0xD000:
+		set("DRW V%X, V%X, %d", x, y, n)
+
+	case 0xE000:
+		switch kk {
+		case 0x9E:
+			ins.Kind = KindSkip
+			set("SKP V%X", x)
+		case 0xA1:
+			ins.Kind = KindSkip
+			set("SKNP V%X", x)
+		default:
+			unknown()
+		}
+
+	case 0xF000:
+		switch {
+		case opCode == 0xF000:
+			ins.Extension = XoChip
+			ins.Size = 4
+			ins.HasTarget = true
+			set("LD I, long")
+		case kk == 0x01:
+			ins.Extension = XoChip
+			set("PLANE %d", x)
+		case opCode == 0xF002:
+			ins.Extension = XoChip
+			set("AUDIO")
+		case kk == 0x07:
+			set("LD V%X, DT", x)
+		case kk == 0x0A:
+			set("LD V%X, K", x)
+		case kk == 0x15:
+			set("LD DT, V%X", x)
+		case kk == 0x18:
+			set("LD ST, V%X", x)
+		case kk == 0x1E:
+			set("ADD I, V%X", x)
+		case kk == 0x29:
+			set("LD F, V%X", x)
+		case kk == 0x30:
+			ins.Extension = SuperChip
+			set("LD HF, V%X", x)
+		case kk == 0x33:
+			set("LD B, V%X", x)
+		case kk == 0x3A:
+			ins.Extension = XoChip
+			set("PITCH V%X", x)
+		case kk == 0x55:
+			set("LD [I], V%X", x)
+		case kk == 0x65:
+			set("LD V%X, [I]", x)
+		case kk == 0x75:
+			ins.Extension = SuperChip
+			set("LD R, V%X", x)
+		case kk == 0x85:
+			ins.Extension = SuperChip
+			set("LD V%X, R", x)
+		default:
+			unknown()
+		}
+	}
+
+	return ins
+}
+
+// Disassemble returns the mnemonic of the opcode
+func Disassemble(opCode uint16) string {
+	return DecodeOpCode(opCode).Mnemonic
+}
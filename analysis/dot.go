@@ -0,0 +1,78 @@
+package analysis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WriteDot writes the control-flow graph in the Graphviz DOT language.
+// Every subroutine is drawn as a cluster of basic blocks.
+func (a *Analysis) WriteDot(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintln(out, "digraph cfg {")
+	fmt.Fprintln(out, `  node [shape=box, fontname="monospace"];`)
+
+	drawn := map[uint16]bool{}
+	for i, sub := range a.Subroutines {
+		fmt.Fprintf(out, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(out, "    label=%q;\n", fmt.Sprintf("%s (0x%03X)", sub.Name, sub.Entry))
+		for _, block := range sub.Blocks {
+			if drawn[block.Start] {
+				continue
+			}
+			drawn[block.Start] = true
+
+			fmt.Fprintf(out, "    %s [label=\"%s\"];\n", blockNodeId(block.Start), a.blockLabel(block))
+		}
+		fmt.Fprintln(out, "  }")
+	}
+
+	starts := make([]uint16, 0, len(a.Blocks))
+	for start := range a.Blocks {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	for _, start := range starts {
+		for _, e := range a.Blocks[start].Successors {
+			attrs := ""
+			switch e.Kind {
+			case EdgeSkip:
+				attrs = ` [label="skip"]`
+			case EdgeTable:
+				attrs = ` [label="table", style=dotted]`
+			case EdgeCall:
+				attrs = ` [label="call", style=dashed]`
+			}
+			fmt.Fprintf(out, "  %s -> %s%s;\n", blockNodeId(start), blockNodeId(e.To), attrs)
+		}
+	}
+
+	fmt.Fprintln(out, "}")
+
+	return out.Flush()
+}
+
+func blockNodeId(start uint16) string {
+	return fmt.Sprintf("b%03X", start)
+}
+
+// dotEscaper escapes the text of a quoted DOT string
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// blockLabel returns the lines of the block, left-justified with \l
+func (a *Analysis) blockLabel(block *Block) string {
+	sb := strings.Builder{}
+	if name, found := a.Symbols.Label(block.Start); found {
+		sb.WriteString(fmt.Sprintf("%s:\\l", dotEscaper.Replace(name)))
+	}
+	for _, ins := range block.Instructions {
+		sb.WriteString(fmt.Sprintf("0x%03X: %s\\l", ins.Address, dotEscaper.Replace(ins.Format(a.Symbols))))
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,258 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/guslan/xip8"
+)
+
+// Size of the stack of the CPU
+const stackSize = 16
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+const (
+	RuleUnsupportedOpCode = "unsupported-opcode"
+	RuleFontOverwrite     = "font-overwrite"
+	RuleMemoryOverrun     = "memory-overrun"
+	RuleStackOverflow     = "stack-overflow"
+	RuleRecursion         = "recursion"
+	RuleIgnoredSys        = "ignored-sys"
+)
+
+// Finding of the linter
+type Finding struct {
+	Address  uint16   `json:"address"`
+	Severity Severity `json:"severity"`
+	Rule     string   `json:"rule"`
+	Message  string   `json:"message"`
+}
+
+// LintOptions describe the platform the program is linted for
+type LintOptions struct {
+	// Newest extension supported by the platform
+	Extension Extension
+	Quirks    xip8.QuirkFlag
+	// Font of the interpreter and where it is loaded. The memory below the
+	// start of the program belongs to the interpreter as well.
+	Font        xip8.Font
+	FontAddress uint16
+}
+
+// Lint reports the problems that the program would run into
+func (a *Analysis) Lint(opts LintOptions) []Finding {
+	findings := make([]Finding, 0)
+	add := func(addr uint16, severity Severity, rule string, format string, args ...any) {
+		findings = append(findings, Finding{
+			Address:  addr,
+			Severity: severity,
+			Rule:     rule,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	for _, ins := range a.SortedInstructions() {
+		switch {
+		case ins.Kind == KindUnknown:
+			// Reported with the issues of the analysis
+		case ins.Extension > opts.Extension:
+			add(ins.Address, SeverityError, RuleUnsupportedOpCode, "%s is a %s instruction", ins.Mnemonic, ins.Extension)
+		case ins.Kind == KindSys:
+			add(ins.Address, SeverityWarning, RuleIgnoredSys, "%s is ignored unless a MachineRoutineInterpreter is set", ins.Mnemonic)
+		}
+	}
+
+	fontStart, fontEnd := int(opts.FontAddress), int(opts.FontAddress)+opts.Font.Size()
+	for addr, i := range a.indexValues(opts.Quirks) {
+		ins := a.Instructions[addr]
+		first, last, writes, found := memoryAccess(ins)
+		if !found {
+			continue
+		}
+
+		start, end := i+first, i+last
+		switch {
+		case end >= xip8.MEMORY_SIZE:
+			add(addr, SeverityError, RuleMemoryOverrun, "%s with I=0x%03X accesses [0x%03X, 0x%03X], past the end of memory", ins.Mnemonic, i, start, end)
+		case writes && int(start) < fontEnd && fontStart <= int(end):
+			add(addr, SeverityError, RuleFontOverwrite, "%s with I=0x%03X overwrites [0x%03X, 0x%03X], the font at [0x%03X, 0x%03X]", ins.Mnemonic, i, start, end, fontStart, fontEnd-1)
+		case writes && start < a.Start:
+			add(addr, SeverityError, RuleFontOverwrite, "%s with I=0x%03X overwrites [0x%03X, 0x%03X], below 0x%03X", ins.Mnemonic, i, start, min(end, a.Start-1), a.Start)
+		}
+	}
+
+	a.lintCallDepth(add)
+
+	for _, issue := range a.Issues {
+		severity := SeverityWarning
+		switch issue.Kind {
+		case IssueUnknownOpCode:
+			severity = SeverityError
+		case IssueUnreachableCode:
+			severity = SeverityInfo
+		}
+		add(issue.Address, severity, string(issue.Kind), "%s", issue.Message)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Address < findings[j].Address
+	})
+
+	return findings
+}
+
+// unknownIndex marks the value of I as unknown
+const unknownIndex = 0xFFFF
+
+// indexValues returns the value of I before the instructions where it can be
+// known statically. I is known after a LD I, addr until it is modified by a
+// value known only at runtime, and unknown when entering a subroutine or
+// returning from one.
+func (a *Analysis) indexValues(quirks xip8.QuirkFlag) map[uint16]uint16 {
+	entry := map[uint16]uint16{}
+	values := map[uint16]uint16{}
+
+	merge := func(block uint16, i uint16) bool {
+		prev, seen := entry[block]
+		switch {
+		case !seen:
+			entry[block] = i
+			return true
+		case prev != i && prev != unknownIndex:
+			entry[block] = unknownIndex
+			return true
+		}
+		return false
+	}
+
+	pending := make([]uint16, 0)
+	for _, sub := range a.Subroutines {
+		entry[sub.Entry] = unknownIndex
+		pending = append(pending, sub.Entry)
+	}
+
+	for len(pending) > 0 {
+		start := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		block, found := a.Blocks[start]
+		if !found {
+			continue
+		}
+
+		i := entry[start]
+		for _, ins := range block.Instructions {
+			if i != unknownIndex {
+				values[ins.Address] = i
+			} else {
+				delete(values, ins.Address)
+			}
+			i = nextIndex(ins, i, quirks)
+		}
+
+		for _, e := range block.Successors {
+			next := i
+			switch e.Kind {
+			case EdgeCall:
+				continue
+			case EdgeFallthrough:
+				if block.Last().Kind == KindCall {
+					next = unknownIndex
+				}
+			}
+			if merge(e.To, next) {
+				pending = append(pending, e.To)
+			}
+		}
+	}
+
+	return values
+}
+
+func nextIndex(ins Instruction, i uint16, quirks xip8.QuirkFlag) uint16 {
+	x := (ins.OpCode & 0x0F00) >> 8
+
+	switch {
+	case ins.OpCode&0xF000 == 0xA000:
+		return ins.Target
+	case ins.OpCode == 0xF000:
+		return ins.Operand
+	case ins.OpCode&0xF0FF == 0xF01E, ins.OpCode&0xF0FF == 0xF029, ins.OpCode&0xF0FF == 0xF030:
+		return unknownIndex
+	case ins.OpCode&0xF0FF == 0xF055, ins.OpCode&0xF0FF == 0xF065:
+		if quirks&xip8.FlagQuirkMemoryMovesIndex > 0 && i != unknownIndex {
+			return i + x + 1
+		}
+	}
+
+	return i
+}
+
+// lintCallDepth reports the calls that overflow the stack and the recursive subroutines
+func (a *Analysis) lintCallDepth(add func(uint16, Severity, string, string, ...any)) {
+	// Address of the call instructions of each subroutine by callee
+	callSites := map[uint16][]Instruction{}
+	for _, sub := range a.Subroutines {
+		for _, block := range sub.Blocks {
+			if last := block.Last(); last.Kind == KindCall {
+				callSites[sub.Entry] = append(callSites[sub.Entry], last)
+			}
+		}
+	}
+
+	// Deepest nesting of calls below each subroutine
+	need := map[uint16]int{}
+	onPath := map[uint16]bool{}
+
+	var measure func(entry uint16) int
+	measure = func(entry uint16) int {
+		if n, found := need[entry]; found {
+			return n
+		}
+		onPath[entry] = true
+		defer delete(onPath, entry)
+
+		n := 0
+		for _, call := range callSites[entry] {
+			if onPath[call.Target] {
+				add(call.Address, SeverityWarning, RuleRecursion, "recursive %s can overflow the %d-entry stack", call.Mnemonic, stackSize)
+				continue
+			}
+			n = max(n, 1+measure(call.Target))
+		}
+		need[entry] = n
+
+		return n
+	}
+
+	if measure(a.Start) <= stackSize {
+		return
+	}
+
+	// Follow the deepest chain of calls until the stack overflows
+	entry := a.Start
+	for depth := 1; ; depth++ {
+		var deepest Instruction
+		for _, call := range callSites[entry] {
+			if deepest.Size == 0 || need[call.Target] > need[deepest.Target] {
+				deepest = call
+			}
+		}
+		if deepest.Size == 0 {
+			return
+		}
+
+		if depth > stackSize {
+			add(deepest.Address, SeverityError, RuleStackOverflow, "%s reaches a call depth of %d, the stack has %d entries", deepest.Mnemonic, depth, stackSize)
+			return
+		}
+		entry = deepest.Target
+	}
+}
@@ -0,0 +1,44 @@
+package analysis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Maximum number of data bytes per line of the listing
+const listingBytesPerLine = 8
+
+// WriteListing writes the disassembly of the program. The reachable code is
+// written as instructions and everything else as data bytes.
+func (a *Analysis) WriteListing(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	for addr := a.Start; addr < a.End; {
+		if name, found := a.Symbols.Label(addr); found {
+			fmt.Fprintf(out, "%s:\n", name)
+		} else if sub, found := a.SubroutineAt(addr); found {
+			fmt.Fprintf(out, "%s:\n", sub.Name)
+		}
+
+		if ins, found := a.Instructions[addr]; found {
+			fmt.Fprintf(out, "  0x%03X  %04X  %s\n", addr, ins.OpCode, ins.Format(a.Symbols))
+			addr = ins.Next()
+			continue
+		}
+
+		data := make([]string, 0, listingBytesPerLine)
+		start := addr
+		for addr < a.End && len(data) < listingBytesPerLine && a.ByteKind(addr) == ByteData {
+			if _, labeled := a.Symbols.Label(addr); labeled && addr != start {
+				break
+			}
+			data = append(data, fmt.Sprintf("0x%02X", a.Memory[addr]))
+			addr++
+		}
+		fmt.Fprintf(out, "  0x%03X        db %s\n", start, strings.Join(data, ", "))
+	}
+
+	return out.Flush()
+}
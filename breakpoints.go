@@ -0,0 +1,70 @@
+package xip8
+
+import "sort"
+
+// SetBreakpoint pauses the CPU before executing the instruction at addr
+func (cpu *Cpu) SetBreakpoint(addr uint16) {
+	cpu.breakpointsMu.Lock()
+	defer cpu.breakpointsMu.Unlock()
+
+	cpu.breakpoints[addr] = true
+}
+
+// ClearBreakpoint removes the breakpoint at addr
+func (cpu *Cpu) ClearBreakpoint(addr uint16) {
+	cpu.breakpointsMu.Lock()
+	defer cpu.breakpointsMu.Unlock()
+
+	delete(cpu.breakpoints, addr)
+}
+
+// ClearBreakpoints removes all the breakpoints
+func (cpu *Cpu) ClearBreakpoints() {
+	cpu.breakpointsMu.Lock()
+	defer cpu.breakpointsMu.Unlock()
+
+	cpu.breakpoints = map[uint16]bool{}
+}
+
+// HasBreakpoint returns whether there is a breakpoint at addr
+func (cpu *Cpu) HasBreakpoint(addr uint16) bool {
+	cpu.breakpointsMu.RLock()
+	defer cpu.breakpointsMu.RUnlock()
+
+	return cpu.breakpoints[addr]
+}
+
+// Breakpoints returns the addresses of the breakpoints in ascending order
+func (cpu *Cpu) Breakpoints() []uint16 {
+	cpu.breakpointsMu.RLock()
+	defer cpu.breakpointsMu.RUnlock()
+
+	addrs := make([]uint16, 0, len(cpu.breakpoints))
+	for addr := range cpu.breakpoints {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+
+	return addrs
+}
+
+// AddBreakpointHook adds a hook that will run when the CPU pauses at a breakpoint
+func (cpu *Cpu) AddBreakpointHook(h Hook) int {
+	cpu.breakpointHooks = append(cpu.breakpointHooks, h)
+
+	return len(cpu.breakpointHooks)
+}
+
+// checkBreakpoint pauses the CPU if there is a breakpoint at the PC.
+// The instruction right after resuming is never stopped at, otherwise the
+// CPU could not continue from a breakpoint.
+func (cpu *Cpu) checkBreakpoint() bool {
+	if cpu.resuming || !cpu.HasBreakpoint(cpu.Pc) {
+		return false
+	}
+
+	cpu.isPaused = true
+	cpu.runHooks(cpu.breakpointHooks)
+
+	return true
+}
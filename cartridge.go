@@ -0,0 +1,31 @@
+package xip8
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+)
+
+// Cartridge is a ROM as it was loaded, so that the program can be restarted
+// after it modifies itself
+type Cartridge struct {
+	// Name of the ROM, usually its file name
+	Name string
+	// Original bytes of the ROM, never modified
+	Rom []byte
+	// SHA-1 of the ROM in hexadecimal
+	Hash string
+	// Anything else known about the ROM, like its title or platform
+	Metadata map[string]string
+}
+
+// NewCartridge returns the cartridge of a copy of the ROM
+func NewCartridge(name string, rom []byte) *Cartridge {
+	sum := sha1.Sum(rom)
+
+	return &Cartridge{
+		Name:     name,
+		Rom:      append([]byte(nil), rom...),
+		Hash:     hex.EncodeToString(sum[:]),
+		Metadata: make(map[string]string),
+	}
+}
@@ -0,0 +1,664 @@
+package cartridge
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidSource = errors.New("invalid Octo source")
+
+// Address where Octo programs are loaded, and the size of the XO-CHIP memory
+// that they can fill
+const (
+	startAddress = 0x200
+	memorySize   = 0x10000
+)
+
+// token of the source with the line it was read from
+type token struct {
+	text string
+	line int
+}
+
+// fixup is an address of an instruction that jumps to, calls or loads a
+// label defined after it
+type fixup struct {
+	addr  int
+	label string
+	line  int
+	// Whether the label is the 16-bit operand of i := long
+	long bool
+}
+
+// loop is an open loop with the jumps out of it of its while conditions
+type loop struct {
+	start  int
+	breaks []int
+}
+
+// assembler translates the common subset of Octo into a ROM
+type assembler struct {
+	tokens []token
+	pos    int
+
+	rom  []byte
+	here int
+	// Whether the first byte or label was written, after the jump to main
+	started bool
+
+	labels  map[string]int
+	consts  map[string]int
+	aliases map[string]byte
+	fixups  []fixup
+	loops   []loop
+	// Jumps of the open if ... begin blocks to their else or end
+	blocks []int
+}
+
+// Assemble returns the ROM of Octo source. It supports labels, :const,
+// :alias, :org, :byte, :call, the instructions of CHIP-8, SCHIP and the
+// simple ones of XO-CHIP, if ... then, if ... begin ... else ... end and
+// loop ... while ... again. Macros, :calc, strings and the comparisons
+// made with vf need the Octo assembler and return ErrNeedsAssembler.
+//
+// Like Octo, a jump to main is written at 0x200, unless main is the first
+// label of the program.
+func Assemble(source string) ([]byte, error) {
+	a := &assembler{
+		here:    startAddress,
+		labels:  map[string]int{},
+		consts:  map[string]int{},
+		aliases: map[string]byte{},
+	}
+	for n, line := range strings.Split(source, "\n") {
+		// Comments run until the end of the line
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		for _, text := range strings.Fields(line) {
+			a.tokens = append(a.tokens, token{text, n + 1})
+		}
+	}
+
+	for a.pos < len(a.tokens) {
+		if err := a.statement(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(a.loops) > 0 {
+		return nil, a.errorf(a.tokens[len(a.tokens)-1], "loop without again")
+	}
+	if len(a.blocks) > 0 {
+		return nil, a.errorf(a.tokens[len(a.tokens)-1], "begin without end")
+	}
+	for _, f := range a.fixups {
+		target, found := a.labels[f.label]
+		if !found {
+			return nil, fmt.Errorf("%w: undefined label %q in line %d", ErrInvalidSource, f.label, f.line)
+		}
+		switch {
+		case f.long:
+			a.rom[f.addr-startAddress] = byte(target >> 8)
+			a.rom[f.addr-startAddress+1] = byte(target)
+		case target > 0xFFF:
+			return nil, fmt.Errorf("%w: label %q in line %d is past 0xFFF, use i := long", ErrInvalidSource, f.label, f.line)
+		default:
+			a.patch(f.addr, target)
+		}
+	}
+
+	return a.rom, nil
+}
+
+func (a *assembler) errorf(t token, format string, args ...any) error {
+	return fmt.Errorf("%w: %s in line %d", ErrInvalidSource, fmt.Sprintf(format, args...), t.line)
+}
+
+func (a *assembler) unsupported(t token) error {
+	return fmt.Errorf("%w: %q in line %d", ErrNeedsAssembler, t.text, t.line)
+}
+
+// next returns the next token, or an empty one at the end of the source
+func (a *assembler) next() token {
+	if a.pos >= len(a.tokens) {
+		line := 0
+		if len(a.tokens) > 0 {
+			line = a.tokens[len(a.tokens)-1].line
+		}
+		return token{line: line}
+	}
+
+	a.pos++
+	return a.tokens[a.pos-1]
+}
+
+func (a *assembler) peek() string {
+	if a.pos >= len(a.tokens) {
+		return ""
+	}
+	return a.tokens[a.pos].text
+}
+
+// expect reads the next token, which must be text
+func (a *assembler) expect(text string) error {
+	if t := a.next(); t.text != text {
+		return a.errorf(t, "expected %q, found %q", text, t.text)
+	}
+	return nil
+}
+
+// start writes the jump to main before the first byte or label, unless that
+// label is main
+func (a *assembler) start(isMain bool) error {
+	if a.started {
+		return nil
+	}
+
+	a.started = true
+	if !isMain {
+		a.fixups = append(a.fixups, fixup{addr: a.here, label: "main"})
+		return a.emitWord(0x1000)
+	}
+	return nil
+}
+
+func (a *assembler) emit(bytes ...byte) error {
+	if err := a.start(false); err != nil {
+		return err
+	}
+
+	for _, b := range bytes {
+		if a.here >= memorySize {
+			return fmt.Errorf("%w: the program is larger than the memory", ErrInvalidSource)
+		}
+		if i := a.here - startAddress; i >= len(a.rom) {
+			a.rom = append(a.rom, make([]byte, i+1-len(a.rom))...)
+		}
+		a.rom[a.here-startAddress] = b
+		a.here++
+	}
+	return nil
+}
+
+func (a *assembler) emitWord(w uint16) error {
+	return a.emit(byte(w>>8), byte(w))
+}
+
+// patch sets the address of the instruction at addr
+func (a *assembler) patch(addr, target int) {
+	a.rom[addr-startAddress] |= byte(target>>8) & 0x0F
+	a.rom[addr-startAddress+1] = byte(target)
+}
+
+// emitAddress writes the instruction with the address of the next token,
+// which may be a label defined later
+func (a *assembler) emitAddress(opCode uint16) error {
+	t := a.next()
+	n, err := a.number(t)
+	if target, found := a.labels[t.text]; found {
+		n, err = target, nil
+	}
+	if err == nil {
+		if n < 0 || n > 0xFFF {
+			return a.errorf(t, "address %q does not fit in 12 bits", t.text)
+		}
+		return a.emitWord(opCode | uint16(n))
+	}
+	if !isIdentifier(t.text) {
+		return a.errorf(t, "expected an address, found %q", t.text)
+	}
+
+	if err := a.start(false); err != nil {
+		return err
+	}
+	a.fixups = append(a.fixups, fixup{addr: a.here, label: t.text, line: t.line})
+	return a.emitWord(opCode)
+}
+
+// number parses a numeric literal or a constant
+func (a *assembler) number(t token) (int, error) {
+	if n, found := a.consts[t.text]; found {
+		return n, nil
+	}
+	return parseNumber(t.text)
+}
+
+// byteValue parses a number that fits in a byte, negative ones in two's complement
+func (a *assembler) byteValue(t token) (byte, error) {
+	n, err := a.number(t)
+	if err != nil || n < -128 || n > 255 {
+		return 0, a.errorf(t, "expected a byte, found %q", t.text)
+	}
+	return byte(n), nil
+}
+
+// nibble parses a number of 4 bits
+func (a *assembler) nibble(t token) (uint16, error) {
+	n, err := a.number(t)
+	if err != nil || n < 0 || n > 0xF {
+		return 0, a.errorf(t, "expected a number from 0 to 15, found %q", t.text)
+	}
+	return uint16(n), nil
+}
+
+// register parses v0 to vf or an alias
+func (a *assembler) register(text string) (uint16, bool) {
+	if x, found := a.aliases[text]; found {
+		return uint16(x), true
+	}
+	if len(text) != 2 || (text[0] != 'v' && text[0] != 'V') {
+		return 0, false
+	}
+	x, err := strconv.ParseUint(text[1:], 16, 8)
+	return uint16(x), err == nil
+}
+
+func (a *assembler) expectRegister() (uint16, error) {
+	t := a.next()
+	x, found := a.register(t.text)
+	if !found {
+		return 0, a.errorf(t, "expected a register, found %q", t.text)
+	}
+	return x, nil
+}
+
+func (a *assembler) statement() error {
+	t := a.next()
+	switch t.text {
+	case ":":
+		name := a.next()
+		if !isIdentifier(name.text) {
+			return a.errorf(name, "invalid label %q", name.text)
+		}
+		if _, found := a.labels[name.text]; found {
+			return a.errorf(name, "label %q is already defined", name.text)
+		}
+		if err := a.start(name.text == "main"); err != nil {
+			return err
+		}
+		a.labels[name.text] = a.here
+		return nil
+	case ":const":
+		name, value := a.next(), a.next()
+		n, err := a.number(value)
+		if target, found := a.labels[value.text]; found {
+			n, err = target, nil
+		}
+		if err != nil || !isIdentifier(name.text) {
+			return a.errorf(name, "invalid constant %q %q", name.text, value.text)
+		}
+		a.consts[name.text] = n
+		return nil
+	case ":alias":
+		name := a.next()
+		x, err := a.expectRegister()
+		if err != nil {
+			return err
+		}
+		if !isIdentifier(name.text) {
+			return a.errorf(name, "invalid alias %q", name.text)
+		}
+		a.aliases[name.text] = byte(x)
+		return nil
+	case ":org":
+		addr := a.next()
+		n, err := a.number(addr)
+		if err != nil || n < startAddress || n >= memorySize {
+			return a.errorf(addr, "invalid address %q", addr.text)
+		}
+		if err := a.start(false); err != nil {
+			return err
+		}
+		a.here = n
+		return nil
+	case ":byte":
+		b, err := a.byteValue(a.next())
+		if err != nil {
+			return err
+		}
+		return a.emit(b)
+	case ":call":
+		return a.emitAddress(0x2000)
+	case ":breakpoint":
+		// Debugger directives write nothing
+		a.next()
+		return nil
+	case ":monitor":
+		a.next()
+		a.next()
+		return nil
+
+	case "return", ";":
+		return a.emitWord(0x00EE)
+	case "clear":
+		return a.emitWord(0x00E0)
+	case "hires":
+		return a.emitWord(0x00FF)
+	case "lores":
+		return a.emitWord(0x00FE)
+	case "scroll-right":
+		return a.emitWord(0x00FB)
+	case "scroll-left":
+		return a.emitWord(0x00FC)
+	case "exit":
+		return a.emitWord(0x00FD)
+	case "audio":
+		return a.emitWord(0xF002)
+	case "scroll-down", "scroll-up", "plane":
+		n, err := a.nibble(a.next())
+		if err != nil {
+			return err
+		}
+		switch t.text {
+		case "scroll-down":
+			return a.emitWord(0x00C0 | n)
+		case "scroll-up":
+			return a.emitWord(0x00D0 | n)
+		}
+		return a.emitWord(0xF001 | n<<8)
+	case "bcd", "save", "load", "saveflags", "loadflags":
+		return a.registerInstruction(t)
+	case "sprite":
+		x, err := a.expectRegister()
+		if err != nil {
+			return err
+		}
+		y, err := a.expectRegister()
+		if err != nil {
+			return err
+		}
+		n, err := a.nibble(a.next())
+		if err != nil {
+			return err
+		}
+		return a.emitWord(0xD000 | x<<8 | y<<4 | n)
+	case "jump":
+		return a.emitAddress(0x1000)
+	case "jump0":
+		return a.emitAddress(0xB000)
+	case "native":
+		return a.emitAddress(0x0000)
+	case "i":
+		return a.index()
+	case "delay", "buzzer", "pitch":
+		if err := a.expect(":="); err != nil {
+			return err
+		}
+		x, err := a.expectRegister()
+		if err != nil {
+			return err
+		}
+		opCodes := map[string]uint16{"delay": 0xF015, "buzzer": 0xF018, "pitch": 0xF03A}
+		return a.emitWord(opCodes[t.text] | x<<8)
+
+	case "if":
+		then, inverse, err := a.condition()
+		if err != nil {
+			return err
+		}
+		switch next := a.next(); next.text {
+		case "then":
+			return a.emitWord(then)
+		case "begin":
+			if err := a.emitWord(inverse); err != nil {
+				return err
+			}
+			a.blocks = append(a.blocks, a.here)
+			return a.emitWord(0x1000)
+		default:
+			return a.errorf(next, "expected then or begin, found %q", next.text)
+		}
+	case "else":
+		if len(a.blocks) == 0 {
+			return a.errorf(t, "else without if ... begin")
+		}
+		jump := a.here
+		if err := a.emitWord(0x1000); err != nil {
+			return err
+		}
+		a.patch(a.blocks[len(a.blocks)-1], a.here)
+		a.blocks[len(a.blocks)-1] = jump
+		return nil
+	case "end":
+		if len(a.blocks) == 0 {
+			return a.errorf(t, "end without if ... begin")
+		}
+		a.patch(a.blocks[len(a.blocks)-1], a.here)
+		a.blocks = a.blocks[:len(a.blocks)-1]
+		return nil
+	case "loop":
+		if err := a.start(false); err != nil {
+			return err
+		}
+		a.loops = append(a.loops, loop{start: a.here})
+		return nil
+	case "while":
+		if len(a.loops) == 0 {
+			return a.errorf(t, "while outside of a loop")
+		}
+		_, inverse, err := a.condition()
+		if err != nil {
+			return err
+		}
+		if err := a.emitWord(inverse); err != nil {
+			return err
+		}
+		l := &a.loops[len(a.loops)-1]
+		l.breaks = append(l.breaks, a.here)
+		return a.emitWord(0x1000)
+	case "again":
+		if len(a.loops) == 0 {
+			return a.errorf(t, "again without loop")
+		}
+		l := a.loops[len(a.loops)-1]
+		a.loops = a.loops[:len(a.loops)-1]
+		if err := a.emitWord(0x1000 | uint16(l.start)); err != nil {
+			return err
+		}
+		for _, addr := range l.breaks {
+			a.patch(addr, a.here)
+		}
+		return nil
+	}
+
+	if x, found := a.register(t.text); found {
+		return a.assignment(x)
+	}
+	// Numbers and constants on their own are bytes
+	if _, err := a.number(t); err == nil {
+		b, err := a.byteValue(t)
+		if err != nil {
+			return err
+		}
+		return a.emit(b)
+	}
+	if strings.HasPrefix(t.text, ":") || !isIdentifier(t.text) {
+		return a.unsupported(t)
+	}
+
+	// Any other name calls the subroutine at its label
+	a.pos--
+	return a.emitAddress(0x2000)
+}
+
+// registerInstruction writes the instructions that take a register, save
+// and load taking a range of them on XO-CHIP
+func (a *assembler) registerInstruction(t token) error {
+	x, err := a.expectRegister()
+	if err != nil {
+		return err
+	}
+
+	if (t.text == "save" || t.text == "load") && a.peek() == "-" {
+		a.next()
+		y, err := a.expectRegister()
+		if err != nil {
+			return err
+		}
+		if t.text == "save" {
+			return a.emitWord(0x5002 | x<<8 | y<<4)
+		}
+		return a.emitWord(0x5003 | x<<8 | y<<4)
+	}
+
+	opCodes := map[string]uint16{"bcd": 0xF033, "save": 0xF055, "load": 0xF065, "saveflags": 0xF075, "loadflags": 0xF085}
+	return a.emitWord(opCodes[t.text] | x<<8)
+}
+
+// index writes the instructions that set or add to I
+func (a *assembler) index() error {
+	switch op := a.next(); op.text {
+	case "+=":
+		x, err := a.expectRegister()
+		if err != nil {
+			return err
+		}
+		return a.emitWord(0xF01E | x<<8)
+	case ":=":
+	default:
+		return a.errorf(op, "expected := or +=, found %q", op.text)
+	}
+
+	switch a.peek() {
+	case "hex", "bighex":
+		t := a.next()
+		x, err := a.expectRegister()
+		if err != nil {
+			return err
+		}
+		if t.text == "hex" {
+			return a.emitWord(0xF029 | x<<8)
+		}
+		return a.emitWord(0xF030 | x<<8)
+	case "long":
+		a.next()
+		if err := a.emitWord(0xF000); err != nil {
+			return err
+		}
+		t := a.next()
+		if target, found := a.labels[t.text]; found {
+			return a.emitWord(uint16(target))
+		}
+		if n, err := a.number(t); err == nil {
+			if n < 0 || n > 0xFFFF {
+				return a.errorf(t, "address %q does not fit in 16 bits", t.text)
+			}
+			return a.emitWord(uint16(n))
+		}
+		a.fixups = append(a.fixups, fixup{addr: a.here, label: t.text, line: t.line, long: true})
+		return a.emitWord(0)
+	}
+
+	return a.emitAddress(0xA000)
+}
+
+// assignment writes the instructions that change the register x
+func (a *assembler) assignment(x uint16) error {
+	op := a.next()
+	arg := a.next()
+	y, isRegister := a.register(arg.text)
+
+	registerOps := map[string]uint16{
+		":=": 0x8000, "|=": 0x8001, "&=": 0x8002, "^=": 0x8003,
+		"+=": 0x8004, "-=": 0x8005, ">>=": 0x8006, "=-": 0x8007, "<<=": 0x800E,
+	}
+	if opCode, found := registerOps[op.text]; found && isRegister {
+		return a.emitWord(opCode | x<<8 | y<<4)
+	}
+
+	switch op.text {
+	case ":=":
+		switch arg.text {
+		case "delay":
+			return a.emitWord(0xF007 | x<<8)
+		case "key":
+			return a.emitWord(0xF00A | x<<8)
+		case "random":
+			mask, err := a.byteValue(a.next())
+			if err != nil {
+				return err
+			}
+			return a.emitWord(0xC000 | x<<8 | uint16(mask))
+		}
+		n, err := a.byteValue(arg)
+		if err != nil {
+			return err
+		}
+		return a.emitWord(0x6000 | x<<8 | uint16(n))
+	case "+=", "-=":
+		n, err := a.byteValue(arg)
+		if err != nil {
+			return err
+		}
+		// Subtracting is adding the two's complement
+		if op.text == "-=" {
+			n = -n
+		}
+		return a.emitWord(0x7000 | x<<8 | uint16(n))
+	case "|=", "&=", "^=", ">>=", "=-", "<<=":
+		return a.errorf(arg, "%s needs a register, found %q", op.text, arg.text)
+	}
+
+	return a.errorf(op, "unknown operator %q", op.text)
+}
+
+// condition parses the condition of if and while. It returns the skip
+// instruction that runs the next one when the condition holds, and the
+// inverse one that skips it then.
+func (a *assembler) condition() (then, inverse uint16, err error) {
+	x, err := a.expectRegister()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	op := a.next()
+	switch op.text {
+	case "key":
+		return 0xE0A1 | x<<8, 0xE09E | x<<8, nil
+	case "-key":
+		return 0xE09E | x<<8, 0xE0A1 | x<<8, nil
+	case "==", "!=":
+	case "<", ">", "<=", ">=":
+		// Octo compares through vf with several instructions
+		return 0, 0, a.unsupported(op)
+	default:
+		return 0, 0, a.errorf(op, "unknown comparison %q", op.text)
+	}
+
+	arg := a.next()
+	var equal, notEqual uint16
+	if y, found := a.register(arg.text); found {
+		// Skip when equal, skip when not equal
+		equal, notEqual = 0x5000|x<<8|y<<4, 0x9000|x<<8|y<<4
+	} else {
+		n, err := a.byteValue(arg)
+		if err != nil {
+			return 0, 0, err
+		}
+		equal, notEqual = 0x3000|x<<8|uint16(n), 0x4000|x<<8|uint16(n)
+	}
+
+	if op.text == "==" {
+		return notEqual, equal, nil
+	}
+	return equal, notEqual, nil
+}
+
+// isIdentifier returns whether s can name a label, a constant or an alias
+func isIdentifier(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	if _, err := parseNumber(s); err == nil {
+		return false
+	}
+	for _, r := range s {
+		if !(r == '-' || r == '_' || r == '.' || '0' <= r && r <= '9' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
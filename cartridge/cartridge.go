@@ -0,0 +1,257 @@
+// Package cartridge reads and writes the GIF cartridges that Octo shares
+// programs as. The two lowest bits of the color index of every pixel, frame
+// after frame, hide a 32-bit big endian length followed by a JSON document
+// with the Octo source of the program and its options.
+package cartridge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/romdb"
+)
+
+var ErrInvalidCartridge = errors.New("invalid cartridge")
+
+// Size of the frames of a cartridge
+const (
+	Width  = 128
+	Height = 64
+)
+
+// Delay between the frames, in 100ths of a second
+const frameDelay = 10
+
+var (
+	gif87Header = []byte("GIF87a")
+	gif89Header = []byte("GIF89a")
+)
+
+// Options of the Octo emulator. The quirks are the SCHIP behaviours.
+type Options struct {
+	Tickrate        uint   `json:"tickrate,omitempty"`
+	FillColor       string `json:"fillColor,omitempty"`
+	FillColor2      string `json:"fillColor2,omitempty"`
+	BlendColor      string `json:"blendColor,omitempty"`
+	BackgroundColor string `json:"backgroundColor,omitempty"`
+	BuzzColor       string `json:"buzzColor,omitempty"`
+	QuietColor      string `json:"quietColor,omitempty"`
+	ShiftQuirks     bool   `json:"shiftQuirks"`
+	LoadStoreQuirks bool   `json:"loadStoreQuirks"`
+	VfOrderQuirks   bool   `json:"vfOrderQuirks"`
+	ClipQuirks      bool   `json:"clipQuirks"`
+	VBlankQuirks    bool   `json:"vBlankQuirks"`
+	JumpQuirks      bool   `json:"jumpQuirks"`
+	LogicQuirks     bool   `json:"logicQuirks"`
+	ScreenRotation  int    `json:"screenRotation"`
+	MaxSize         int    `json:"maxSize,omitempty"`
+}
+
+// DefaultOptions are the options of a new Octo program
+var DefaultOptions = Options{
+	Tickrate:        20,
+	FillColor:       "#FFCC00",
+	FillColor2:      "#FF6600",
+	BlendColor:      "#662200",
+	BackgroundColor: "#996600",
+	BuzzColor:       "#FFAA00",
+	QuietColor:      "#000000",
+	MaxSize:         3584,
+}
+
+// Quirks returns the quirks of the options. vBlank and vfOrder have no
+// equivalent and are ignored.
+func (o Options) Quirks() xip8.QuirkFlag {
+	var q xip8.QuirkFlag
+	if !o.ShiftQuirks {
+		q |= xip8.FlagQuirkShiftWithVy
+	}
+	if !o.LoadStoreQuirks {
+		q |= xip8.FlagQuirkMemoryMovesIndex
+	}
+	if o.LogicQuirks {
+		q |= xip8.FlagQuirkVfReset
+	}
+	if o.ClipQuirks {
+		q |= xip8.FlagQuirkClipping
+	}
+	if o.JumpQuirks {
+		q |= xip8.FlagQuirkJumpUsesVx
+	}
+	return q
+}
+
+// SetQuirks sets the quirk options from the quirks of a CPU
+func (o *Options) SetQuirks(q xip8.QuirkFlag) {
+	o.ShiftQuirks = q&xip8.FlagQuirkShiftWithVy == 0
+	o.LoadStoreQuirks = q&xip8.FlagQuirkMemoryMovesIndex == 0
+	o.LogicQuirks = q&xip8.FlagQuirkVfReset != 0
+	o.ClipQuirks = q&xip8.FlagQuirkClipping != 0
+	o.JumpQuirks = q&xip8.FlagQuirkJumpUsesVx != 0
+}
+
+// Settings returns the options as the settings of a ROM
+func (o Options) Settings() romdb.Settings {
+	return romdb.Settings{
+		Quirks:   o.Quirks(),
+		TickRate: o.Tickrate,
+		Layout:   xip8.Chip8Layout,
+		Colors: romdb.Colors{
+			Pixels:  []string{o.BackgroundColor, o.FillColor, o.FillColor2, o.BlendColor},
+			Buzzer:  o.BuzzColor,
+			Silence: o.QuietColor,
+		},
+		ScreenRotation: o.ScreenRotation,
+	}
+}
+
+// NewOptions returns the options of a ROM with the given settings, keeping the
+// defaults of Octo for the ones that are not set
+func NewOptions(settings romdb.Settings) Options {
+	o := DefaultOptions
+	o.SetQuirks(settings.Quirks)
+	if settings.TickRate > 0 {
+		o.Tickrate = settings.TickRate
+	}
+	o.ScreenRotation = settings.ScreenRotation
+
+	for i, c := range []*string{&o.BackgroundColor, &o.FillColor, &o.FillColor2, &o.BlendColor} {
+		if i < len(settings.Colors.Pixels) && len(settings.Colors.Pixels[i]) > 0 {
+			*c = settings.Colors.Pixels[i]
+		}
+	}
+	if len(settings.Colors.Buzzer) > 0 {
+		o.BuzzColor = settings.Colors.Buzzer
+	}
+	if len(settings.Colors.Silence) > 0 {
+		o.QuietColor = settings.Colors.Silence
+	}
+
+	return o
+}
+
+// Configure is a xip8.CpuConfigCb that applies the options to the config
+func (o Options) Configure(config *xip8.CpuConfig) {
+	o.Settings().Configure(config)
+}
+
+// Cartridge is a program shared by Octo
+type Cartridge struct {
+	Options Options `json:"options"`
+	// Octo source
+	Program string `json:"program"`
+}
+
+// IsCartridge returns whether the data is a GIF, the format of the cartridges
+func IsCartridge(data []byte) bool {
+	return bytes.HasPrefix(data, gif89Header) || bytes.HasPrefix(data, gif87Header)
+}
+
+// Decode reads the cartridge hidden in a GIF
+func Decode(r io.Reader) (*Cartridge, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	var b byte
+	n := 0
+	for _, frame := range g.Image {
+		bounds := frame.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				b = b<<2 | frame.ColorIndexAt(x, y)&3
+				if n++; n%4 == 0 {
+					data = append(data, b)
+				}
+			}
+		}
+	}
+
+	if len(data) < 4 {
+		return nil, fmt.Errorf("%w: the GIF has no data", ErrInvalidCartridge)
+	}
+	size := binary.BigEndian.Uint32(data)
+	if int64(size) > int64(len(data)-4) {
+		return nil, fmt.Errorf("%w: the GIF has %d bytes, not %d", ErrInvalidCartridge, len(data)-4, size)
+	}
+
+	c := &Cartridge{Options: DefaultOptions}
+	if err := json.Unmarshal(data[4:4+size], c); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCartridge, err)
+	}
+
+	return c, nil
+}
+
+// palette returns the colors of the cartridge: four variants of the
+// background, fill, second fill and blend colors that differ in the two bits
+// hidden in every pixel
+func (c Cartridge) palette() color.Palette {
+	var palette color.Palette
+	for i, s := range []string{c.Options.BackgroundColor, c.Options.FillColor, c.Options.FillColor2, c.Options.BlendColor} {
+		base, err := romdb.ParseColor(s)
+		if err != nil {
+			base, _ = romdb.ParseColor(DefaultOptions.Settings().Colors.Pixels[i])
+		}
+		for bits := range byte(4) {
+			palette = append(palette, color.RGBA{base.R, base.G, base.B&^3 | bits, 0xFF})
+		}
+	}
+	return palette
+}
+
+// art returns the color of the picture of a cartridge, without the hidden
+// bits, at x, y
+func art(x, y int) byte {
+	switch {
+	case x < 8 || x >= Width-8 || y < 4 || y >= Height-4:
+		// Background
+		return 0
+	case x >= 20 && x < Width-20 && y >= 12 && y < Height-16:
+		// Label
+		return 2
+	case y >= Height-10 && (x/4)%2 == 0:
+		// Contacts
+		return 3
+	}
+	// Case
+	return 1
+}
+
+// Encode writes the cartridge as a GIF
+func Encode(w io.Writer, c Cartridge) error {
+	doc, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	data := binary.BigEndian.AppendUint32(nil, uint32(len(doc)))
+	data = append(data, doc...)
+
+	palette := c.palette()
+	bytesPerFrame := Width * Height / 4
+	g := &gif.GIF{}
+	for start := 0; start < len(data); start += bytesPerFrame {
+		frame := image.NewPaletted(image.Rect(0, 0, Width, Height), palette)
+		for i := range Width * Height {
+			var bits byte
+			if j := start + i/4; j < len(data) {
+				bits = data[j] >> (6 - 2*(i%4)) & 3
+			}
+			frame.Pix[i] = art(i%Width, i/Width)<<2 | bits
+		}
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, frameDelay)
+	}
+
+	return gif.EncodeAll(w, g)
+}
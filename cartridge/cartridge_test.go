@@ -0,0 +1,156 @@
+package cartridge_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/cartridge"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	program := []byte{0x00, 0xE0, 0xA2, 0x2A, 0x60, 0x0C}
+	options := cartridge.DefaultOptions
+	options.Tickrate = 1000
+	options.SetQuirks(xip8.FlagQuirkClipping | xip8.FlagQuirkJumpUsesVx)
+
+	// Long enough to need several frames
+	source := cartridge.Source(bytes.Repeat(program, 1000))
+
+	buf := bytes.Buffer{}
+	if err := cartridge.Encode(&buf, cartridge.Cartridge{Options: options, Program: source}); err != nil {
+		t.Fatal(err)
+	}
+	if !cartridge.IsCartridge(buf.Bytes()) {
+		t.Fatal(`the cartridge is not a GIF`)
+	}
+
+	c, err := cartridge.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Options != options {
+		t.Fatalf(`decoded options %+v, expected %+v`, c.Options, options)
+	}
+	if q := c.Options.Quirks(); q != xip8.FlagQuirkClipping|xip8.FlagQuirkJumpUsesVx {
+		t.Fatalf(`quirks = %08b`, q)
+	}
+
+	rom, err := c.Rom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rom, bytes.Repeat(program, 1000)) {
+		t.Fatalf(`the rom changed`)
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	rom, err := cartridge.Assemble(": main # data\n\t0xA2 42 0b101 -1\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []byte{0xA2, 42, 5, 0xFF}; !bytes.Equal(rom, expected) {
+		t.Fatalf(`assembled % X, expected % X`, rom, expected)
+	}
+
+	if _, err := cartridge.Assemble(": main\n\tif v0 < v1 then clear\n"); !errors.Is(err, cartridge.ErrNeedsAssembler) {
+		t.Fatalf(`err = %v, expected ErrNeedsAssembler`, err)
+	}
+	if _, err := cartridge.Assemble(": main\n\tjump missing\n"); !errors.Is(err, cartridge.ErrInvalidSource) {
+		t.Fatalf(`err = %v, expected ErrInvalidSource`, err)
+	}
+}
+
+// counter is an Octo program that sums the numbers up to 10, draws the last
+// one, and loads two bytes of data
+const counter = `# Sums 1 to LIMIT in v4
+:alias counter v0
+:alias sum v4
+:const LIMIT 10
+
+: draw-digit
+	i := hex counter
+	sprite v1 v2 5
+	return
+
+: main
+	clear
+	counter := 0
+	sum := 0
+	v1 := 2
+	v2 := 2
+	loop
+		counter += 1
+		sum += counter
+		while counter != LIMIT
+	again
+
+	if sum == 55 begin
+		v5 := 1
+	else
+		v5 := 2
+	end
+	draw-digit
+	:call draw-digit
+
+	if v5 == 1 then v6 := 0xAA
+	v7 := v6
+	v7 >>= v7
+	i := digits
+	load v1
+	loop again
+
+: digits
+	0x12 0x34
+`
+
+func TestAssembleCartridge(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := cartridge.Encode(&buf, cartridge.Cartridge{Options: cartridge.DefaultOptions, Program: counter}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := cartridge.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rom, err := c.Rom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{
+		0x12, 0x08, // jump main
+		0xF0, 0x29, 0xD1, 0x25, 0x00, 0xEE, // draw-digit
+		0x00, 0xE0, 0x60, 0x00, 0x64, 0x00, 0x61, 0x02, 0x62, 0x02, // main
+		0x70, 0x01, 0x84, 0x04, 0x40, 0x0A, 0x12, 0x1C, 0x12, 0x12, // loop
+		0x34, 0x37, 0x12, 0x24, 0x65, 0x01, 0x12, 0x26, 0x65, 0x02, // if begin else end
+		0x22, 0x02, 0x22, 0x02,
+		0x45, 0x01, 0x66, 0xAA, 0x87, 0x60, 0x87, 0x76,
+		0xA2, 0x38, 0xF1, 0x65, 0x12, 0x36,
+		0x12, 0x34, // digits
+	}
+	if !bytes.Equal(rom, expected) {
+		t.Fatalf("assembled\n% X\nexpected\n% X", rom, expected)
+	}
+
+	cpu := xip8.NewCpu(c.Options.Configure)
+	if err := cpu.LoadProgram(rom); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.Boot(); err != nil {
+		t.Fatal(err)
+	}
+	for range 200 {
+		if err := cpu.LoopOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cpu.V[0] != 0x12 || cpu.V[1] != 0x34 || cpu.V[4] != 55 || cpu.V[5] != 1 || cpu.V[6] != 0xAA || cpu.V[7] != 0x55 {
+		t.Fatalf(`V = % X`, cpu.V)
+	}
+	if cpu.Pc != 0x236 {
+		t.Fatalf(`PC = 0x%03X, expected the final loop at 0x236`, cpu.Pc)
+	}
+}
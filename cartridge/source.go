@@ -0,0 +1,60 @@
+package cartridge
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrNeedsAssembler is returned for the features of Octo that Assemble does not support
+var ErrNeedsAssembler = errors.New("the program needs the Octo assembler")
+
+// Bytes per line of the sources made from ROMs
+const bytesPerLine = 16
+
+// Source returns Octo source that assembles into the ROM
+func Source(rom []byte) string {
+	sb := strings.Builder{}
+	sb.WriteString(": main\n")
+	for i := 0; i < len(rom); i += bytesPerLine {
+		sb.WriteString("\t")
+		for j, b := range rom[i:min(i+bytesPerLine, len(rom))] {
+			if j > 0 {
+				sb.WriteString(" ")
+			}
+			fmt.Fprintf(&sb, "0x%02X", b)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// parseNumber parses the Octo notations of numbers: decimal, 0x and 0b, with
+// an optional minus sign
+func parseNumber(s string) (int, error) {
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		s, base = s[2:], 16
+	case strings.HasPrefix(s, "0b"), strings.HasPrefix(s, "0B"):
+		s, base = s[2:], 2
+	}
+
+	n, err := strconv.ParseUint(s, base, 16)
+	if err != nil {
+		return 0, err
+	}
+	if negative {
+		return -int(n), nil
+	}
+	return int(n), nil
+}
+
+// Rom returns the program of the cartridge
+func (c Cartridge) Rom() ([]byte, error) {
+	return Assemble(c.Program)
+}
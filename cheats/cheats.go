@@ -0,0 +1,215 @@
+// Package cheats reads cheat files and applies their codes to the memory of
+// a running program.
+//
+// A cheat file has a cheat per line, a name followed by a colon and its codes
+// separated by commas. Lines starting with # are comments, and cheats whose
+// name starts with - are disabled until they are turned on.
+//
+//	Infinite lives: freeze 0x3A0=03
+//	-Start on level 5: patch 0x3A1=05
+//	No collisions: rom 0x2F4=1300, freeze 0x3A2=00
+//
+// freeze writes the bytes every frame, patch writes them once when the cheat
+// is turned on, and rom replaces instructions of the program when it is loaded,
+// restoring them when the cheat is turned off.
+package cheats
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/symbols"
+)
+
+var ErrInvalidCheat = errors.New("invalid cheat")
+
+// Kind is what a code does with its bytes
+type Kind int
+
+const (
+	// Written every frame
+	Freeze Kind = iota
+	// Written once when the cheat is turned on
+	Patch
+	// Written over the program when it is loaded
+	Rom
+)
+
+var kindNames = map[Kind]string{
+	Freeze: "freeze",
+	Patch:  "patch",
+	Rom:    "rom",
+}
+
+func (k Kind) String() string {
+	if name, found := kindNames[k]; found {
+		return name
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Code writes bytes starting at an address
+type Code struct {
+	Kind    Kind
+	Address uint16
+	Bytes   []byte
+}
+
+func (c Code) String() string {
+	return fmt.Sprintf("%s 0x%03X=%X", c.Kind, c.Address, c.Bytes)
+}
+
+// Cheat is a named group of codes
+type Cheat struct {
+	Name    string
+	Codes   []Code
+	Enabled bool
+}
+
+// Parse reads the cheats of a cheat file
+func Parse(r io.Reader) ([]Cheat, error) {
+	var cheats []Cheat
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		cheat, err := parseCheat(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		cheats = append(cheats, cheat)
+	}
+
+	return cheats, scanner.Err()
+}
+
+func parseCheat(line string) (Cheat, error) {
+	i := strings.LastIndex(line, ":")
+	if i < 0 {
+		return Cheat{}, fmt.Errorf("%w: expected NAME: CODES", ErrInvalidCheat)
+	}
+
+	cheat := Cheat{Name: strings.TrimSpace(line[:i]), Enabled: true}
+	if name, found := strings.CutPrefix(cheat.Name, "-"); found {
+		cheat.Name, cheat.Enabled = strings.TrimSpace(name), false
+	}
+	if len(cheat.Name) == 0 {
+		return Cheat{}, fmt.Errorf("%w: the cheat has no name", ErrInvalidCheat)
+	}
+
+	for _, s := range strings.Split(line[i+1:], ",") {
+		code, err := ParseCode(s)
+		if err != nil {
+			return Cheat{}, err
+		}
+		cheat.Codes = append(cheat.Codes, code)
+	}
+
+	return cheat, nil
+}
+
+// ParseCode parses a code like freeze 0x3A0=03
+func ParseCode(s string) (Code, error) {
+	kind, assignment, found := strings.Cut(strings.TrimSpace(s), " ")
+	if !found {
+		return Code{}, fmt.Errorf("%w: expected KIND ADDR=BYTES, got %q", ErrInvalidCheat, s)
+	}
+
+	code := Code{Kind: -1}
+	for k, name := range kindNames {
+		if strings.EqualFold(kind, name) {
+			code.Kind = k
+		}
+	}
+	if code.Kind < 0 {
+		return Code{}, fmt.Errorf("%w: unknown kind %q, use freeze, patch or rom", ErrInvalidCheat, kind)
+	}
+
+	addr, value, found := strings.Cut(strings.ReplaceAll(assignment, " ", ""), "=")
+	if !found {
+		return Code{}, fmt.Errorf("%w: expected ADDR=BYTES, got %q", ErrInvalidCheat, assignment)
+	}
+
+	var err error
+	if code.Address, err = symbols.ParseAddress(addr); err != nil {
+		return Code{}, fmt.Errorf("%w: invalid address %q", ErrInvalidCheat, addr)
+	}
+
+	value = strings.TrimPrefix(strings.ToLower(value), "0x")
+	if len(value)%2 == 1 {
+		value = "0" + value
+	}
+	if code.Bytes, err = hex.DecodeString(value); err != nil || len(code.Bytes) == 0 {
+		return Code{}, fmt.Errorf("%w: invalid bytes %q", ErrInvalidCheat, value)
+	}
+	if int(code.Address)+len(code.Bytes) > xip8.MEMORY_SIZE {
+		return Code{}, fmt.Errorf("%w: %s is outside the memory", ErrInvalidCheat, code)
+	}
+
+	return code, nil
+}
+
+// Load reads a cheat file
+func Load(path string) ([]Cheat, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cheats, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("loading cheats %s: %w", path, err)
+	}
+
+	return cheats, nil
+}
+
+// UserPath returns the location of the cheats of the ROM with the given SHA-1
+func UserPath(hash string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "xip8", "cheats", strings.ToLower(hash)+".cht"), nil
+}
+
+// Open returns the cheats of the ROM with the given SHA-1 in the user config
+// directory, if there are any, followed by the ones in the given paths, which
+// must exist.
+func Open(hash string, paths ...string) ([]Cheat, error) {
+	var cheats []Cheat
+
+	if path, err := UserPath(hash); err == nil {
+		c, err := Load(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		cheats = append(cheats, c...)
+	}
+
+	for _, path := range paths {
+		if len(path) == 0 {
+			continue
+		}
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		cheats = append(cheats, c...)
+	}
+
+	return cheats, nil
+}
@@ -0,0 +1,92 @@
+package cheats_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/cheats"
+)
+
+func TestParse(t *testing.T) {
+	list, err := cheats.Parse(strings.NewReader(`
+# Lives
+Infinite lives: freeze 0x3A0=03
+-Level 5: patch $3A1=5, rom 0x204=1300
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || !list[0].Enabled || list[1].Enabled || list[1].Name != "Level 5" {
+		t.Fatalf(`unexpected cheats %+v`, list)
+	}
+	if s := list[1].Codes[0].String() + ", " + list[1].Codes[1].String(); s != "patch 0x3A1=05, rom 0x204=1300" {
+		t.Fatalf(`unexpected codes %s`, s)
+	}
+
+	for _, line := range []string{"no codes", "Bad: poke 0x300=01", "Bad: freeze 0xFFF=0102", "Bad: rom 0x200=xy"} {
+		if _, err := cheats.Parse(strings.NewReader(line)); !errors.Is(err, cheats.ErrInvalidCheat) {
+			t.Errorf(`expected %q to be invalid, got %v`, line, err)
+		}
+	}
+}
+
+func TestEngine(t *testing.T) {
+	cpu := xip8.NewCpu(func(config *xip8.CpuConfig) {
+		config.CyclesPerFrame = 2
+	})
+	program := []byte{
+		0x60, 0x00, // 0x200: LD V0, 0x00
+		0x70, 0x01, // 0x202: ADD V0, 0x01
+		0x12, 0x02, // 0x204: JP 0x202
+	}
+	if err := cpu.LoadProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.Boot(); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := cheats.NewEngine()
+	engine.Attach(cpu)
+	engine.Load([]cheats.Cheat{
+		{Name: "Frozen", Enabled: true, Codes: []cheats.Code{{Kind: cheats.Freeze, Address: 0x300, Bytes: []byte{3}}}},
+		{Name: "Add 2", Enabled: true, Codes: []cheats.Code{{Kind: cheats.Rom, Address: 0x203, Bytes: []byte{2}}}},
+		{Name: "Patched", Codes: []cheats.Code{{Kind: cheats.Patch, Address: 0x301, Bytes: []byte{7}}}},
+	})
+
+	cpu.Memory[0x300] = 0
+	for range 3 {
+		if err := cpu.LoopOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cpu.V[0] != 2 || cpu.Memory[0x300] != 3 || cpu.Memory[0x301] != 0 {
+		t.Fatalf(`V0 = %d, [0x300] = %d and [0x301] = %d, expected 2, 3 and 0`, cpu.V[0], cpu.Memory[0x300], cpu.Memory[0x301])
+	}
+
+	// The program writes over the frozen address, and the cheats are turned around
+	cpu.Memory[0x300] = 9
+	engine.Toggle(1)
+	engine.SetEnabled(2, true)
+	for range 4 {
+		if err := cpu.LoopOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cpu.Memory[0x203] != 1 || cpu.Memory[0x300] != 3 || cpu.Memory[0x301] != 7 {
+		t.Fatalf(`[0x203] = %d, [0x300] = %d and [0x301] = %d, expected 1, 3 and 7`, cpu.Memory[0x203], cpu.Memory[0x300], cpu.Memory[0x301])
+	}
+
+	// Patches are only written once
+	cpu.Memory[0x301] = 0
+	for range 4 {
+		if err := cpu.LoopOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cpu.Memory[0x301] != 0 || engine.Cheats()[1].Enabled {
+		t.Fatalf(`unexpected state %v`, engine.Cheats())
+	}
+}
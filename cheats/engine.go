@@ -0,0 +1,165 @@
+package cheats
+
+import (
+	"sync"
+
+	"github.com/guslan/xip8"
+)
+
+// state is a cheat and what the engine already did with it
+type state struct {
+	Cheat
+	// The rom codes are in the memory
+	applied bool
+	// Bytes that the rom codes replaced
+	originals [][]byte
+	// The patch codes were written since the cheat was turned on
+	patched bool
+}
+
+// Engine applies the enabled cheats once per frame. The cheats can be
+// replaced and turned on and off from another goroutine than the CPU.
+type Engine struct {
+	mu     sync.Mutex
+	cheats []*state
+
+	// Frame of the last time the cheats were applied
+	frame   uint
+	started bool
+}
+
+func NewEngine() *Engine {
+	return &Engine{}
+}
+
+// Attach registers the hooks of the engine in the CPU
+func (e *Engine) Attach(cpu *xip8.Cpu) {
+	cpu.AddBeforeFrameHook(e.beforeFrame)
+	cpu.AddLoadHook(e.reloaded)
+}
+
+// Load replaces the cheats. It is called after loading a program, whose rom
+// codes are applied before its first instruction.
+func (e *Engine) Load(cheats []Cheat) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.cheats = make([]*state, len(cheats))
+	for i, c := range cheats {
+		e.cheats[i] = &state{Cheat: c}
+	}
+	e.started = false
+}
+
+// Cheats returns the cheats and whether they are enabled
+func (e *Engine) Cheats() []Cheat {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cheats := make([]Cheat, len(e.cheats))
+	for i, s := range e.cheats {
+		cheats[i] = s.Cheat
+	}
+
+	return cheats
+}
+
+// SetEnabled turns the i-th cheat on or off. The change is applied in the next cycle.
+func (e *Engine) SetEnabled(i int, enabled bool) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if i < 0 || i >= len(e.cheats) {
+		return false
+	}
+	e.cheats[i].Enabled = enabled
+
+	return true
+}
+
+// Toggle turns the i-th cheat on if it was off and the other way around
+func (e *Engine) Toggle(i int) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if i < 0 || i >= len(e.cheats) {
+		return false
+	}
+	e.cheats[i].Enabled = !e.cheats[i].Enabled
+
+	return true
+}
+
+func (e *Engine) beforeFrame(cpu *xip8.Cpu) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// The rom codes follow the cheats as soon as they change
+	for _, s := range e.cheats {
+		switch {
+		case s.Enabled && !s.applied:
+			s.applyRom(cpu.Memory)
+		case !s.Enabled && s.applied:
+			s.restoreRom(cpu.Memory)
+		}
+		if !s.Enabled {
+			s.patched = false
+		}
+	}
+
+	// The hooks run every cycle, the other codes once per frame
+	if e.started && cpu.Frames() == e.frame {
+		return
+	}
+	e.started, e.frame = true, cpu.Frames()
+
+	for _, s := range e.cheats {
+		if !s.Enabled {
+			continue
+		}
+		for _, c := range s.Codes {
+			if c.Kind == Freeze || (c.Kind == Patch && !s.patched) {
+				copy(cpu.Memory[c.Address:], c.Bytes)
+			}
+		}
+		s.patched = true
+	}
+}
+
+// reloaded forgets what was written, since a hard reset loaded the original
+// ROM, so the codes are applied again before the first instruction
+func (e *Engine) reloaded(cpu *xip8.Cpu) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, s := range e.cheats {
+		s.applied, s.patched = false, false
+	}
+	e.started = false
+}
+
+func (s *state) applyRom(mem *xip8.Memory) {
+	s.originals = s.originals[:0]
+	for _, c := range s.Codes {
+		if c.Kind != Rom {
+			continue
+		}
+		original := make([]byte, len(c.Bytes))
+		copy(original, mem[c.Address:])
+		s.originals = append(s.originals, original)
+		copy(mem[c.Address:], c.Bytes)
+	}
+	s.applied = true
+}
+
+func (s *state) restoreRom(mem *xip8.Memory) {
+	// In reverse, in case the codes overlap
+	i := len(s.originals) - 1
+	for j := len(s.Codes) - 1; j >= 0; j-- {
+		if c := s.Codes[j]; c.Kind == Rom {
+			copy(mem[c.Address:], s.originals[i])
+			i--
+		}
+	}
+	s.applied = false
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/guslan/xip8/cartridge"
+	"github.com/guslan/xip8/loader"
+	"github.com/guslan/xip8/romdb"
+)
+
+func main() {
+	outputPath := flag.String("o", "", "path of the output file (default: stdout)")
+	extract := flag.String("extract", "", "write the source or the rom of a cartridge instead of a cartridge, source or rom")
+	romDbPath := flag.String("romdb", "", "path to a rom database override file")
+	tickrate := flag.Uint("tickrate", 0, "instructions per frame of the cartridge (default: the one of the rom)")
+	rotation := flag.Int("rotation", -1, "clockwise rotation of the screen in degrees (default: the one of the rom)")
+
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		log.Fatalln("must provide the path to a rom, an Octo source or a cartridge as an argument")
+	}
+	path := flag.Arg(0)
+
+	var c cartridge.Cartridge
+	if strings.EqualFold(filepath.Ext(path), ".8o") {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		c = cartridge.Cartridge{Options: cartridge.DefaultOptions, Program: string(source)}
+	} else {
+		c = fromRom(path, *romDbPath)
+	}
+
+	if *tickrate > 0 {
+		c.Options.Tickrate = *tickrate
+	}
+	if *rotation >= 0 {
+		c.Options.ScreenRotation = *rotation
+	}
+
+	out := bytes.Buffer{}
+	switch *extract {
+	case "":
+		if err := cartridge.Encode(&out, c); err != nil {
+			log.Fatalln(err)
+		}
+	case "source":
+		out.WriteString(c.Program)
+	case "rom":
+		rom, err := c.Rom()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		out.Write(rom)
+	default:
+		log.Fatalf("unknown -extract %q, use source or rom\n", *extract)
+	}
+
+	var err error
+	if len(*outputPath) == 0 {
+		_, err = out.WriteTo(os.Stdout)
+	} else {
+		err = os.WriteFile(*outputPath, out.Bytes(), 0o644)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// fromRom returns the cartridge of a rom in any of the formats of the loader,
+// with the settings of the cartridge or the rom database
+func fromRom(path, romDbPath string) cartridge.Cartridge {
+	// The source of a cartridge is kept as is, it may use more of Octo than the assembler supports
+	if data, err := os.ReadFile(path); err == nil && cartridge.IsCartridge(data) {
+		c, err := cartridge.Decode(bytes.NewReader(data))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return *c
+	}
+
+	rom, err := loader.Open(path)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	db, err := romdb.Open(romDbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	options := cartridge.DefaultOptions
+	if settings, found := rom.Lookup(db); found {
+		options = cartridge.NewOptions(settings)
+	}
+
+	return cartridge.Cartridge{Options: options, Program: cartridge.Source(rom.Data)}
+}
@@ -0,0 +1,663 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/analysis"
+	"github.com/guslan/xip8/heatmap"
+	"github.com/guslan/xip8/search"
+	"github.com/guslan/xip8/sprites"
+	"github.com/guslan/xip8/symbols"
+)
+
+const debuggerPrompt = "(xip8) "
+
+// Number of instructions shown by disas when no count is given
+const defaultDisasCount = 10
+
+// Number of bytes shown by x when no count is given
+const defaultDumpCount = 16
+
+// Layout of the sprites written by the sprites command
+const (
+	defaultSpriteCount   = 16
+	defaultSpriteHeight  = 8
+	defaultSpriteColumns = 8
+	spriteScale          = 8
+)
+
+// Number of candidates listed by search when no count is given
+const defaultSearchCount = 16
+
+var errProgramFinished = errors.New("the program has finished")
+
+const debuggerHelp = `Commands:
+  break ADDR           stop before executing the instruction at ADDR (b)
+  delete [ADDR]        remove the breakpoint at ADDR, or all of them (d)
+  step [N]             execute N instructions (s)
+  next                 execute the next instruction, stepping over calls (n)
+  finish               run until the current subroutine returns
+  frame [N]            run until N more frames are drawn (f)
+  reverse-step [N]     undo N instructions (rs)
+  reverse-continue     undo instructions until a breakpoint (rc)
+  continue             run until a breakpoint or Ctrl-C (c)
+  regs                 print the registers (r)
+  x/N ADDR             dump N bytes of memory starting at ADDR
+  set REG=VALUE        change V0-VF, I, PC, SP, DT or ST
+  set ADDR=VALUE       change a byte of memory
+  disas [ADDR] [N]     disassemble N instructions starting at ADDR or the PC
+  screen               print the current frame
+  heatmap FILE         write a PNG of the memory accesses of the last second
+  sprites FILE [ADDR] [N] [H|16x16]
+                       write a PNG of N sprites of H rows, or 16x16, from ADDR or I
+  search start         snapshot the memory, every address is a candidate
+  search FILTER [V]    snapshot again and keep the candidates that are equal,
+                       changed, increased or decreased, or whose value is V
+  search list [N]      list N candidates with their previous and current values
+  reset [soft]         reload the rom and restart, or only reset the registers
+  key K                press the key K (0-F) once
+  help                 print this help
+  quit                 exit (q)
+Addresses can be numbers (0x300, $300, 768) or labels, optionally label+offset.
+`
+
+// DebuggerKeyboard presses a key once, so the CPU never waits for it to be released
+type DebuggerKeyboard struct {
+	pending byte
+	pressed bool
+}
+
+// Boot implements Keyboard.
+func (kb *DebuggerKeyboard) Boot() error {
+	return nil
+}
+
+// GetPressed implements Keyboard.
+func (kb *DebuggerKeyboard) GetPressed() (byte, bool) {
+	if !kb.pressed {
+		return 0, false
+	}
+	kb.pressed = false
+
+	return kb.pending, true
+}
+
+// IsPressed implements Keyboard.
+func (kb *DebuggerKeyboard) IsPressed(k byte) bool {
+	return kb.pressed && kb.pending == k
+}
+
+// SetKeyMap implements Keyboard.
+func (kb *DebuggerKeyboard) SetKeyMap(l xip8.KeyboardLayout) {
+}
+
+// Press presses the key until the CPU reads it
+func (kb *DebuggerKeyboard) Press(k byte) {
+	kb.pending = k
+	kb.pressed = true
+}
+
+// Debugger is an interactive prompt that controls the CPU
+type Debugger struct {
+	cpu      *xip8.Cpu
+	symbols  *symbols.Table
+	keyboard *DebuggerKeyboard
+	out      io.Writer
+	heatmap  *heatmap.Heatmap
+	search   *search.Search
+
+	interrupted atomic.Bool
+}
+
+func NewDebugger(cpu *xip8.Cpu, kb *DebuggerKeyboard, table *symbols.Table, out io.Writer) *Debugger {
+	d := &Debugger{
+		cpu:      cpu,
+		symbols:  table,
+		keyboard: kb,
+		out:      out,
+		heatmap:  heatmap.New(heatmap.DefaultWindow),
+		search:   search.New(),
+	}
+	d.heatmap.Attach(cpu)
+
+	return d
+}
+
+// Run reads commands until the input ends or quit is entered
+func (d *Debugger) Run(in io.Reader) error {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		for range interrupts {
+			d.interrupted.Store(true)
+		}
+	}()
+
+	d.printLocation()
+
+	scanner := bufio.NewScanner(in)
+	last := ""
+	for {
+		fmt.Fprint(d.out, debuggerPrompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(d.out)
+			return scanner.Err()
+		}
+
+		// An empty line repeats the last command
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			line = last
+		}
+		last = line
+
+		quit, err := d.Execute(line)
+		if err != nil {
+			fmt.Fprintln(d.out, "error:", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// Execute runs a single command
+func (d *Debugger) Execute(line string) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, nil
+	}
+
+	cmd, args := fields[0], fields[1:]
+	if strings.HasPrefix(cmd, "x/") || cmd == "x" {
+		return false, d.dump(strings.TrimPrefix(strings.TrimPrefix(cmd, "x"), "/"), args)
+	}
+
+	switch cmd {
+	case "break", "b":
+		return false, d.setBreakpoint(args)
+	case "delete", "d":
+		return false, d.deleteBreakpoint(args)
+	case "step", "s":
+		return false, d.stepCommand(args)
+	case "next", "n":
+		return false, d.next()
+	case "finish":
+		return false, d.finish()
+	case "frame", "f":
+		return false, d.frame(args)
+	case "continue", "c":
+		return false, d.run(func() bool { return false })
+	case "reverse-step", "rs":
+		return false, d.reverseStep(args)
+	case "reverse-continue", "rc":
+		err := d.cpu.ReverseContinue()
+		d.printLocation()
+		return false, err
+	case "regs", "r":
+		d.printRegisters()
+	case "set":
+		return false, d.set(strings.Join(args, ""))
+	case "disas":
+		return false, d.disas(args)
+	case "screen":
+		return false, NewTerminalWithOutput(d.out).Render(d.cpu.Screen(), d.cpu.ScreenSettings)
+	case "heatmap":
+		return false, d.writeHeatmap(args)
+	case "sprites":
+		return false, d.writeSprites(args)
+	case "search":
+		return false, d.searchMemory(args)
+	case "key":
+		return false, d.pressKey(args)
+	case "reset":
+		return false, d.reset(args)
+	case "help", "h":
+		fmt.Fprint(d.out, debuggerHelp)
+	case "quit", "q":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown command %q, try help", cmd)
+	}
+
+	return false, nil
+}
+
+// step executes a single instruction
+func (d *Debugger) step() error {
+	if int(d.cpu.Pc)+1 >= xip8.MEMORY_SIZE {
+		return errProgramFinished
+	}
+
+	return d.cpu.LoopOnce()
+}
+
+// run steps until done returns true, a breakpoint is reached or the user
+// presses Ctrl-C. The instruction at the PC always runs, even if it has a
+// breakpoint, so the execution can continue from breakpoints.
+func (d *Debugger) run(done func() bool) error {
+	d.interrupted.Store(false)
+	defer d.printLocation()
+
+	for {
+		if err := d.step(); err != nil {
+			return err
+		}
+
+		switch {
+		case done():
+			return nil
+		case d.cpu.HasBreakpoint(d.cpu.Pc):
+			fmt.Fprintf(d.out, "Breakpoint at %s\n", d.symbols.Format(d.cpu.Pc))
+			return nil
+		case d.interrupted.Load():
+			fmt.Fprintln(d.out, "Interrupted")
+			return nil
+		}
+	}
+}
+
+func (d *Debugger) stepCommand(args []string) error {
+	n := 1
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			return fmt.Errorf("invalid count %q", args[0])
+		}
+	}
+
+	return d.run(func() bool {
+		n--
+		return n == 0
+	})
+}
+
+func (d *Debugger) frame(args []string) error {
+	n := uint(1)
+	if len(args) > 0 {
+		c, err := strconv.Atoi(args[0])
+		if err != nil || c < 1 {
+			return fmt.Errorf("invalid count %q", args[0])
+		}
+		n = uint(c)
+	}
+
+	end := d.cpu.Frames() + n
+	return d.run(func() bool { return d.cpu.Frames() >= end })
+}
+
+func (d *Debugger) reverseStep(args []string) error {
+	n := 1
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			return fmt.Errorf("invalid count %q", args[0])
+		}
+	}
+	defer d.printLocation()
+
+	for range n {
+		if err := d.cpu.ReverseStep(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Debugger) next() error {
+	sp := d.cpu.Sp
+	return d.run(func() bool { return d.cpu.Sp <= sp })
+}
+
+func (d *Debugger) finish() error {
+	sp := d.cpu.Sp
+	if sp == 0 {
+		return errors.New("not inside a subroutine")
+	}
+
+	return d.run(func() bool { return d.cpu.Sp < sp })
+}
+
+// resolve parses an address or label
+func (d *Debugger) resolve(s string) (uint16, error) {
+	return d.symbols.Resolve(s)
+}
+
+func (d *Debugger) setBreakpoint(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: break ADDR")
+	}
+
+	addr, err := d.resolve(args[0])
+	if err != nil {
+		return err
+	}
+	d.cpu.SetBreakpoint(addr)
+	fmt.Fprintf(d.out, "Breakpoint at %s\n", d.symbols.Format(addr))
+
+	return nil
+}
+
+func (d *Debugger) deleteBreakpoint(args []string) error {
+	if len(args) == 0 {
+		d.cpu.ClearBreakpoints()
+		return nil
+	}
+
+	for _, arg := range args {
+		addr, err := d.resolve(arg)
+		if err != nil {
+			return err
+		}
+		if !d.cpu.HasBreakpoint(addr) {
+			return fmt.Errorf("no breakpoint at %s", d.symbols.Format(addr))
+		}
+		d.cpu.ClearBreakpoint(addr)
+	}
+
+	return nil
+}
+
+func (d *Debugger) printLocation() {
+	ins := analysis.Decode(d.cpu.Memory[:], d.cpu.Pc)
+	fmt.Fprintf(d.out, "%s  %04X  %s\n", d.symbols.Format(d.cpu.Pc), ins.OpCode, ins.Format(d.symbols))
+}
+
+func (d *Debugger) printRegisters() {
+	for x, v := range d.cpu.V {
+		fmt.Fprintf(d.out, "V%X=%02X", x, v)
+		if x%8 == 7 {
+			fmt.Fprintln(d.out)
+		} else {
+			fmt.Fprint(d.out, " ")
+		}
+	}
+	fmt.Fprintf(d.out, "I=%03X PC=%s SP=%X DT=%02X ST=%02X\n",
+		d.cpu.I, d.symbols.Format(d.cpu.Pc), d.cpu.Sp, d.cpu.Dt, d.cpu.St)
+
+	if d.cpu.Sp > 0 {
+		fmt.Fprint(d.out, "Stack:")
+		for i := int(d.cpu.Sp) - 1; i >= 0 && i < len(d.cpu.Stack); i-- {
+			fmt.Fprintf(d.out, " %s", d.symbols.Format(d.cpu.Stack[i]))
+		}
+		fmt.Fprintln(d.out)
+	}
+}
+
+// dump prints memory as hexadecimal bytes, 8 per line
+func (d *Debugger) dump(count string, args []string) error {
+	n := defaultDumpCount
+	if len(count) > 0 {
+		var err error
+		if n, err = strconv.Atoi(count); err != nil || n < 1 {
+			return fmt.Errorf("invalid count %q", count)
+		}
+	}
+	if len(args) != 1 {
+		return errors.New("usage: x/N ADDR")
+	}
+
+	addr, err := d.resolve(args[0])
+	if err != nil {
+		return err
+	}
+
+	end := min(int(addr)+n, xip8.MEMORY_SIZE)
+	for line := int(addr); line < end; line += 8 {
+		fmt.Fprintf(d.out, "0x%03X:", line)
+		for i := line; i < min(line+8, end); i++ {
+			fmt.Fprintf(d.out, " %02X", d.cpu.Memory[i])
+		}
+		fmt.Fprintln(d.out)
+	}
+
+	return nil
+}
+
+// set changes a register or a byte of memory
+func (d *Debugger) set(assignment string) error {
+	target, value, found := strings.Cut(assignment, "=")
+	if !found {
+		return errors.New("usage: set REG=VALUE")
+	}
+
+	v, err := symbols.ParseAddress(value)
+	if err != nil {
+		return fmt.Errorf("invalid value %q", value)
+	}
+
+	name := strings.ToUpper(target)
+	if len(name) == 2 && name[0] == 'V' {
+		if x, err := strconv.ParseUint(name[1:], 16, 8); err == nil {
+			d.cpu.V[x] = byte(v)
+			return nil
+		}
+	}
+
+	switch name {
+	case "I":
+		d.cpu.I = v
+	case "PC":
+		if int(v)+1 >= xip8.MEMORY_SIZE {
+			return fmt.Errorf("PC 0x%04X is outside of the memory", v)
+		}
+		d.cpu.Pc = v
+	case "SP":
+		if int(v) > len(d.cpu.Stack) {
+			return fmt.Errorf("SP %d is outside of the stack", v)
+		}
+		d.cpu.Sp = byte(v)
+	case "DT":
+		d.cpu.Dt = byte(v)
+	case "ST":
+		d.cpu.St = byte(v)
+	default:
+		addr, err := d.resolve(strings.Trim(target, "[]"))
+		if err != nil || int(addr) >= xip8.MEMORY_SIZE {
+			return fmt.Errorf("unknown register or address %q", target)
+		}
+		d.cpu.Memory[addr] = byte(v)
+	}
+
+	return nil
+}
+
+func (d *Debugger) disas(args []string) error {
+	addr, n := d.cpu.Pc, defaultDisasCount
+	if len(args) > 0 {
+		var err error
+		if addr, err = d.resolve(args[0]); err != nil {
+			return err
+		}
+	}
+	if len(args) > 1 {
+		var err error
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+			return fmt.Errorf("invalid count %q", args[1])
+		}
+	}
+
+	for i := 0; i < n && int(addr)+1 < xip8.MEMORY_SIZE; i++ {
+		marker := "  "
+		if addr == d.cpu.Pc {
+			marker = "=>"
+		}
+		if d.cpu.HasBreakpoint(addr) {
+			marker = marker[:1] + "*"
+		}
+		if name, found := d.symbols.Label(addr); found {
+			fmt.Fprintf(d.out, "%s:\n", name)
+		}
+
+		ins := analysis.Decode(d.cpu.Memory[:], addr)
+		fmt.Fprintf(d.out, "%s 0x%03X  %04X  %s\n", marker, addr, ins.OpCode, ins.Format(d.symbols))
+		addr = ins.Next()
+	}
+
+	return nil
+}
+
+// reset restarts the program, keeping the memory as it is with soft
+func (d *Debugger) reset(args []string) error {
+	switch {
+	case len(args) == 0:
+		if err := d.cpu.HardReset(); err != nil {
+			return err
+		}
+	case args[0] == "soft":
+		d.cpu.SoftReset()
+	default:
+		return fmt.Errorf("unknown reset %q, use reset or reset soft", args[0])
+	}
+
+	d.printLocation()
+	return nil
+}
+
+func (d *Debugger) pressKey(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: key K")
+	}
+
+	k, err := strconv.ParseUint(args[0], 16, 8)
+	if err != nil || k > 0xF {
+		return fmt.Errorf("invalid key %q", args[0])
+	}
+	d.keyboard.Press(byte(k))
+
+	return nil
+}
+
+// writeHeatmap writes the memory accesses as a PNG
+func (d *Debugger) writeHeatmap(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: heatmap FILE")
+	}
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	if err := errors.Join(d.heatmap.WritePNG(f), f.Close()); err != nil {
+		return err
+	}
+	fmt.Fprintf(d.out, "Heatmap written to %s\n", args[0])
+
+	return nil
+}
+
+// writeSprites writes a region of the memory as sprites, highlighting what I points to
+func (d *Debugger) writeSprites(args []string) error {
+	if len(args) < 1 || len(args) > 4 {
+		return errors.New("usage: sprites FILE [ADDR] [N] [H|16x16]")
+	}
+
+	sheet := sprites.Sheet{
+		Start:   d.cpu.I,
+		Count:   defaultSpriteCount,
+		Height:  defaultSpriteHeight,
+		Columns: defaultSpriteColumns,
+		Scale:   spriteScale,
+	}
+	if len(args) > 1 {
+		var err error
+		if sheet.Start, err = d.resolve(args[1]); err != nil {
+			return err
+		}
+	}
+	if len(args) > 2 {
+		var err error
+		if sheet.Count, err = strconv.Atoi(args[2]); err != nil || sheet.Count < 1 {
+			return fmt.Errorf("invalid count %q", args[2])
+		}
+	}
+	if len(args) > 3 {
+		var err error
+		if args[3] == "16x16" {
+			sheet.Wide = true
+		} else if sheet.Height, err = strconv.Atoi(args[3]); err != nil || sheet.Height < 1 || sheet.Height > 16 {
+			return fmt.Errorf("invalid height %q", args[3])
+		}
+	}
+	sheet.HighlightIndex(d.cpu)
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	if err := errors.Join(sheet.WritePNG(f, d.cpu.Memory[:]), f.Close()); err != nil {
+		return err
+	}
+	fmt.Fprintf(d.out, "Sprites written to %s\n", args[0])
+
+	return nil
+}
+
+// searchMemory takes snapshots of the memory to find where the program keeps a value
+func (d *Debugger) searchMemory(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: search start|equal|changed|increased|decreased|list [N]|value V")
+	}
+
+	switch args[0] {
+	case "start":
+		d.search.Start(d.cpu.Memory)
+		fmt.Fprintf(d.out, "%d candidates\n", d.search.Count())
+		return nil
+	case "list":
+		n := defaultSearchCount
+		if len(args) > 1 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				return fmt.Errorf("invalid count %q", args[1])
+			}
+		}
+		d.printCandidates(n)
+		return nil
+	}
+
+	f, err := search.ParseFilter(args[0])
+	if err != nil {
+		return err
+	}
+	var value uint16
+	if f == search.Value {
+		if len(args) != 2 {
+			return errors.New("usage: search value V")
+		}
+		if value, err = symbols.ParseAddress(args[1]); err != nil || value > 0xFF {
+			return fmt.Errorf("invalid value %q", args[1])
+		}
+	}
+
+	n, err := d.search.Filter(d.cpu.Memory, f, byte(value))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(d.out, "%d candidates\n", n)
+	if n <= defaultSearchCount {
+		d.printCandidates(n)
+	}
+
+	return nil
+}
+
+func (d *Debugger) printCandidates(n int) {
+	for _, c := range d.search.Candidates(n) {
+		fmt.Fprintf(d.out, "%s: %02X -> %02X\n", d.symbols.Format(c.Address), c.Previous, c.Value)
+	}
+	if rest := d.search.Count() - n; rest > 0 {
+		fmt.Fprintf(d.out, "... %d more\n", rest)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/guslan/xip8"
+)
+
+func TestDebugger(t *testing.T) {
+	kb := &DebuggerKeyboard{}
+	cpu := xip8.NewCpu(func(config *xip8.CpuConfig) {
+		config.Keyboard = kb
+	})
+	program := []byte{
+		0x60, 0x05, // 0x200: LD V0, 0x05
+		0x22, 0x08, // 0x202: CALL 0x208
+		0xF2, 0x0A, // 0x204: LD V2, K
+		0x12, 0x06, // 0x206: JP 0x206
+		0x61, 0x07, // 0x208: LD V1, 0x07
+		0x00, 0xEE, // 0x20A: RET
+	}
+	if err := cpu.LoadProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.Boot(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	d := NewDebugger(cpu, kb, nil, out)
+	input := strings.Join([]string{
+		"break 0x202",
+		"continue",
+		"next",
+		"regs",
+		"set V3=0x10",
+		"set 0x300=0xAB",
+		"set PC=0xFFF",
+		"set SP=0xFF",
+		"x/2 0x300",
+		"key a",
+		"step 2",
+		"quit",
+	}, "\n")
+	if err := d.Run(strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+
+	if cpu.Pc != 0x206 {
+		t.Fatalf(`cpu.Pc = %03x, expected 206`, cpu.Pc)
+	}
+	if cpu.V[1] != 0x07 || cpu.V[2] != 0x0A || cpu.V[3] != 0x10 {
+		t.Fatalf(`cpu.V = %x, expected V1=07, V2=0A and V3=10`, cpu.V)
+	}
+	for _, expected := range []string{"Breakpoint at 0x202", "0x204  F20A  LD V2, K", "0x300: AB 00", "error: PC 0x0FFF is outside of the memory", "error: SP 255 is outside of the stack"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Fatalf("the output does not contain %q:\n%s", expected, out.String())
+		}
+	}
+}
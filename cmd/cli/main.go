@@ -5,51 +5,275 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"io"
 	"log"
 	"os"
+	"strings"
 
 	xip8 "github.com/guslan/xip8"
+	"github.com/guslan/xip8/analysis"
+	"github.com/guslan/xip8/cheats"
+	"github.com/guslan/xip8/coverage"
+	"github.com/guslan/xip8/crash"
+	"github.com/guslan/xip8/gdb"
+	"github.com/guslan/xip8/loader"
+	"github.com/guslan/xip8/patch"
+	"github.com/guslan/xip8/romdb"
+	"github.com/guslan/xip8/sprites"
+	"github.com/guslan/xip8/symbols"
+	"github.com/guslan/xip8/trace"
 )
 
 func main() {
 	speedPtr := flag.Uint("speed", 30, "specify the speed of the chip in Hz (default: 30)")
-	debug := flag.Bool("debug", false, "render nothing (default: false)")
+	debug := flag.Bool("debug", false, "start an interactive debugger instead of running the rom (default: false)")
+	romDbPath := flag.String("romdb", "", "path to a rom database override file")
+	symbolsPath := flag.String("symbols", "", "path to a symbol file with the labels of the rom")
+	tracePath := flag.String("trace", "", "path of a file where every executed instruction is logged")
+	chromeTracePath := flag.String("chrome-trace", "", "path of a file where a timeline is written in the Chrome trace-event format")
+	coveragePath := flag.String("coverage", "", "path of a file where a listing annotated with the coverage is written on exit")
+	lcovPath := flag.String("lcov", "", "path of a file where the coverage is written in the lcov format on exit")
+	ripPath := flag.String("rip", "", "path without extension where the drawn sprites are written on exit, as PNG and JSON")
+	gdbAddr := flag.String("gdb", "", "address where a GDB remote server waits for a debugger, e.g. :1234")
+	crashDir := flag.String("crash-dir", ".", "directory where a crash dump is written when the rom fails")
+	patchPaths := flag.String("patch", "", "comma-separated IPS or BPS patches applied to the rom before loading it")
+	cheatsPath := flag.String("cheats", "", "path to a cheat file, read after the cheats of the rom in the config directory")
+	crashPath := flag.String("open-crash", "", "path of a crash dump to inspect in the debugger instead of a rom")
+	loadAddr := flag.String("load", "", "address where the rom is loaded, e.g. 0x600 for the ETI-660 (default: the one of the platform)")
+	entryAddr := flag.String("entry", "", "address of the first instruction (default: the load address)")
+	fontName := flag.String("font", "", "font of the digits, one of "+strings.Join(xip8.FontNames(), ", ")+" or the path of a font file (default: chip48)")
+	fontAddr := flag.String("font-address", "", "address where the font is loaded (default: 0x000)")
 
 	flag.Parse()
 
+	// Crash dumps are always inspected in the debugger
+	if len(*crashPath) > 0 {
+		*debug = true
+	}
+
+	debuggerKeyboard := &DebuggerKeyboard{}
 	cpu := xip8.NewCpu(func(config *xip8.CpuConfig) {
-		var t *Terminal
+		if *debug || len(*gdbAddr) > 0 {
+			config.HistorySize = xip8.DefaultHistorySize
+		}
 		if *debug {
-			t = NewTerminalWithOutput(nullWriter{})
-		} else {
-			t = NewTerminal()
+			// The debugger prints the screen on demand and owns the input
+			config.Display = xip8.NewDummyDisplay()
+			config.Keyboard = debuggerKeyboard
+			return
 		}
+
+		t := NewTerminal()
 		config.Display = t
 		config.Keyboard = t
 	})
-	if flag.NArg() < 1 {
-		log.Fatalln("must provide the path to a rom as an argument")
+	recorder := crash.NewRecorder(crash.DefaultInstructions)
+	recorder.Attach(cpu)
+
+	var program []byte
+	var dump *crash.Dump
+	var err error
+	if len(*crashPath) > 0 {
+		if dump, err = crash.Open(*crashPath); err != nil {
+			log.Fatalln(err)
+		}
+	} else {
+		if flag.NArg() < 1 {
+			log.Fatalln("must provide the path to a rom as an argument")
+		}
+
+		rom, err := loader.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		program = rom.Data
+
+		db, err := romdb.Open(*romDbPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		// The settings of a patched rom are the ones of the original
+		if settings, found := rom.Lookup(db); found {
+			settings.Apply(cpu)
+		}
+		if len(*loadAddr) > 0 {
+			if cpu.Layout.LoadAddress, err = symbols.ParseAddress(*loadAddr); err != nil {
+				log.Fatalln(err)
+			}
+			cpu.Layout.EntryPoint = 0
+		}
+		if len(*entryAddr) > 0 {
+			if cpu.Layout.EntryPoint, err = symbols.ParseAddress(*entryAddr); err != nil {
+				log.Fatalln(err)
+			}
+		}
+		if len(*fontName) > 0 {
+			if cpu.Font, err = xip8.OpenFont(*fontName); err != nil {
+				log.Fatalln(err)
+			}
+		}
+		if len(*fontAddr) > 0 {
+			if cpu.FontAddress, err = symbols.ParseAddress(*fontAddr); err != nil {
+				log.Fatalln(err)
+			}
+		}
+		if program, err = patch.ApplyFiles(program, patch.SplitList(*patchPaths)...); err != nil {
+			log.Fatalln(err)
+		}
+		if err := cpu.LoadProgram(program); err != nil {
+			log.Fatalln(err)
+		}
+
+		list, err := cheats.Open(romdb.Hash(program), *cheatsPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		engine := cheats.NewEngine()
+		engine.Load(list)
+		engine.Attach(cpu)
 	}
 
-	program, err := os.ReadFile(flag.Arg(0))
-	if err != nil {
-		log.Fatalln(err)
+	var table *symbols.Table
+	if len(*symbolsPath) > 0 {
+		if table, err = symbols.Load(*symbolsPath); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	// Files written when the program exits, fails or is interrupted
+	outputs := &exitOutputs{}
+	defer outputs.close()
+
+	if len(*tracePath) > 0 {
+		f, err := os.Create(*tracePath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		logger := trace.NewLogger(f, table)
+		logger.Attach(cpu)
+		outputs.add(func() {
+			logger.Flush()
+			f.Close()
+		})
+	}
+
+	if len(*chromeTracePath) > 0 {
+		f, err := os.Create(*chromeTracePath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		tracer := trace.NewChromeTracer(f, table)
+		tracer.Attach(cpu)
+		outputs.add(func() {
+			tracer.Close()
+			f.Close()
+		})
+	}
+
+	if len(*coveragePath) > 0 || len(*lcovPath) > 0 {
+		cov := coverage.New()
+		cov.Attach(cpu)
+		outputs.add(func() { writeCoverage(cov, program, cpu.Layout.LoadAddress, table, *coveragePath, *lcovPath) })
+	}
+
+	if len(*ripPath) > 0 {
+		ripper := sprites.NewRipper()
+		ripper.Attach(cpu)
+		outputs.add(func() { writeRippedSprites(ripper, *ripPath) })
 	}
-	cpu.LoadProgram(program)
 
 	if err := cpu.Boot(); err != nil {
 		log.Fatalln(err)
 	}
 
+	if dump != nil {
+		if err := dump.Restore(cpu); err != nil {
+			log.Fatalln(err)
+		}
+		dump.WriteReport(os.Stdout, table)
+	}
+
+	if *debug {
+		if err := NewDebugger(cpu, debuggerKeyboard, table, os.Stdout).Run(os.Stdin); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	// Ctrl-C is the only way to leave the terminal
+	outputs.closeOnInterrupt(cpu)
+
+	if len(*gdbAddr) > 0 {
+		// Wait for the debugger to continue the program
+		cpu.Stop()
+		go func() {
+			if err := gdb.NewServer(cpu).ListenAndServe(*gdbAddr); err != nil {
+				log.Fatalln(err)
+			}
+		}()
+	}
+
 	if err := cpu.LoopAtSpeed(*speedPtr); err != nil {
+		outputs.close()
+
+		dump := crash.New(cpu, err, recorder)
+		dump.RomHash = romdb.Hash(program)
+		if path, dumpErr := dump.WriteFile(*crashDir, table); dumpErr != nil {
+			log.Println("could not write the crash dump:", dumpErr)
+		} else {
+			log.Println("crash dump written to", path)
+		}
 		log.Fatalln(err)
 	}
 }
 
-type nullWriter struct{}
+// writeRippedSprites writes the sprite sheet and its index next to each other
+func writeRippedSprites(ripper *sprites.Ripper, path string) {
+	sheet, err := os.Create(path + ".png")
+	if err != nil {
+		log.Println("could not write the sprites:", err)
+		return
+	}
+	defer sheet.Close()
+
+	index, err := os.Create(path + ".json")
+	if err != nil {
+		log.Println("could not write the sprites:", err)
+		return
+	}
+	defer index.Close()
+
+	if err := ripper.Write(sheet, index, sprites.DefaultRipColumns, sprites.DefaultRipScale); err != nil {
+		log.Println("could not write the sprites:", err)
+	}
+}
+
+// writeCoverage writes the annotated listing and the lcov report of the program loaded at start
+func writeCoverage(cov *coverage.Coverage, program []byte, start uint16, table *symbols.Table, listingPath, lcovPath string) {
+	a := analysis.AnalyzeAt(program, start)
+	a.ApplySymbols(table)
+
+	if len(listingPath) > 0 {
+		if err := writeFile(listingPath, func(w io.Writer) error { return cov.WriteListing(w, a) }); err != nil {
+			log.Println("could not write the coverage:", err)
+		}
+	}
+	if len(lcovPath) > 0 {
+		if err := writeFile(lcovPath, func(w io.Writer) error { return cov.WriteLcov(w, a, listingPath) }); err != nil {
+			log.Println("could not write the coverage:", err)
+		}
+	}
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
 
-// Write implements [io.Writer].
-func (nullWriter) Write(p []byte) (n int, err error) {
-	return len(p), nil
+	return errors.Join(write(f), f.Close())
 }
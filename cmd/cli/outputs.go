@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/guslan/xip8"
+)
+
+// exitOutputs closes the files written by the tools, like the Chrome trace
+// or the coverage, once and in reverse order. The loop of the terminal never
+// returns, so they are closed on Ctrl-C and when the program fails too.
+type exitOutputs struct {
+	once  sync.Once
+	funcs []func()
+}
+
+func (o *exitOutputs) add(f func()) {
+	o.funcs = append(o.funcs, f)
+}
+
+func (o *exitOutputs) close() {
+	o.once.Do(func() {
+		for i := len(o.funcs) - 1; i >= 0; i-- {
+			o.funcs[i]()
+		}
+	})
+}
+
+// closeOnInterrupt stops the CPU and closes the outputs before exiting on Ctrl-C.
+// They are closed between two cycles, while the hooks writing them are idle.
+func (o *exitOutputs) closeOnInterrupt(cpu *xip8.Cpu) {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		<-interrupts
+		cpu.Exec(func() {
+			cpu.Stop()
+			o.close()
+			os.Exit(1)
+		})
+	}()
+}
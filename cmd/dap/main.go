@@ -0,0 +1,49 @@
+/*
+ *   Copyright (c) 2024 Gustavo Lopez <git.gustavolopez.xyz@gmail.com>
+ *   All rights reserved.
+ */
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+
+	"github.com/guslan/xip8/dap"
+)
+
+func main() {
+	listen := flag.String("listen", "", "address where the server waits for editors, e.g. :4711 (default: stdin and stdout)")
+	flag.Parse()
+
+	// stdout belongs to the protocol
+	log.SetOutput(os.Stderr)
+
+	if len(*listen) == 0 {
+		if err := dap.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Println("Waiting for editors on", l.Addr())
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+			if err := dap.NewServer(conn, conn).Serve(); err != nil {
+				log.Println(err)
+			}
+		}(conn)
+	}
+}
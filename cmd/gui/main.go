@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 
 	"github.com/guslan/xip8"
 	"github.com/guslan/xip8/gui"
+	"github.com/guslan/xip8/patch"
+	"github.com/guslan/xip8/romdb"
+	"github.com/guslan/xip8/symbols"
 )
 
 func init() {
@@ -19,19 +23,68 @@ func main() {
 	debug := flag.Bool("debug", false, "Show debug information for the console (defaults = false).")
 	initialSpeed := flag.Uint("speed", xip8.DefaultSpeed, fmt.Sprintf("The starting speed of the CPU in Hz. It has to be in the range [5, 700] (defaults = %d).", xip8.DefaultSpeed))
 	cyclesPerFrame := flag.Uint("xframes", xip8.DefaultCyclesPerFrame, fmt.Sprintf("The number of cycles that run between each frame (defaults = %d).", xip8.DefaultCyclesPerFrame))
+	romDbPath := flag.String("romdb", "", "Path to a ROM database override file.")
+	symbolsPath := flag.String("symbols", "", "Path to a symbol file with the labels of the ROM.")
+	breakpoints := flag.String("break", "", "Comma-separated addresses or labels to stop at.")
+	crashDir := flag.String("crash-dir", ".", "Directory where a crash dump is written when the ROM fails.")
+	patchPaths := flag.String("patch", "", "Comma-separated IPS or BPS patches applied to the ROM before loading it.")
+	cheatsPath := flag.String("cheats", "", "Path to a cheat file, read after the cheats of the ROM in the config directory.")
+	fontName := flag.String("font", "", fmt.Sprintf("Font of the digits, one of %s or the path of a font file (defaults = the one of the platform).", strings.Join(xip8.FontNames(), ", ")))
+	fontAddr := flag.String("font-address", "", "Address where the font is loaded (defaults = 0x000).")
 
 	flag.Parse()
 
+	db, err := romdb.Open(*romDbPath)
+	if err != nil {
+		slog.Error("Error loading the ROM database", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	var table *symbols.Table
+	if len(*symbolsPath) > 0 {
+		if table, err = symbols.Load(*symbolsPath); err != nil {
+			slog.Error("Error loading the symbols", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}
+	addrs, err := table.ResolveList(*breakpoints)
+	if err != nil {
+		slog.Error("Error setting the breakpoints", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	var font xip8.Font
+	if len(*fontName) > 0 {
+		if font, err = xip8.OpenFont(*fontName); err != nil {
+			slog.Error("Error loading the font", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}
+	var fontAddress uint16
+	if len(*fontAddr) > 0 {
+		if fontAddress, err = symbols.ParseAddress(*fontAddr); err != nil {
+			slog.Error("Error parsing the font address", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}
+
 	var app *gui.App
 
 	app = gui.NewApp(func(config *gui.AppConfig) {
 		config.Speed = max(*initialSpeed, 5)
 		config.UseDebugger = *debug
 		config.CyclesPerFrame = *cyclesPerFrame
+		config.RomDatabase = db
+		config.Symbols = table
+		config.Breakpoints = addrs
+		config.CrashDir = *crashDir
+		config.CheatsPath = *cheatsPath
+		config.Font = font
+		config.FontAddress = fontAddress
 	})
 
 	if flag.NArg() > 0 {
-		app.Load(flag.Arg(0))
+		app.Load(flag.Arg(0), patch.SplitList(*patchPaths)...)
 	}
 
 	app.Run(*autostart)
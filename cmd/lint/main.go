@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/analysis"
+	"github.com/guslan/xip8/loader"
+	"github.com/guslan/xip8/patch"
+	"github.com/guslan/xip8/romdb"
+	"github.com/guslan/xip8/symbols"
+)
+
+// extensions supported by the platforms of the ROM database
+var extensions = map[string]analysis.Extension{
+	"originalChip8":         analysis.Chip8,
+	"hybridVIP":             analysis.Chip8,
+	"modernChip8":           analysis.Chip8,
+	"chip8x":                analysis.Chip8,
+	"chip48":                analysis.Chip8,
+	romdb.PlatformEti660:    analysis.Chip8,
+	"superchip1":            analysis.SuperChip,
+	romdb.PlatformSuperChip: analysis.SuperChip,
+	"megachip8":             analysis.SuperChip,
+	romdb.PlatformXoChip:    analysis.XoChip,
+}
+
+type Report struct {
+	File     string             `json:"file"`
+	Hash     string             `json:"sha1"`
+	Platform string             `json:"platform"`
+	Errors   int                `json:"errors"`
+	Warnings int                `json:"warnings"`
+	Findings []analysis.Finding `json:"findings"`
+}
+
+func main() {
+	platform := flag.String("platform", "", "platform to lint for (default: from the rom database or detected)")
+	romDbPath := flag.String("romdb", "", "path to a rom database override file")
+	patchPaths := flag.String("patch", "", "comma-separated IPS or BPS patches applied to the roms before linting them")
+	text := flag.Bool("text", false, "print the findings as text instead of JSON (default: false)")
+	loadAddr := flag.String("load", "", "address where the roms are loaded, e.g. 0x600 for the ETI-660 (default: the one of the platform)")
+	fontName := flag.String("font", "", "font of the digits, one of "+strings.Join(xip8.FontNames(), ", ")+" or the path of a font file (default: the one of the platform)")
+	fontAddr := flag.String("font-address", "", "address where the font is loaded (default: 0x000)")
+
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		log.Fatalln("must provide the path to a rom as an argument")
+	}
+	var load uint16
+	if len(*loadAddr) > 0 {
+		var err error
+		if load, err = symbols.ParseAddress(*loadAddr); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	var font xip8.Font
+	if len(*fontName) > 0 {
+		var err error
+		if font, err = xip8.OpenFont(*fontName); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	var fontAddress uint16
+	if len(*fontAddr) > 0 {
+		var err error
+		if fontAddress, err = symbols.ParseAddress(*fontAddr); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	db, err := romdb.Open(*romDbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	reports := make([]Report, 0, flag.NArg())
+	errors := 0
+	for _, path := range flag.Args() {
+		program, err := loader.Load(path)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if program, err = patch.ApplyFiles(program, patch.SplitList(*patchPaths)...); err != nil {
+			log.Fatalln(err)
+		}
+
+		report, err := lint(db, path, program, *platform, load, font, fontAddress)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		reports = append(reports, report)
+		errors += report.Errors
+	}
+
+	if *text {
+		printText(reports)
+	} else {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if errors > 0 {
+		os.Exit(1)
+	}
+}
+
+// lint analyzes the program loaded where its platform loads it, or at load if it is not 0.
+// The font of the platform is used unless another one is given.
+func lint(db *romdb.Database, path string, program []byte, platform string, load uint16, font xip8.Font, fontAddress uint16) (Report, error) {
+	settings, found := db.Lookup(program)
+	if !found {
+		settings = db.Detect(program).Settings
+	}
+
+	if len(platform) > 0 {
+		if _, known := extensions[platform]; !known {
+			return Report{}, fmt.Errorf("unknown platform %q", platform)
+		}
+		settings.Platform = platform
+		settings.Layout = romdb.Layout(platform)
+		settings.Font = romdb.Font(platform)
+		if p, found := db.Platform(platform); found {
+			settings.Quirks = p.Quirks.Flags()
+		}
+	}
+	if load == 0 {
+		load = settings.Layout.LoadAddress
+	}
+	if len(font.Small) == 0 {
+		font = settings.Font
+	}
+	if len(font.Small) == 0 {
+		font = xip8.DefaultFont
+	}
+
+	a := analysis.AnalyzeAt(program, load)
+	report := Report{
+		File:     path,
+		Hash:     romdb.Hash(program),
+		Platform: settings.Platform,
+		Findings: a.Lint(analysis.LintOptions{
+			Extension:   extensions[settings.Platform],
+			Quirks:      settings.Quirks,
+			Font:        font,
+			FontAddress: fontAddress,
+		}),
+	}
+
+	for _, f := range report.Findings {
+		switch f.Severity {
+		case analysis.SeverityError:
+			report.Errors++
+		case analysis.SeverityWarning:
+			report.Warnings++
+		}
+	}
+
+	return report, nil
+}
+
+func printText(reports []Report) {
+	for _, r := range reports {
+		for _, f := range r.Findings {
+			fmt.Printf("%s:0x%03X: %s: %s (%s)\n", r.File, f.Address, f.Severity, f.Message, f.Rule)
+		}
+		fmt.Printf("%s: %d errors, %d warnings for %s\n", r.File, r.Errors, r.Warnings, r.Platform)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/guslan/xip8/patch"
+)
+
+func main() {
+	format := flag.String("format", "", "format of the patch, ips or bps (default: from the extension of -o, or bps)")
+	outputPath := flag.String("o", "", "path of the patch file (default: stdout)")
+
+	flag.Parse()
+
+	if flag.NArg() < 2 {
+		log.Fatalln("must provide the paths to the original and the modified roms as arguments")
+	}
+
+	source, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	target, err := os.ReadFile(flag.Arg(1))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	f := patch.Bps
+	switch {
+	case len(*format) > 0:
+		if f, err = patch.ParseFormat(*format); err != nil {
+			log.Fatalln(err)
+		}
+	case len(*outputPath) > 0:
+		if ext, err := patch.ParseFormat(filepath.Ext(*outputPath)); err == nil {
+			f = ext
+		}
+	}
+
+	p, err := patch.Create(f, source, target)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if len(*outputPath) == 0 {
+		_, err = os.Stdout.Write(p)
+	} else {
+		err = os.WriteFile(*outputPath, p, 0o644)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
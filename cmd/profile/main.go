@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	xip8 "github.com/guslan/xip8"
+	"github.com/guslan/xip8/loader"
+	"github.com/guslan/xip8/patch"
+	"github.com/guslan/xip8/profile"
+	"github.com/guslan/xip8/romdb"
+	"github.com/guslan/xip8/symbols"
+	"github.com/guslan/xip8/trace"
+)
+
+func main() {
+	frames := flag.Uint("frames", 600, "number of frames to run the rom for (default: 600)")
+	cyclesPerFrame := flag.Uint("cycles-per-frame", 0, "cycles executed in every frame (default: from the rom database)")
+	romDbPath := flag.String("romdb", "", "path to a rom database override file")
+	symbolsPath := flag.String("symbols", "", "path to a symbol file with the labels of the rom")
+	hotspots := flag.Int("top", profile.DefaultHotspots, "number of addresses listed in the report")
+	foldedPath := flag.String("folded", "", "path of a file where the call stacks are written in the folded format of flamegraphs")
+	pprofPath := flag.String("pprof", "", "path of a file where the profile is written in the pprof format")
+	patchPaths := flag.String("patch", "", "comma-separated IPS or BPS patches applied to the rom before loading it")
+	chromeTracePath := flag.String("chrome-trace", "", "path of a file where a timeline is written in the Chrome trace-event format")
+
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		log.Fatalln("must provide the path to a rom as an argument")
+	}
+
+	rom, err := loader.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	program := rom.Data
+
+	db, err := romdb.Open(*romDbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var table *symbols.Table
+	if len(*symbolsPath) > 0 {
+		if table, err = symbols.Load(*symbolsPath); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	cpu := xip8.NewCpu()
+	// The settings of a patched rom are the ones of the original
+	if settings, found := rom.Lookup(db); found {
+		settings.Apply(cpu)
+	}
+	if program, err = patch.ApplyFiles(program, patch.SplitList(*patchPaths)...); err != nil {
+		log.Fatalln(err)
+	}
+	if *cyclesPerFrame > 0 {
+		cpu.CyclesPerFrame = *cyclesPerFrame
+	}
+	if err := cpu.LoadProgram(program); err != nil {
+		log.Fatalln(err)
+	}
+	if err := cpu.Boot(); err != nil {
+		log.Fatalln(err)
+	}
+
+	profiler := profile.NewProfiler(table)
+	profiler.Attach(cpu)
+
+	var tracer *trace.ChromeTracer
+	if len(*chromeTracePath) > 0 {
+		f, err := os.Create(*chromeTracePath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer f.Close()
+
+		tracer = trace.NewChromeTracer(f, table)
+		tracer.Attach(cpu)
+	}
+
+	// The rom runs as fast as possible, without input
+	var loopErr error
+	for profiler.Frames() < *frames {
+		if loopErr = cpu.LoopOnce(); loopErr != nil {
+			break
+		}
+	}
+
+	if tracer != nil {
+		if err := tracer.Close(); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if err := profiler.WriteReport(os.Stdout, *hotspots); err != nil {
+		log.Fatalln(err)
+	}
+
+	if len(*foldedPath) > 0 {
+		if err := writeFile(*foldedPath, profiler.WriteFolded); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if len(*pprofPath) > 0 {
+		if err := writeFile(*pprofPath, profiler.WritePprof); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if loopErr != nil {
+		log.Fatalln("the rom stopped:", loopErr)
+	}
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(write(f), f.Close())
+}
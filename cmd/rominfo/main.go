@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/guslan/xip8/analysis"
+	"github.com/guslan/xip8/loader"
+	"github.com/guslan/xip8/patch"
+	"github.com/guslan/xip8/romdb"
+	"github.com/guslan/xip8/symbols"
+)
+
+func main() {
+	romDbPath := flag.String("romdb", "", "path to a rom database override file")
+	verbose := flag.Bool("v", false, "list every signature and issue found (default: false)")
+	dot := flag.Bool("dot", false, "print the control-flow graph in the Graphviz DOT language instead (default: false)")
+	disasm := flag.Bool("disasm", false, "print the disassembly instead (default: false)")
+	patchPaths := flag.String("patch", "", "comma-separated IPS or BPS patches applied to the roms before inspecting them")
+	symbolsPath := flag.String("symbols", "", "path to a symbol file with the labels of the rom")
+
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		log.Fatalln("must provide the path to a rom as an argument")
+	}
+
+	db, err := romdb.Open(*romDbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var table *symbols.Table
+	if len(*symbolsPath) > 0 {
+		if table, err = symbols.Load(*symbolsPath); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	for _, path := range flag.Args() {
+		program, err := loader.Load(path)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if program, err = patch.ApplyFiles(program, patch.SplitList(*patchPaths)...); err != nil {
+			log.Fatalln(err)
+		}
+
+		if *dot || *disasm {
+			a := analysis.AnalyzeAt(program, entryPoint(db, program))
+			a.ApplySymbols(table)
+			if *dot {
+				err = a.WriteDot(os.Stdout)
+			} else {
+				err = a.WriteListing(os.Stdout)
+			}
+			if err != nil {
+				log.Fatalln(err)
+			}
+			continue
+		}
+
+		printInfo(db, path, program, *verbose)
+	}
+}
+
+// entryPoint returns the address where the program is loaded
+func entryPoint(db *romdb.Database, program []byte) uint16 {
+	if _, found := db.Lookup(program); found {
+		return analysis.StartOfProgram
+	}
+
+	return db.Detect(program).EntryPoint
+}
+
+func printInfo(db *romdb.Database, path string, program []byte, verbose bool) {
+	fmt.Printf("File:       %s\n", path)
+	fmt.Printf("Size:       %d bytes\n", len(program))
+	fmt.Printf("SHA-1:      %s\n", romdb.Hash(program))
+
+	settings, found := db.Lookup(program)
+	if found {
+		fmt.Printf("Title:      %s\n", settings.Title)
+		fmt.Printf("Platform:   %s (from the ROM database)\n", db.PlatformName(settings.Platform))
+	} else {
+		d := db.Detect(program)
+		settings = d.Settings
+
+		fmt.Printf("Title:      unknown\n")
+		fmt.Printf("Platform:   %s (detected, %.0f%% confidence)\n", db.PlatformName(d.Platform), d.Confidence*100)
+		fmt.Printf("Entry:      0x%03X\n", d.EntryPoint)
+		fmt.Printf("Signatures: %d\n", len(d.Signatures))
+		if verbose {
+			for _, s := range d.Signatures {
+				fmt.Printf("  0x%03X %04X %-13s %s\n", s.Address, s.OpCode, s.Platform, s.Reason)
+			}
+		}
+	}
+
+	fmt.Printf("Screen:     %dx%d\n", settings.ScreenSettings.Width, settings.ScreenSettings.Height)
+	if settings.TickRate > 0 {
+		fmt.Printf("Tick rate:  %d\n", settings.TickRate)
+	}
+
+	quirks := romdb.QuirksFromFlags(settings.Quirks)
+	names := make([]string, 0, len(quirks))
+	for name := range quirks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Printf("Quirks:\n")
+	for _, name := range names {
+		fmt.Printf("  %-22s %t\n", name, quirks[name])
+	}
+
+	a := analysis.AnalyzeAt(program, entryPoint(db, program))
+	code := a.CodeSize()
+	fmt.Printf("Code:       %d bytes in %d blocks and %d subroutines\n", code, len(a.Blocks), len(a.Subroutines))
+	fmt.Printf("Data:       %d bytes\n", len(program)-code)
+	fmt.Printf("Issues:     %d\n", len(a.Issues))
+	if verbose {
+		for _, issue := range a.Issues {
+			fmt.Printf("  0x%03X %-21s %s\n", issue.Address, issue.Kind, issue.Message)
+		}
+	}
+	fmt.Println()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/guslan/xip8/sprites"
+)
+
+func main() {
+	decode := flag.Bool("decode", false, "convert raw sprite bytes into a PNG instead")
+	width := flag.Int("width", 8, "width of the sprites: 8, or 16 for SCHIP sprites")
+	height := flag.Int("height", 8, "rows of the sprites, from 1 to 16")
+	colors := flag.Int("colors", 2, "colors of the sprites: 2, or 4 for the two XO-CHIP planes")
+	format := flag.String("format", "db", "output format of the bytes: db (assembler), octo or raw")
+	label := flag.String("label", "sprite", "label of the first sprite, the next ones are numbered")
+	columns := flag.Int("columns", 16, "sprites per row of the decoded PNG")
+	outputPath := flag.String("o", "", "path of the output file (default: stdout)")
+
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		log.Fatalln("must provide the path to an image (or to the sprite bytes with -decode) as an argument")
+	}
+
+	planes := 1
+	switch *colors {
+	case 2:
+	case 4:
+		planes = 2
+	default:
+		log.Fatalln("sprites have 2 or 4 colors")
+	}
+
+	var out io.Writer = os.Stdout
+	if len(*outputPath) > 0 {
+		f, err := os.Create(*outputPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	if *decode {
+		data, err := os.ReadFile(flag.Arg(0))
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		img, err := sprites.Decode(data, *width, *height, planes, *columns)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err := png.Encode(w, img); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	encoded, err := sprites.Encode(img, *width, *height, planes)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	switch *format {
+	case "db":
+		err = writeDb(w, encoded, *label, *width/8)
+	case "octo":
+		err = writeOcto(w, encoded, *label)
+	case "raw":
+		for _, s := range encoded {
+			if _, err = w.Write(s); err != nil {
+				break
+			}
+		}
+	default:
+		log.Fatalf("unknown format %q, use db, octo or raw\n", *format)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func spriteLabel(label string, i, count int) string {
+	if count == 1 {
+		return label
+	}
+	return fmt.Sprintf("%s_%d", label, i)
+}
+
+// rows splits a sprite in the rows of the screen it packs
+func rows(sprite []byte, rowSize int) [][]byte {
+	var rows [][]byte
+	for len(sprite) > 0 {
+		n := min(rowSize, len(sprite))
+		rows = append(rows, sprite[:n])
+		sprite = sprite[n:]
+	}
+	return rows
+}
+
+// writeDb writes the sprites as db directives, a row per line
+func writeDb(w io.Writer, encoded [][]byte, label string, rowSize int) error {
+	for i, s := range encoded {
+		if _, err := fmt.Fprintf(w, "%s:\n", spriteLabel(label, i, len(encoded))); err != nil {
+			return err
+		}
+		for _, row := range rows(s, rowSize) {
+			if _, err := fmt.Fprintf(w, "\tdb %s\t; %s\n", hexBytes(row, "0x%02X", ", "), pixels(row)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeOcto writes the sprites with an Octo label, a sprite per line
+func writeOcto(w io.Writer, encoded [][]byte, label string) error {
+	for i, s := range encoded {
+		if _, err := fmt.Fprintf(w, ": %s\n\t%s\n", spriteLabel(label, i, len(encoded)), hexBytes(s, "0x%02X", " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hexBytes(data []byte, format, sep string) string {
+	parts := make([]string, len(data))
+	for i, b := range data {
+		parts[i] = fmt.Sprintf(format, b)
+	}
+	return strings.Join(parts, sep)
+}
+
+// pixels draws the bits of a row in the comment of the db line
+func pixels(row []byte) string {
+	var sb strings.Builder
+	for _, b := range row {
+		for bit := 7; bit >= 0; bit-- {
+			if b&(1<<bit) != 0 {
+				sb.WriteByte('#')
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+	}
+	return sb.String()
+}
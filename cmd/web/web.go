@@ -7,15 +7,30 @@ package main
 import (
 	"flag"
 	"log"
-	"os"
+	"path/filepath"
+	"strings"
 
 	xip8 "github.com/guslan/xip8"
+	"github.com/guslan/xip8/gdb"
+	"github.com/guslan/xip8/loader"
+	"github.com/guslan/xip8/patch"
+	"github.com/guslan/xip8/romdb"
+	"github.com/guslan/xip8/symbols"
 	"github.com/guslan/xip8/web"
 )
 
 func main() {
 	port := flag.Int("port", 9999, "The port of the server (default = 9999)")
 	speed := flag.Int("speed", 1, "Speed in cycles per second (default = 1)")
+	romDbPath := flag.String("romdb", "", "Path to a rom database override file")
+	symbolsPath := flag.String("symbols", "", "Path to a symbol file with the labels of the rom")
+	breakpoints := flag.String("break", "", "Comma-separated addresses or labels to stop at")
+	gdbAddr := flag.String("gdb", "", "Address where a GDB remote server waits for a debugger, e.g. :1234")
+	crashDir := flag.String("crash-dir", ".", "Directory where a crash dump is written when the rom fails")
+	patchPaths := flag.String("patch", "", "Comma-separated IPS or BPS patches applied to the rom before loading it")
+	cheatsPath := flag.String("cheats", "", "Path to a cheat file, read after the cheats of the rom in the config directory")
+	fontName := flag.String("font", "", "Font of the digits, one of "+strings.Join(xip8.FontNames(), ", ")+" or the path of a font file")
+	fontAddr := flag.String("font-address", "", "Address where the font is loaded (default = 0x000)")
 	flag.Parse()
 
 	if flag.NArg() < 1 {
@@ -24,18 +39,71 @@ func main() {
 
 	// var speed uint = 30
 
-	program, err := os.ReadFile(flag.Arg(0))
+	rom, err := loader.Open(flag.Arg(0))
 	if err != nil {
 		log.Fatalln(err)
 	}
+	program := rom.Data
+
+	var table *symbols.Table
+	if len(*symbolsPath) > 0 {
+		if table, err = symbols.Load(*symbolsPath); err != nil {
+			log.Fatalln(err)
+		}
+	}
 
 	mem := xip8.NewMemory()
 	server := web.NewServer(mem, func(config *web.ServerConfig) {
 		config.UseDebugger = true
+		config.Symbols = table
+		config.CrashDir = *crashDir
+		config.CheatsPath = *cheatsPath
 	})
 
+	db, err := romdb.Open(*romDbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	// The settings of a patched rom are the ones of the original
+	if settings, found := rom.Lookup(db); found {
+		settings.Apply(server.Cpu())
+	}
+	if len(*fontName) > 0 {
+		if server.Cpu().Font, err = xip8.OpenFont(*fontName); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if len(*fontAddr) > 0 {
+		if server.Cpu().FontAddress, err = symbols.ParseAddress(*fontAddr); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if program, err = patch.ApplyFiles(program, patch.SplitList(*patchPaths)...); err != nil {
+		log.Fatalln(err)
+	}
+
+	addrs, err := table.ResolveList(*breakpoints)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, addr := range addrs {
+		server.Cpu().SetBreakpoint(addr)
+	}
+
+	if len(*gdbAddr) > 0 {
+		go func() {
+			if err := gdb.NewServer(server.Cpu()).ListenAndServe(*gdbAddr); err != nil {
+				log.Fatalln(err)
+			}
+		}()
+	}
+
 	server.Speed(*speed)
-	server.LoadProgram(program)
+	cartridge := xip8.NewCartridge(filepath.Base(flag.Arg(0)), program)
+	cartridge.Metadata["format"] = string(rom.Format)
+	if err := server.LoadCartridge(cartridge); err != nil {
+		log.Fatalln(err)
+	}
 	if err := server.Listen(*port); err != nil {
 		log.Fatalln(err)
 	}
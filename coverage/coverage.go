@@ -0,0 +1,134 @@
+// Package coverage records which bytes of the memory a program executes,
+// reads and writes, and reports them as an annotated listing or in the lcov
+// format.
+package coverage
+
+import (
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/analysis"
+)
+
+// Access is the set of ways a byte of memory was used
+type Access byte
+
+const (
+	// Executed as part of an instruction
+	Executed Access = 1 << iota
+	// Read as data by Fx65 or by DXYN as a sprite
+	Read
+	// Written by Fx55 or Fx33
+	Written
+)
+
+// String returns the access as XRW, with a dot for the missing ones
+func (a Access) String() string {
+	s := []byte("...")
+	if a&Executed != 0 {
+		s[0] = 'X'
+	}
+	if a&Read != 0 {
+		s[1] = 'R'
+	}
+	if a&Written != 0 {
+		s[2] = 'W'
+	}
+
+	return string(s)
+}
+
+// Coverage records the accesses to the memory of a CPU
+type Coverage struct {
+	access [xip8.MEMORY_SIZE]Access
+	// Executions of the instruction at each address
+	hits [xip8.MEMORY_SIZE]uint
+	// Times a skip instruction skipped and did not skip
+	skipped    [xip8.MEMORY_SIZE]uint
+	notSkipped [xip8.MEMORY_SIZE]uint
+
+	// Skip instruction being executed
+	skip   analysis.Instruction
+	inSkip bool
+}
+
+func New() *Coverage {
+	return &Coverage{}
+}
+
+// Attach registers the hooks of the coverage in the CPU
+func (c *Coverage) Attach(cpu *xip8.Cpu) {
+	cpu.AddBeforeCycleHook(c.beforeCycle)
+	cpu.AddAfterCycleHook(c.afterCycle)
+}
+
+// Access returns how the byte at the address was used
+func (c *Coverage) Access(addr uint16) Access {
+	if int(addr) >= len(c.access) {
+		return 0
+	}
+
+	return c.access[addr]
+}
+
+// Hits returns the number of times the instruction at the address was executed
+func (c *Coverage) Hits(addr uint16) uint {
+	if int(addr) >= len(c.hits) {
+		return 0
+	}
+
+	return c.hits[addr]
+}
+
+func (c *Coverage) mark(first, last uint16, access Access) {
+	for addr := int(first); addr <= int(last) && addr < len(c.access); addr++ {
+		c.access[addr] |= access
+	}
+}
+
+func (c *Coverage) beforeCycle(cpu *xip8.Cpu) {
+	if int(cpu.Pc) >= len(c.hits) {
+		return
+	}
+
+	ins := analysis.Decode(cpu.Memory[:], cpu.Pc)
+	c.hits[cpu.Pc]++
+	c.mark(cpu.Pc, cpu.Pc+ins.Size-1, Executed)
+
+	if a, found := analysis.MemoryAccess(cpu, ins); found && a.Write {
+		c.mark(a.First, a.Last, Written)
+	} else if found {
+		c.mark(a.First, a.Last, Read)
+	}
+
+	c.skip, c.inSkip = ins, ins.Kind == analysis.KindSkip
+}
+
+func (c *Coverage) afterCycle(cpu *xip8.Cpu) {
+	if !c.inSkip {
+		return
+	}
+
+	if cpu.Pc == c.skip.Next() {
+		c.notSkipped[c.skip.Address]++
+	} else {
+		c.skipped[c.skip.Address]++
+	}
+	c.inSkip = false
+}
+
+// Summary counts the bytes in [start, end) that were executed, read and written
+func (c *Coverage) Summary(start, end uint16) (executed, read, written int) {
+	for addr := int(start); addr < int(end) && addr < len(c.access); addr++ {
+		a := c.access[addr]
+		if a&Executed != 0 {
+			executed++
+		}
+		if a&Read != 0 {
+			read++
+		}
+		if a&Written != 0 {
+			written++
+		}
+	}
+
+	return executed, read, written
+}
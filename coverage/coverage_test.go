@@ -0,0 +1,76 @@
+package coverage_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/analysis"
+	"github.com/guslan/xip8/coverage"
+)
+
+func TestCoverage(t *testing.T) {
+	program := []byte{
+		0xA2, 0x0C, // 0x200: LD I, 0x20C
+		0xF1, 0x65, // 0x202: LD V1, [I]
+		0x30, 0xAB, // 0x204: SE V0, 0xAB
+		0xF0, 0x55, // 0x206: LD [I], V0
+		0x12, 0x08, // 0x208: JP 0x208
+		0x00, 0xE0, // 0x20A: CLS
+		0xAB, 0xCD, // 0x20C: data
+	}
+
+	cpu := xip8.NewCpu()
+	if err := cpu.LoadProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.Boot(); err != nil {
+		t.Fatal(err)
+	}
+
+	cov := coverage.New()
+	cov.Attach(cpu)
+	for range 5 {
+		if err := cpu.LoopOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[uint16]coverage.Access{
+		0x202: coverage.Executed,
+		0x206: 0,
+		0x20A: 0,
+		0x20C: coverage.Read,
+		0x20D: coverage.Read,
+	}
+	for addr, access := range expected {
+		if cov.Access(addr) != access {
+			t.Errorf(`cov.Access(%03X) = %s, expected %s`, addr, cov.Access(addr), access)
+		}
+	}
+	if cov.Hits(0x208) != 2 {
+		t.Errorf(`cov.Hits(208) = %d, expected 2`, cov.Hits(0x208))
+	}
+
+	a := analysis.Analyze(program)
+	listing := &bytes.Buffer{}
+	if err := cov.WriteListing(listing, a); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"##### ...  0x206", "skipped 1, not skipped 0", "- .R.  0x20A        db 0x00, 0xE0, 0xAB, 0xCD"} {
+		if !strings.Contains(listing.String(), expected) {
+			t.Errorf("the listing does not contain %q:\n%s", expected, listing.String())
+		}
+	}
+
+	lcov := &bytes.Buffer{}
+	if err := cov.WriteLcov(lcov, a, "rom.lst"); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"SF:rom.lst\n", "BRDA:5,0,0,1\n", "BRDA:5,0,1,0\n", "LF:5\nLH:4\n"} {
+		if !strings.Contains(lcov.String(), expected) {
+			t.Errorf("the lcov report does not contain %q:\n%s", expected, lcov.String())
+		}
+	}
+}
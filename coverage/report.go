@@ -0,0 +1,175 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/guslan/xip8/analysis"
+)
+
+// Maximum number of data bytes per line of the listing
+const listingBytesPerLine = 8
+
+// line is a line of the annotated listing
+type line struct {
+	// Label written before the line, if any
+	label   string
+	addr    uint16
+	size    uint16
+	ins     analysis.Instruction
+	isCode  bool
+	access  Access
+	hits    uint
+	comment string
+}
+
+// lines splits the program in instructions and data. The instructions found by
+// the analysis and the ones that were executed are code, everything else is data.
+func (c *Coverage) lines(a *analysis.Analysis) []line {
+	lines := make([]line, 0)
+
+	for addr := a.Start; addr < a.End; {
+		l := line{addr: addr}
+		if name, found := a.Symbols.Label(addr); found {
+			l.label = name
+		} else if sub, found := a.SubroutineAt(addr); found {
+			l.label = sub.Name
+		}
+
+		if _, found := a.Instructions[addr]; found || c.Hits(addr) > 0 {
+			l.ins = analysis.Decode(a.Memory, addr)
+			l.isCode = true
+			l.size = l.ins.Size
+			l.hits = c.Hits(addr)
+		} else {
+			for l.size < listingBytesPerLine && addr+l.size < a.End && a.ByteKind(addr+l.size) == analysis.ByteData && c.Hits(addr+l.size) == 0 {
+				if _, labeled := a.Symbols.Label(addr + l.size); labeled && l.size > 0 {
+					break
+				}
+				l.size++
+			}
+		}
+
+		for i := range l.size {
+			l.access |= c.Access(addr + i)
+		}
+		lines = append(lines, l)
+		addr += l.size
+	}
+
+	return lines
+}
+
+// WriteListing writes the disassembly of the program with the number of times
+// every instruction was executed and how every line was accessed (XRW).
+// Instructions that never ran are marked with '#####'.
+func (c *Coverage) WriteListing(w io.Writer, a *analysis.Analysis) error {
+	out := bufio.NewWriter(w)
+
+	executed, read, written := c.Summary(a.Start, a.End)
+	fmt.Fprintf(out, "; %d bytes: %d executed, %d read, %d written\n", a.End-a.Start, executed, read, written)
+
+	for _, l := range c.lines(a) {
+		if len(l.label) > 0 {
+			fmt.Fprintf(out, "%s:\n", l.label)
+		}
+
+		if l.isCode {
+			hits := "#####"
+			if l.hits > 0 {
+				hits = fmt.Sprint(l.hits)
+			}
+			fmt.Fprintf(out, "%9s %s  0x%03X  %04X  %s%s\n", hits, l.access, l.addr, l.ins.OpCode, l.ins.Format(a.Symbols), c.skipComment(l))
+			continue
+		}
+
+		data := make([]string, 0, l.size)
+		for i := range l.size {
+			data = append(data, fmt.Sprintf("0x%02X", a.Memory[l.addr+i]))
+		}
+		fmt.Fprintf(out, "%9s %s  0x%03X        db %s\n", "-", l.access, l.addr, strings.Join(data, ", "))
+	}
+
+	return out.Flush()
+}
+
+func (c *Coverage) skipComment(l line) string {
+	if l.ins.Kind != analysis.KindSkip {
+		return ""
+	}
+
+	return fmt.Sprintf("  ; skipped %d, not skipped %d", c.skipped[l.addr], c.notSkipped[l.addr])
+}
+
+// WriteLcov writes the coverage in the lcov tracefile format. The source file is
+// the listing written by WriteListing at the given path: every instruction is a
+// line, every subroutine a function and every skip a branch.
+func (c *Coverage) WriteLcov(w io.Writer, a *analysis.Analysis, listingPath string) error {
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintf(out, "TN:\n")
+	fmt.Fprintf(out, "SF:%s\n", listingPath)
+
+	lines := c.lines(a)
+	// Line numbers of the listing, counting the summary and the labels
+	numbers := make([]int, len(lines))
+	n := 1
+	for i, l := range lines {
+		if len(l.label) > 0 {
+			n++
+		}
+		n++
+		numbers[i] = n
+	}
+
+	functions, functionsHit := 0, 0
+	for i, l := range lines {
+		if sub, found := a.SubroutineAt(l.addr); found && l.isCode {
+			fmt.Fprintf(out, "FN:%d,%s\n", numbers[i], sub.Name)
+			fmt.Fprintf(out, "FNDA:%d,%s\n", l.hits, sub.Name)
+			functions++
+			if l.hits > 0 {
+				functionsHit++
+			}
+		}
+	}
+	fmt.Fprintf(out, "FNF:%d\nFNH:%d\n", functions, functionsHit)
+
+	branches, branchesHit := 0, 0
+	for i, l := range lines {
+		if !l.isCode || l.ins.Kind != analysis.KindSkip {
+			continue
+		}
+
+		for branch, taken := range []uint{c.skipped[l.addr], c.notSkipped[l.addr]} {
+			count := "-"
+			if l.hits > 0 {
+				count = fmt.Sprint(taken)
+			}
+			fmt.Fprintf(out, "BRDA:%d,0,%d,%s\n", numbers[i], branch, count)
+			branches++
+			if taken > 0 {
+				branchesHit++
+			}
+		}
+	}
+	fmt.Fprintf(out, "BRF:%d\nBRH:%d\n", branches, branchesHit)
+
+	found, hit := 0, 0
+	for i, l := range lines {
+		if !l.isCode {
+			continue
+		}
+		fmt.Fprintf(out, "DA:%d,%d\n", numbers[i], l.hits)
+		found++
+		if l.hits > 0 {
+			hit++
+		}
+	}
+	fmt.Fprintf(out, "LF:%d\nLH:%d\n", found, hit)
+	fmt.Fprintf(out, "end_of_record\n")
+
+	return out.Flush()
+}
@@ -3,6 +3,7 @@ package xip8
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 )
 
@@ -75,6 +76,12 @@ type Cpu struct {
 	screen         []byte
 	isScreenDirty  bool
 
+	// Where the programs are loaded and start
+	Layout Layout
+	// Sprites of the digits and where they are loaded
+	Font        Font
+	FontAddress uint16
+
 	Display  Display
 	Keyboard Keyboard
 	Buzzer   Buzzer
@@ -87,6 +94,18 @@ type Cpu struct {
 	keyDstRegister uint16
 	lastError      error
 
+	breakpoints map[uint16]bool
+	// Guards the breakpoints, which are changed from other goroutines
+	breakpointsMu *sync.RWMutex
+	// Held by the loop while it runs a cycle, so Exec runs between cycles
+	cycleMu *sync.Mutex
+	// Set when the CPU resumes so that it does not stop at the same breakpoint
+	resuming bool
+	// Set when the CPU has to pause after the current cycle
+	stepping bool
+	// Undo records of the last cycles, nil when disabled
+	history *history
+
 	// Hooks that run before every frame
 	beforeFrameHooks []Hook
 	// Hooks that run before every cycle
@@ -97,6 +116,13 @@ type Cpu struct {
 	afterFrameHooks []Hook
 	// Hooks that run after an error
 	errorHooks []Hook
+	// Hooks that run when a breakpoint is hit
+	breakpointHooks []Hook
+	// Hooks that run after the ROM is loaded into the memory
+	loadHooks []Hook
+
+	// ROM loaded last
+	cartridge *Cartridge
 }
 
 // CpuConfig
@@ -105,6 +131,12 @@ type CpuConfig struct {
 	Memory *Memory
 	// Defaults to SmallScreen
 	ScreenSettings ScreenSettings
+	// Defaults to Chip8Layout
+	Layout Layout
+	// Defaults to DefaultFont
+	Font Font
+	// Address of the font used by Fx29 and Fx30. Defaults to 0
+	FontAddress uint16
 	// Defaults to nothing
 	Quirks QuirkFlag
 	// Defaults to DummyDisplay
@@ -115,6 +147,8 @@ type CpuConfig struct {
 	Buzzer Buzzer
 
 	CyclesPerFrame uint
+	// Number of cycles that can be undone. Defaults to 0 (disabled)
+	HistorySize int
 }
 type CpuConfigCb func(config *CpuConfig)
 
@@ -122,17 +156,20 @@ func NewCpu(configs ...CpuConfigCb) *Cpu {
 	config := &CpuConfig{
 		Memory:         NewMemory(),
 		ScreenSettings: SmallScreen,
+		Layout:         Chip8Layout,
+		Font:           DefaultFont,
 		Quirks:         Chip8Quirks,
 		Display:        NewDummyDisplay(),
 		Keyboard:       NewInMemoryKeyboard(),
 		Buzzer:         NewDummyBuzzer(),
 		CyclesPerFrame: DefaultCyclesPerFrame,
+		HistorySize:    0,
 	}
 	for _, cb := range configs {
 		cb(config)
 	}
 
-	return &Cpu{
+	cpu := &Cpu{
 		Memory: config.Memory,
 
 		V:     [16]byte{},
@@ -153,6 +190,10 @@ func NewCpu(configs ...CpuConfigCb) *Cpu {
 		screen:         newScreen(config.ScreenSettings.Width, config.ScreenSettings.Height),
 		isScreenDirty:  false,
 
+		Layout:      config.Layout,
+		Font:        config.Font,
+		FontAddress: config.FontAddress,
+
 		Display:  config.Display,
 		Keyboard: config.Keyboard,
 		Buzzer:   config.Buzzer,
@@ -165,12 +206,24 @@ func NewCpu(configs ...CpuConfigCb) *Cpu {
 		keyDstRegister: 0,
 		lastError:      nil,
 
+		breakpoints:   map[uint16]bool{},
+		breakpointsMu: &sync.RWMutex{},
+		cycleMu:       &sync.Mutex{},
+		resuming:      false,
+		stepping:      false,
+		history:       nil,
+
 		beforeFrameHooks: make([]Hook, 0),
 		beforeCycleHooks: make([]Hook, 0),
 		afterCycleHooks:  make([]Hook, 0),
 		afterFrameHooks:  make([]Hook, 0),
 		errorHooks:       make([]Hook, 0),
+		breakpointHooks:  make([]Hook, 0),
+		loadHooks:        make([]Hook, 0),
 	}
+	cpu.SetHistorySize(config.HistorySize)
+
+	return cpu
 }
 
 func (cpu Cpu) IsRunning() bool {
@@ -202,10 +255,20 @@ func (cpu Cpu) Frames() uint {
 	return cpu.frames
 }
 
+// Quirks returns the behaviours of the CPU that differ between platforms
+func (cpu Cpu) Quirks() QuirkFlag {
+	return cpu.quirks
+}
+
 func (cpu *Cpu) SetQuirks(q QuirkFlag) {
 	cpu.quirks = q
 }
 
+// LastError returns the error that stopped the loop, if any
+func (cpu Cpu) LastError() error {
+	return cpu.lastError
+}
+
 // Boot initializes all the components
 // If the CPU was already booted, this method is a noop
 func (cpu *Cpu) Boot() error {
@@ -230,18 +293,68 @@ func (cpu *Cpu) Boot() error {
 	return nil
 }
 
-// LoadProgram loads the program into memory and sets the PC to the start-of-program address
+// LoadProgram loads the program into memory and sets the PC to the entry point of the layout
 func (cpu *Cpu) LoadProgram(program []byte) error {
-	cpu.Reset()
-	return cpu.Memory.LoadProgram(program)
+	return cpu.LoadCartridge(NewCartridge("", program))
 }
 
+// LoadCartridge inserts the cartridge and does a hard reset, which loads its ROM
+func (cpu *Cpu) LoadCartridge(c *Cartridge) error {
+	if int(cpu.Layout.LoadAddress)+len(c.Rom) > MEMORY_SIZE {
+		return ErrProgramDoesNotFitIntoMemory
+	}
+	if int(cpu.FontAddress)+cpu.Font.Size() > MEMORY_SIZE {
+		return fmt.Errorf("%w: it does not fit at 0x%03X", ErrInvalidFont, cpu.FontAddress)
+	}
+	fontEnd, romEnd := int(cpu.FontAddress)+cpu.Font.Size(), int(cpu.Layout.LoadAddress)+len(c.Rom)
+	if int(cpu.FontAddress) < romEnd && int(cpu.Layout.LoadAddress) < fontEnd {
+		return fmt.Errorf("%w: it overlaps the program at 0x%03X", ErrInvalidFont, cpu.FontAddress)
+	}
+
+	cpu.cartridge = c
+	return cpu.HardReset()
+}
+
+// Cartridge returns the cartridge that was loaded last, nil if there is none
+func (cpu Cpu) Cartridge() *Cartridge {
+	return cpu.cartridge
+}
+
+// HardReset clears the memory and loads the font and the original ROM of the
+// cartridge again, undoing the changes of the program to itself, and then
+// does a soft reset. It fails when the font or the ROM no longer fit with
+// the current layout.
+func (cpu *Cpu) HardReset() error {
+	*cpu.Memory = Memory{}
+	if err := cpu.Memory.LoadFont(cpu.FontAddress, cpu.Font); err != nil {
+		return err
+	}
+	if cpu.cartridge != nil {
+		if err := cpu.Memory.LoadProgramAt(cpu.Layout.LoadAddress, cpu.cartridge.Rom); err != nil {
+			return err
+		}
+	}
+
+	cpu.SoftReset()
+	cpu.runLoadHooks()
+	return nil
+}
+
+// Reset resets the registers, the timers and the screen.
+//
+// Deprecated: use SoftReset, or HardReset to load the ROM again.
 func (cpu *Cpu) Reset() {
+	cpu.SoftReset()
+}
+
+// SoftReset resets the registers, the timers and the screen, leaving the
+// memory as it is
+func (cpu *Cpu) SoftReset() {
 	cpu.V = [16]byte{}
 	cpu.I = 0
 	cpu.Dt = 0
 	cpu.St = 0
-	cpu.Pc = startOfProgram
+	cpu.Pc = cpu.Layout.Entry()
 	cpu.Sp = 0
 	cpu.Stack = [16]uint16{}
 
@@ -249,6 +362,9 @@ func (cpu *Cpu) Reset() {
 	cpu.cycles = 0
 	cpu.waitingForKey = false
 	cpu.lastError = nil
+	if cpu.history != nil {
+		cpu.history.clear()
+	}
 
 	cpu.clearScreen()
 	cpu.Display.Render(cpu.screen, cpu.ScreenSettings)
@@ -260,6 +376,21 @@ func (cpu *Cpu) LoopAtSpeed(speedInHz uint) error {
 	return cpu.Loop()
 }
 
+// Exec runs fn between two cycles of the loop and waits for it, so that other
+// goroutines can read and change the CPU while the loop runs. It must not be
+// called from the hooks, which already run on the loop.
+func (cpu *Cpu) Exec(fn func()) {
+	cpu.cycleMu.Lock()
+	defer cpu.cycleMu.Unlock()
+
+	fn()
+}
+
+// Pause stops the CPU and waits for the current cycle to finish
+func (cpu *Cpu) Pause() {
+	cpu.Exec(cpu.Stop)
+}
+
 // Loop starts the loop at the current speed
 func (cpu *Cpu) Loop() error {
 	if !cpu.isBooted {
@@ -273,20 +404,28 @@ func (cpu *Cpu) Loop() error {
 	var last time.Time
 
 	for {
-		if done, err := cpu.runNextCycle(); err != nil {
+		cpu.cycleMu.Lock()
+		done, err := cpu.runNextCycle()
+		step := cpu.step
+		cpu.cycleMu.Unlock()
+
+		if err != nil {
 			return err
 		} else if done {
 			return nil
 		}
 
 		// Prevent the CPU from running faster than expected
-		time.Sleep(max(cpu.step-time.Since(last), 0))
+		time.Sleep(max(step-time.Since(last), 0))
 		last = time.Now()
 	}
 }
 
 // LoopOnce runs a single cycle bypassing the pause state
 func (cpu *Cpu) LoopOnce() error {
+	cpu.cycleMu.Lock()
+	defer cpu.cycleMu.Unlock()
+
 	if !cpu.isBooted {
 		return ErrCpuIsNotBooted
 	}
@@ -297,6 +436,7 @@ func (cpu *Cpu) LoopOnce() error {
 
 	prev := cpu.isPaused
 	cpu.isPaused = false
+	cpu.resuming = true
 	defer func(cpu *Cpu, prev bool) {
 		cpu.isPaused = prev
 	}(cpu, prev)
@@ -316,7 +456,9 @@ func (cpu *Cpu) runNextCycle() (bool, error) {
 	}
 
 	if cpu.waitingForKey {
+		// Only the cycle that gets the key is recorded, not the ones waiting for it
 		if k, pressed := cpu.Keyboard.GetPressed(); pressed {
+			cpu.recordHistory()
 			cpu.V[cpu.keyDstRegister] = k
 			cpu.waitingForKey = false
 		}
@@ -324,6 +466,12 @@ func (cpu *Cpu) runNextCycle() (bool, error) {
 
 		}
 	} else {
+		if cpu.checkBreakpoint() {
+			return false, nil
+		}
+		cpu.resuming = false
+		cpu.recordHistory()
+
 		// for i := 0; i < int(cpu.CyclesPerFrame); i++ {
 		cpu.runBeforeCycleHooks()
 		if err := cpu.executeNextInstruction(); err != nil {
@@ -362,6 +510,11 @@ func (cpu *Cpu) runNextCycle() (bool, error) {
 
 	cpu.runAfterFrameHooks()
 
+	if cpu.stepping {
+		cpu.stepping = false
+		cpu.isPaused = true
+	}
+
 	return false, nil
 }
 
@@ -1,7 +1,9 @@
 package xip8_test
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/guslan/xip8"
 )
@@ -150,3 +152,349 @@ func TestSimpleSkips(t *testing.T) {
 	assertVxEq(t, "SE Vx V2 true", cpu, 0x6, 0x0)
 	assertVxEq(t, "SE Vx V1 false", cpu, 0x5, 0x1)
 }
+
+// TestBreakpoint stops before the instruction at the breakpoint and continues after resuming
+func TestBreakpoint(t *testing.T) {
+	cpu := xip8.NewCpu()
+	cpu.CyclesPerFrame = 1
+	cpu.SetSpeedInHz(xip8.MaxSpeed)
+
+	program := []byte{
+		// set v0 to 1
+		0x60, 1,
+		// set v1 to 2
+		0x61, 2,
+		// move to the last address
+		0x1F, 0xFE,
+	}
+	cpu.SetBreakpoint(0x202)
+	hits := make(chan uint16, 1)
+	cpu.AddBreakpointHook(func(cpu *xip8.Cpu) {
+		hits <- cpu.Pc
+	})
+
+	if err := cpu.LoadProgram(program); err != nil {
+		t.Fatalf(`LoadProgram() returned an error %v`, err)
+	}
+	if err := cpu.Boot(); err != nil {
+		t.Fatalf(`Boot() returned an error %v`, err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- cpu.Loop()
+	}()
+
+	select {
+	case pc := <-hits:
+		if pc != 0x202 {
+			t.Fatalf(`stopped at %X, expected 202`, pc)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf(`the breakpoint was not hit`)
+	}
+	// The loop keeps running while paused
+	cpu.Exec(func() {
+		if cpu.IsRunning() {
+			t.Fatalf(`cpu.IsRunning() = true after hitting a breakpoint`)
+		}
+		assertVxEq(t, "before the breakpoint", cpu, 0x0, 1)
+		assertVxEq(t, "at the breakpoint", cpu, 0x1, 0)
+
+		cpu.Start()
+	})
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf(`Loop() returned an error %v`, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf(`the program did not finish after resuming`)
+	}
+	assertVxEq(t, "after resuming", cpu, 0x1, 2)
+}
+
+// TestReverseStep runs a program and undoes it instruction by instruction
+func TestReverseStep(t *testing.T) {
+	cpu := xip8.NewCpu(func(config *xip8.CpuConfig) {
+		config.HistorySize = 16
+	})
+
+	program := []byte{
+		0x60, 0x7B, // LD V0, 123
+		0xA3, 0x00, // LD I, 0x300
+		0xF0, 0x33, // LD B, V0
+		0x22, 0x0C, // CALL 0x20C
+		0x12, 0x08, // JP 0x208
+		0x00, 0x00,
+		0xD0, 0x05, // DRW V0, V0, 5
+		0x00, 0xEE, // RET
+	}
+
+	type state struct {
+		cpu    xip8.Cpu
+		memory xip8.Memory
+		screen xip8.Screen
+	}
+	states := make([]state, 0)
+	if err := runNCycles(cpu, program, 0); err != nil {
+		t.Fatal(err)
+	}
+	for range 6 {
+		states = append(states, state{*cpu, *cpu.Memory, cpu.Screen()})
+		if err := cpu.LoopOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if cpu.HistoryLen() != 6 {
+		t.Fatalf(`cpu.HistoryLen() = %d, expected 6`, cpu.HistoryLen())
+	}
+
+	for i := len(states) - 1; i >= 0; i-- {
+		if err := cpu.ReverseStep(); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := states[i]
+		if cpu.Pc != expected.cpu.Pc || cpu.V != expected.cpu.V || cpu.I != expected.cpu.I || cpu.Sp != expected.cpu.Sp {
+			t.Fatalf(`after undoing cycle %d the registers are PC=%03x V=%x I=%03x SP=%d, expected PC=%03x V=%x I=%03x SP=%d`,
+				i, cpu.Pc, cpu.V, cpu.I, cpu.Sp, expected.cpu.Pc, expected.cpu.V, expected.cpu.I, expected.cpu.Sp)
+		}
+		if *cpu.Memory != expected.memory {
+			t.Fatalf(`after undoing cycle %d the memory differs`, i)
+		}
+		if string(cpu.Screen()) != string(expected.screen) {
+			t.Fatalf(`after undoing cycle %d the screen differs`, i)
+		}
+	}
+
+	if err := cpu.ReverseStep(); err != xip8.ErrHistoryEmpty {
+		t.Fatalf(`ReverseStep() = %v, expected ErrHistoryEmpty`, err)
+	}
+
+	// Run again and go back to the breakpoint at the subroutine
+	for range 6 {
+		cpu.LoopOnce()
+	}
+	cpu.SetBreakpoint(0x20C)
+	if err := cpu.ReverseContinue(); err != nil {
+		t.Fatal(err)
+	}
+	if cpu.Pc != 0x20C || cpu.Sp != 1 {
+		t.Fatalf(`ReverseContinue() stopped at PC=%03x SP=%d, expected PC=20c SP=1`, cpu.Pc, cpu.Sp)
+	}
+}
+
+// keyAfterPolls is a keyboard whose key is pressed after it was polled a number of times
+type keyAfterPolls struct {
+	xip8.InMemoryKeyboard
+	polls int
+	key   byte
+}
+
+func (kb *keyAfterPolls) GetPressed() (byte, bool) {
+	kb.polls--
+	return kb.key, kb.polls < 0
+}
+
+func (kb *keyAfterPolls) IsPressed(k byte) bool {
+	return false
+}
+
+// TestReverseStepWaitingForKey only records the cycle that gets the key
+func TestReverseStepWaitingForKey(t *testing.T) {
+	kb := &keyAfterPolls{polls: 10, key: 0x0B}
+	cpu := xip8.NewCpu(func(config *xip8.CpuConfig) {
+		config.HistorySize = 16
+		config.Keyboard = kb
+	})
+
+	program := []byte{
+		0xF2, 0x0A, // LD V2, K
+		0x12, 0x02, // JP 0x202
+	}
+	if err := runNCycles(cpu, program, 13); err != nil {
+		t.Fatal(err)
+	}
+	if cpu.V[2] != 0x0B || cpu.HistoryLen() != 3 {
+		t.Fatalf(`cpu.V[2] = %x and cpu.HistoryLen() = %d, expected b and the instruction, the key and the jump`, cpu.V[2], cpu.HistoryLen())
+	}
+
+	for range 2 {
+		if err := cpu.ReverseStep(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cpu.Pc != 0x202 || cpu.V[2] != 0 {
+		t.Fatalf(`after undoing the key PC=%03x V2=%x, expected PC=202 V2=0`, cpu.Pc, cpu.V[2])
+	}
+	if err := cpu.ReverseStep(); err != nil || cpu.Pc != 0x200 {
+		t.Fatalf(`ReverseStep() = %v with PC=%03x, expected the instruction waiting for the key at 200`, err, cpu.Pc)
+	}
+}
+
+// TestReverseStepHires restores the screen of the program before it switched to hi-res
+func TestReverseStepHires(t *testing.T) {
+	cpu := xip8.NewCpu(func(config *xip8.CpuConfig) {
+		config.HistorySize = 16
+		config.Layout = xip8.HiresLayout
+	})
+
+	program := make([]byte, 0xC2)
+	copy(program, []byte{0x12, 0x60})
+	copy(program[0xC0:], []byte{0x12, 0xC0})
+	if err := runNCycles(cpu, program, 1); err != nil {
+		t.Fatal(err)
+	}
+	if cpu.ScreenSettings != xip8.HiresScreen {
+		t.Fatalf(`the screen is %v, expected the jump to switch to %v`, cpu.ScreenSettings, xip8.HiresScreen)
+	}
+
+	if err := cpu.ReverseStep(); err != nil {
+		t.Fatal(err)
+	}
+	if cpu.Pc != 0x200 || cpu.ScreenSettings != xip8.SmallScreen || len(cpu.Screen()) != 64*32/8 {
+		t.Fatalf(`after undoing the jump PC=%03x and the screen is %v, expected PC=200 and %v`, cpu.Pc, cpu.ScreenSettings, xip8.SmallScreen)
+	}
+}
+
+// TestReset runs a program that overwrites its first instruction and resets it
+func TestReset(t *testing.T) {
+	cpu := xip8.NewCpu()
+
+	program := []byte{
+		// V0 = AB
+		0x60, 0xAB,
+		// I = 200
+		0xA2, 0x00,
+		// store V0 at 200
+		0xF0, 0x55,
+	}
+	if err := runNCycles(cpu, program, 3); err != nil {
+		t.Fatal(err)
+	}
+	if cpu.Memory[0x200] != 0xAB {
+		t.Fatalf(`cpu.Memory[0x200] = %x, expected the program to overwrite it with ab`, cpu.Memory[0x200])
+	}
+
+	cpu.SoftReset()
+	if cpu.Pc != 0x200 || cpu.V[0] != 0 || cpu.Memory[0x200] != 0xAB {
+		t.Fatalf(`after a soft reset PC=%03x V0=%x [200]=%x, expected PC=200 V0=0 [200]=ab`, cpu.Pc, cpu.V[0], cpu.Memory[0x200])
+	}
+
+	loads := 0
+	cpu.AddLoadHook(func(*xip8.Cpu) { loads++ })
+	cpu.Memory[0] = 0
+	if err := cpu.HardReset(); err != nil {
+		t.Fatal(err)
+	}
+	if cpu.Memory[0x200] != 0x60 || cpu.Memory[0] != 0xF0 || loads != 1 {
+		t.Fatalf(`after a hard reset [200]=%x [0]=%x and the load hooks ran %d times, expected the rom and the font to be reloaded once`,
+			cpu.Memory[0x200], cpu.Memory[0], loads)
+	}
+	if cpu.Cartridge().Hash != xip8.NewCartridge("", program).Hash {
+		t.Fatalf(`the cartridge has the hash %s of another rom`, cpu.Cartridge().Hash)
+	}
+
+	cpu.Layout.LoadAddress = xip8.MEMORY_SIZE - 1
+	if err := cpu.HardReset(); !errors.Is(err, xip8.ErrProgramDoesNotFitIntoMemory) {
+		t.Fatalf(`HardReset() with the rom past the end of memory returned %v`, err)
+	}
+}
+
+// TestLayout loads programs at the addresses of other interpreters
+func TestLayout(t *testing.T) {
+	cpu := xip8.NewCpu(func(config *xip8.CpuConfig) {
+		config.Layout = xip8.Eti660Layout
+		config.ScreenSettings = xip8.Eti660Screen
+	})
+	if err := runNCycles(cpu, []byte{0x60, 0x0C}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if cpu.Memory[0x600] != 0x60 || cpu.Pc != 0x602 || cpu.V[0] != 0x0C {
+		t.Fatalf(`cpu.Memory[0x600] = %x, cpu.Pc = %03x, cpu.V[0] = %x, expected the program to run from 0x600`, cpu.Memory[0x600], cpu.Pc, cpu.V[0])
+	}
+
+	cpu = xip8.NewCpu(func(config *xip8.CpuConfig) {
+		config.Layout = xip8.HiresLayout
+	})
+	program := make([]byte, 0xC2)
+	copy(program, []byte{0x12, 0x60})
+	copy(program[0xC0:], []byte{0x60, 0x0C})
+	if err := runNCycles(cpu, program, 2); err != nil {
+		t.Fatal(err)
+	}
+	if cpu.ScreenSettings != xip8.HiresScreen || cpu.Pc != 0x2C2 || cpu.V[0] != 0x0C {
+		t.Fatalf(`the screen is %v and cpu.Pc = %03x, expected the jump to 0x260 to start the hi-res program at 0x2c0`, cpu.ScreenSettings, cpu.Pc)
+	}
+}
+
+// TestFont points I to the digits of a font loaded at another address
+func TestFont(t *testing.T) {
+	cpu := xip8.NewCpu(func(config *xip8.CpuConfig) {
+		config.Font = xip8.SchipFont
+		config.FontAddress = 0x50
+	})
+
+	program := []byte{
+		// V0 = 3
+		0x60, 0x03,
+		// I = small 3
+		0xF0, 0x29,
+		// V1 = V0
+		0x81, 0x00,
+		// I = big 3
+		0xF0, 0x30,
+	}
+	if err := runNCycles(cpu, program, 2); err != nil {
+		t.Fatal(err)
+	}
+	if cpu.I != 0x50+3*5 || cpu.Memory[cpu.I] != 0xF0 {
+		t.Fatalf(`Fx29 set I = %03x, expected %03x`, cpu.I, 0x50+3*5)
+	}
+
+	cpu.LoopOnce()
+	cpu.LoopOnce()
+	if expected := uint16(0x50 + 16*5 + 3*10); cpu.I != expected || cpu.Memory[cpu.I] != 0x3C {
+		t.Fatalf(`Fx30 set I = %03x, expected %03x`, cpu.I, expected)
+	}
+
+	cpu = xip8.NewCpu()
+	if err := runNCycles(cpu, []byte{0xF0, 0x30}, 1); err == nil {
+		t.Fatal(`Fx30 worked without a big font`)
+	}
+
+	if _, err := xip8.ParseFont(make([]byte, 81)); !errors.Is(err, xip8.ErrInvalidFont) {
+		t.Fatalf(`ParseFont() = %v, expected ErrInvalidFont`, err)
+	}
+
+	cpu = xip8.NewCpu(func(config *xip8.CpuConfig) {
+		config.FontAddress = 0x1F0
+	})
+	if err := cpu.LoadProgram(program); !errors.Is(err, xip8.ErrInvalidFont) {
+		t.Fatalf(`LoadProgram() with the font over the program returned %v, expected ErrInvalidFont`, err)
+	}
+}
+
+func TestRestoreInvalidState(t *testing.T) {
+	cpu := xip8.NewCpu()
+	if err := cpu.LoadProgram([]byte{0x12, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := cpu.State()
+	s.Pc = xip8.MEMORY_SIZE - 1
+	if err := cpu.Restore(s); !errors.Is(err, xip8.ErrInvalidState) {
+		t.Fatalf(`Restore() with PC 0x%04X returned %v, expected ErrInvalidState`, s.Pc, err)
+	}
+
+	s = cpu.State()
+	s.Sp = byte(len(s.Stack) + 1)
+	if err := cpu.Restore(s); !errors.Is(err, xip8.ErrInvalidState) {
+		t.Fatalf(`Restore() with SP %d returned %v, expected ErrInvalidState`, s.Sp, err)
+	}
+	if cpu.Pc != 0x200 || cpu.Sp != 0 {
+		t.Fatalf(`Restore() changed the state to PC 0x%03X SP %d after rejecting it`, cpu.Pc, cpu.Sp)
+	}
+}
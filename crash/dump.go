@@ -0,0 +1,241 @@
+// Package crash writes and reads crash dumps, zip files with the state of
+// the machine when the loop failed, a report for humans and a PNG of the
+// screen.
+package crash
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"time"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/analysis"
+	"github.com/guslan/xip8/symbols"
+)
+
+// Names of the files inside the dump
+const (
+	stateFile  = "state.json"
+	reportFile = "report.txt"
+	screenFile = "screen.png"
+)
+
+// Number of instructions disassembled before and after the crash
+const disassemblyContext = 8
+
+// Size of the pixels in the screenshot
+const screenScale = 4
+
+var ErrInvalidDump = errors.New("the file is not a crash dump")
+
+// Dump is the state of the machine when an error stopped it
+type Dump struct {
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+	// SHA-1 of the rom, if known
+	RomHash string `json:"romHash,omitempty"`
+	// Last executed instructions, the newest one is the one that failed
+	Instructions []Executed `json:"instructions"`
+
+	State xip8.State `json:"-"`
+}
+
+// jsonState encodes the memory as base64 instead of a list of numbers
+type jsonState struct {
+	xip8.State
+	Memory []byte
+}
+
+// file is the content of state.json
+type file struct {
+	*Dump
+	State jsonState `json:"state"`
+}
+
+// New creates a dump of the cpu after err stopped it
+func New(cpu *xip8.Cpu, err error, recorder *Recorder) *Dump {
+	return &Dump{
+		Error:        err.Error(),
+		Time:         time.Now(),
+		Instructions: recorder.Instructions(),
+		State:        cpu.State(),
+	}
+}
+
+// Address returns the address of the instruction that failed
+func (d *Dump) Address() uint16 {
+	if len(d.Instructions) > 0 {
+		return d.Instructions[len(d.Instructions)-1].Address
+	}
+
+	return d.State.Pc
+}
+
+// Restore loads the state of the dump into the cpu
+func (d *Dump) Restore(cpu *xip8.Cpu) error {
+	return cpu.Restore(d.State)
+}
+
+// Write writes the dump as a zip file
+func (d *Dump) Write(w io.Writer, table *symbols.Table) error {
+	z := zip.NewWriter(w)
+
+	s := d.State
+	content, err := json.MarshalIndent(file{d, jsonState{s, s.Memory[:]}}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := z.Create(stateFile)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		return err
+	}
+
+	if f, err = z.Create(reportFile); err != nil {
+		return err
+	}
+	if err := d.WriteReport(f, table); err != nil {
+		return err
+	}
+
+	if f, err = z.Create(screenFile); err != nil {
+		return err
+	}
+	if err := png.Encode(f, ScreenImage(s.Screen, s.ScreenSettings)); err != nil {
+		return err
+	}
+
+	return z.Close()
+}
+
+// WriteFile writes the dump in dir with a name based on its time and returns its path.
+// A random suffix keeps the dumps of the same second apart.
+func (d *Dump) WriteFile(dir string, table *symbols.Table) (string, error) {
+	f, err := os.CreateTemp(dir, fmt.Sprintf("xip8-crash-%s-*.zip", d.Time.Format("20060102-150405")))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	path := f.Name()
+
+	if err := d.Write(f, table); err != nil {
+		return "", err
+	}
+
+	return path, f.Close()
+}
+
+// Open reads a dump written by WriteFile
+func Open(path string) (*Dump, error) {
+	z, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	f, err := z.Open(stateFile)
+	if err != nil {
+		return nil, ErrInvalidDump
+	}
+	defer f.Close()
+
+	content := file{Dump: &Dump{}}
+	if err := json.NewDecoder(f).Decode(&content); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDump, err)
+	}
+	if len(content.State.Memory) != xip8.MEMORY_SIZE {
+		return nil, fmt.Errorf("%w: the memory has %d bytes", ErrInvalidDump, len(content.State.Memory))
+	}
+
+	d := content.Dump
+	d.State = content.State.State
+	copy(d.State.Memory[:], content.State.Memory)
+
+	return d, nil
+}
+
+// WriteReport writes a readable summary of the dump
+func (d *Dump) WriteReport(w io.Writer, table *symbols.Table) error {
+	out := bufio.NewWriter(w)
+	s := d.State
+	mem := s.Memory[:]
+
+	fmt.Fprintf(out, "xip8 crash dump\n\n")
+	fmt.Fprintf(out, "Error:   %s\n", d.Error)
+	fmt.Fprintf(out, "Time:    %s\n", d.Time.Format(time.RFC3339))
+	if len(d.RomHash) > 0 {
+		fmt.Fprintf(out, "ROM:     %s\n", d.RomHash)
+	}
+	fmt.Fprintf(out, "Address: %s\n", table.Format(d.Address()))
+	fmt.Fprintf(out, "Cycle:   %d (frame %d)\n\n", s.Cycles, s.Frames)
+
+	fmt.Fprintf(out, "Registers\n")
+	for x, v := range s.V {
+		fmt.Fprintf(out, "  V%X=%02X", x, v)
+		if x%8 == 7 {
+			fmt.Fprintln(out)
+		}
+	}
+	fmt.Fprintf(out, "  I=%03X PC=%03X SP=%X DT=%02X ST=%02X\n\n", s.I, s.Pc, s.Sp, s.Dt, s.St)
+
+	fmt.Fprintf(out, "Call stack\n")
+	fmt.Fprintf(out, "  #0 %s\n", table.Format(d.Address()))
+	for i, n := int(s.Sp)-1, 1; i >= 0 && i < len(s.Stack); i, n = i-1, n+1 {
+		// The stack keeps the return address, the call is right before it
+		fmt.Fprintf(out, "  #%d %s\n", n, table.Format(s.Stack[i]-2))
+	}
+	fmt.Fprintln(out)
+
+	fmt.Fprintf(out, "Disassembly\n")
+	start := max(int(d.Address())-2*disassemblyContext, 0)
+	end := min(int(d.Address())+2*disassemblyContext, xip8.MEMORY_SIZE-1)
+	for addr := start; addr <= end; addr += 2 {
+		marker := "  "
+		if addr == int(d.Address()) {
+			marker = "=>"
+		}
+		ins := analysis.Decode(mem, uint16(addr))
+		fmt.Fprintf(out, "%s %-16s %04X  %s\n", marker, table.Format(uint16(addr)), ins.OpCode, ins.Format(table))
+	}
+	fmt.Fprintln(out)
+
+	fmt.Fprintf(out, "Last %d instructions\n", len(d.Instructions))
+	for _, e := range d.Instructions {
+		ins := analysis.DecodeOpCode(e.OpCode)
+		fmt.Fprintf(out, "  %8d %-16s %04X  %s\n", e.Cycle, table.Format(e.Address), e.OpCode, ins.Format(table))
+	}
+
+	return out.Flush()
+}
+
+// ScreenImage draws the packed screen as an image with white pixels on black
+func ScreenImage(screen xip8.Screen, settings xip8.ScreenSettings) image.Image {
+	img := image.NewGray(image.Rect(0, 0, settings.Width*screenScale, settings.Height*screenScale))
+
+	for y := 0; y < settings.Height; y++ {
+		for x := 0; x < settings.Width; x++ {
+			if !screen.Pixel(x, y, settings.Width) {
+				continue
+			}
+
+			for dy := range screenScale {
+				for dx := range screenScale {
+					img.SetGray(x*screenScale+dx, y*screenScale+dy, color.Gray{Y: 0xFF})
+				}
+			}
+		}
+	}
+
+	return img
+}
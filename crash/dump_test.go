@@ -0,0 +1,90 @@
+package crash_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/crash"
+)
+
+func TestDump(t *testing.T) {
+	cpu := xip8.NewCpu(func(config *xip8.CpuConfig) {
+		config.Font = xip8.VipFont
+		config.FontAddress = 0x50
+	})
+	recorder := crash.NewRecorder(4)
+	recorder.Attach(cpu)
+
+	program := []byte{
+		0x60, 0x05, // 0x200: LD V0, 0x05
+		0x22, 0x06, // 0x202: CALL 0x206
+		0x00, 0x00,
+		0xF0, 0x29, // 0x206: LD F, V0
+		0xD0, 0x05, // 0x208: DRW V0, V0, 5
+		0xF0, 0xFF, // 0x20A: unknown
+	}
+	if err := cpu.LoadProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.Boot(); err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	for err == nil {
+		err = cpu.LoopOnce()
+	}
+
+	dump := crash.New(cpu, err, recorder)
+	if dump.Address() != 0x20A {
+		t.Fatalf(`dump.Address() = %03x, expected 20a`, dump.Address())
+	}
+
+	dir := t.TempDir()
+	path, err := dump.WriteFile(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Ext(path) != ".zip" {
+		t.Fatalf(`dump written to %s, expected a zip file`, path)
+	}
+	if again, err := dump.WriteFile(dir, nil); err != nil || again == path {
+		t.Fatalf(`the second dump of the same time was written to %s (%v), expected another file than %s`, again, err, path)
+	}
+
+	opened, err := crash.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.Error != dump.Error || len(opened.Instructions) != 4 {
+		t.Fatalf(`opened dump has error %q and %d instructions, expected %q and 4`, opened.Error, len(opened.Instructions), dump.Error)
+	}
+
+	restored := xip8.NewCpu()
+	if err := opened.Restore(restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.State().Pc != cpu.Pc || restored.Sp != 1 || restored.Stack[0] != 0x204 || *restored.Memory != *cpu.Memory {
+		t.Fatalf(`the restored state differs from the dumped one`)
+	}
+	if !bytes.Equal(restored.Screen(), cpu.Screen()) {
+		t.Fatalf(`the restored screen differs from the dumped one`)
+	}
+	if restored.Layout != cpu.Layout || restored.Font.Name != "vip" || restored.FontAddress != 0x50 {
+		t.Fatalf(`restored the font %s at 0x%03X and the layout %+v, expected vip at 0x050 and %+v`,
+			restored.Font.Name, restored.FontAddress, restored.Layout, cpu.Layout)
+	}
+
+	report := &bytes.Buffer{}
+	if err := opened.WriteReport(report, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{dump.Error, "#1 0x202", "=> 0x20A"} {
+		if !strings.Contains(report.String(), expected) {
+			t.Fatalf("the report does not contain %q:\n%s", expected, report.String())
+		}
+	}
+}
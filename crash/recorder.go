@@ -0,0 +1,55 @@
+package crash
+
+import "github.com/guslan/xip8"
+
+// DefaultInstructions is the number of executed instructions kept in a dump
+const DefaultInstructions = 128
+
+// Executed is an instruction run by the CPU
+type Executed struct {
+	Cycle   uint   `json:"cycle"`
+	Address uint16 `json:"address"`
+	OpCode  uint16 `json:"opCode"`
+}
+
+// Recorder keeps the last executed instructions in a ring buffer
+type Recorder struct {
+	executed []Executed
+	next     int
+	full     bool
+}
+
+func NewRecorder(size int) *Recorder {
+	return &Recorder{executed: make([]Executed, max(size, 1))}
+}
+
+// Attach registers the hook of the recorder in the CPU
+func (r *Recorder) Attach(cpu *xip8.Cpu) {
+	cpu.AddBeforeCycleHook(r.beforeCycle)
+}
+
+func (r *Recorder) beforeCycle(cpu *xip8.Cpu) {
+	var opCode uint16
+	if int(cpu.Pc)+1 < xip8.MEMORY_SIZE {
+		opCode = uint16(cpu.Memory[cpu.Pc])<<8 | uint16(cpu.Memory[cpu.Pc+1])
+	}
+
+	r.executed[r.next] = Executed{Cycle: cpu.Cycles(), Address: cpu.Pc, OpCode: opCode}
+	r.next = (r.next + 1) % len(r.executed)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Instructions returns the recorded instructions from the oldest to the newest
+func (r *Recorder) Instructions() []Executed {
+	if r == nil {
+		return nil
+	}
+
+	if !r.full {
+		return append([]Executed{}, r.executed[:r.next]...)
+	}
+
+	return append(append([]Executed{}, r.executed[r.next:]...), r.executed[:r.next]...)
+}
@@ -0,0 +1,95 @@
+package dap
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/guslan/xip8/symbols"
+)
+
+// Listing maps the lines of an assembler listing to addresses.
+// A line belongs to an address when its first field is the address and it
+// has at least another field, e.g. "0x200 6005 LD V0, 0x05" or "200: 6005".
+// Labels and comments are ignored.
+type Listing struct {
+	lines     map[int]uint16
+	addresses map[uint16]int
+	sorted    []int
+}
+
+// LoadListing reads the listing at path
+func LoadListing(path string) (*Listing, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseListing(f)
+}
+
+// ParseListing reads a listing
+func ParseListing(r io.Reader) (*Listing, error) {
+	l := &Listing{
+		lines:     map[int]uint16{},
+		addresses: map[uint16]int{},
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		// Bare addresses are hexadecimal, but they need a digit so that
+		// mnemonics like ADD are not taken as addresses
+		field := strings.ToLower(strings.TrimSuffix(fields[0], ":"))
+		if !strings.HasPrefix(field, "0x") && !strings.HasPrefix(field, "$") {
+			if !strings.ContainsAny(field, "0123456789") {
+				continue
+			}
+			field = "0x" + field
+		}
+		addr, err := symbols.ParseAddress(field)
+		if err != nil {
+			continue
+		}
+
+		l.lines[line] = addr
+		if _, found := l.addresses[addr]; !found {
+			l.addresses[addr] = line
+		}
+		l.sorted = append(l.sorted, line)
+	}
+	sort.Ints(l.sorted)
+
+	return l, scanner.Err()
+}
+
+// Address returns the address of the first line at or after line that has one
+func (l *Listing) Address(line int) (uint16, int, bool) {
+	if l == nil {
+		return 0, 0, false
+	}
+
+	i := sort.SearchInts(l.sorted, line)
+	if i >= len(l.sorted) {
+		return 0, 0, false
+	}
+
+	return l.lines[l.sorted[i]], l.sorted[i], true
+}
+
+// Line returns the line of the address
+func (l *Listing) Line(addr uint16) (int, bool) {
+	if l == nil {
+		return 0, false
+	}
+
+	line, found := l.addresses[addr]
+	return line, found
+}
@@ -0,0 +1,797 @@
+// Package dap implements a Debug Adapter Protocol server, so editors can
+// launch and debug roms.
+//
+// The CPU loop runs in its own goroutine and the requests read and change the
+// CPU between two cycles with Cpu.Exec, so they never race the loop.
+package dap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/analysis"
+	"github.com/guslan/xip8/loader"
+	"github.com/guslan/xip8/patch"
+	"github.com/guslan/xip8/romdb"
+	"github.com/guslan/xip8/symbols"
+)
+
+// The only thread of the machine
+const threadId = 1
+
+// References of the variables of the scopes
+const (
+	registersReference = 1
+	stackReference     = 2
+)
+
+var ErrNotLaunched = errors.New("no rom has been launched")
+
+// stepMode tells the after cycle hook when to stop
+type stepMode int
+
+const (
+	stepNone stepMode = iota
+	// Stop after one instruction
+	stepIn
+	// Stop after one instruction at the same call depth or above
+	stepOver
+	// Stop after returning from the current subroutine
+	stepOut
+)
+
+// stepModes maps the stepping requests to their mode
+var stepModes = map[string]stepMode{
+	"next":    stepOver,
+	"stepIn":  stepIn,
+	"stepOut": stepOut,
+}
+
+// LaunchArguments are the arguments of the launch request
+type LaunchArguments struct {
+	// Path of the rom
+	Program string `json:"program"`
+	// Path of an assembler listing used for source breakpoints
+	Listing string `json:"listing,omitempty"`
+	// Path of a symbol file
+	Symbols string `json:"symbols,omitempty"`
+	// Path of a rom database override
+	RomDatabase string `json:"romdb,omitempty"`
+	// Paths of IPS or BPS patches applied to the rom, in order
+	Patches []string `json:"patches,omitempty"`
+	// Speed in Hz, defaults to xip8.DefaultSpeed
+	Speed       uint `json:"speed,omitempty"`
+	StopOnEntry bool `json:"stopOnEntry,omitempty"`
+}
+
+// Server is a debug session over a single connection
+type Server struct {
+	in *bufio.Reader
+
+	outMutex sync.Mutex
+	out      io.Writer
+	seq      int
+
+	cpu         *xip8.Cpu
+	symbols     *symbols.Table
+	listing     *Listing
+	listingPath string
+	stopOnEntry bool
+
+	// Set once the loop goroutine is running
+	started bool
+	// Closed when the loop returns
+	exited chan struct{}
+
+	step   stepMode
+	stepSp byte
+
+	// Breakpoints by source line and by address, the CPU has the union
+	sourceBreakpoints      []uint16
+	instructionBreakpoints []uint16
+}
+
+// NewServer creates a session that reads requests from in and writes the
+// responses and events to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:     bufio.NewReader(in),
+		out:    out,
+		exited: make(chan struct{}),
+	}
+}
+
+// Serve handles requests until the client disconnects
+func (s *Server) Serve() error {
+	for {
+		req, err := readMessage(s.in)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+
+		if req.Command == "disconnect" || req.Command == "terminate" {
+			s.respond(req, nil, nil)
+			if s.cpu != nil {
+				s.cpu.Exec(s.cpu.Stop)
+			}
+			s.sendEvent("terminated", nil)
+			return nil
+		}
+
+		s.handle(req)
+	}
+}
+
+// handle dispatches a request
+func (s *Server) handle(req *message) {
+	var body any
+	var err error
+
+	switch req.Command {
+	case "initialize":
+		body = map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsInstructionBreakpoints":   true,
+			"supportsReadMemoryRequest":        true,
+			"supportsWriteMemoryRequest":       true,
+			"supportsDisassembleRequest":       true,
+			"supportsSetVariable":              true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}
+	case "launch":
+		args := LaunchArguments{}
+		if err = json.Unmarshal(req.Arguments, &args); err == nil {
+			err = s.launch(args)
+		}
+		if err == nil {
+			s.respond(req, nil, nil)
+			s.sendEvent("initialized", nil)
+			return
+		}
+	case "setBreakpoints":
+		body, err = s.setBreakpoints(req.Arguments)
+	case "setInstructionBreakpoints":
+		body, err = s.setInstructionBreakpoints(req.Arguments)
+	case "setExceptionBreakpoints":
+		body = map[string]any{"breakpoints": []breakpoint{}}
+	case "configurationDone":
+		if err = s.requireLaunch(); err == nil {
+			s.respond(req, nil, nil)
+			s.run()
+			return
+		}
+	case "threads":
+		body = map[string]any{"threads": []map[string]any{{"id": threadId, "name": "xip8"}}}
+	case "continue":
+		if err = s.requireRunning(); err == nil {
+			s.respond(req, map[string]any{"allThreadsContinued": true}, nil)
+			s.resume(stepNone)
+			return
+		}
+	case "next", "stepIn", "stepOut":
+		if err = s.requireRunning(); err == nil {
+			s.respond(req, nil, nil)
+			s.resume(stepModes[req.Command])
+			return
+		}
+	case "pause":
+		if err = s.requireRunning(); err == nil {
+			s.respond(req, nil, nil)
+			s.cpu.Exec(func() {
+				s.step = stepNone
+				s.cpu.Stop()
+			})
+			s.sendStopped("pause", "")
+			return
+		}
+	case "stackTrace":
+		if err = s.requireLaunch(); err == nil {
+			body = s.stackTrace()
+		}
+	case "scopes":
+		body = map[string]any{"scopes": []scope{
+			{Name: "Registers", VariablesReference: registersReference},
+			{Name: "Stack", VariablesReference: stackReference},
+		}}
+	case "variables":
+		if err = s.requireLaunch(); err == nil {
+			body, err = s.variables(req.Arguments)
+		}
+	case "setVariable":
+		if err = s.requireLaunch(); err == nil {
+			body, err = s.setVariable(req.Arguments)
+		}
+	case "evaluate":
+		if err = s.requireLaunch(); err == nil {
+			body, err = s.evaluate(req.Arguments)
+		}
+	case "readMemory":
+		if err = s.requireLaunch(); err == nil {
+			body, err = s.readMemory(req.Arguments)
+		}
+	case "writeMemory":
+		if err = s.requireLaunch(); err == nil {
+			body, err = s.writeMemory(req.Arguments)
+		}
+	case "disassemble":
+		if err = s.requireLaunch(); err == nil {
+			body, err = s.disassemble(req.Arguments)
+		}
+	default:
+		err = fmt.Errorf("unsupported request %q", req.Command)
+	}
+
+	s.respond(req, body, err)
+}
+
+func (s *Server) requireLaunch() error {
+	if s.cpu == nil {
+		return ErrNotLaunched
+	}
+
+	return nil
+}
+
+func (s *Server) requireRunning() error {
+	if err := s.requireLaunch(); err != nil {
+		return err
+	}
+	if !s.started {
+		return errors.New("the configuration is not done")
+	}
+	select {
+	case <-s.exited:
+		return errors.New("the program has finished")
+	default:
+		return nil
+	}
+}
+
+// send writes a message, it is safe to call from the hooks
+func (s *Server) send(msg *message) {
+	s.outMutex.Lock()
+	defer s.outMutex.Unlock()
+
+	s.seq++
+	msg.Seq = s.seq
+	writeMessage(s.out, msg)
+}
+
+func (s *Server) respond(req *message, body any, err error) {
+	success := err == nil
+	msg := &message{
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Command:    req.Command,
+		Success:    &success,
+		Body:       body,
+	}
+	if err != nil {
+		msg.Message = err.Error()
+	}
+
+	s.send(msg)
+}
+
+func (s *Server) sendEvent(event string, body any) {
+	s.send(&message{Type: "event", Event: event, Body: body})
+}
+
+func (s *Server) sendStopped(reason, text string) {
+	body := map[string]any{
+		"reason":            reason,
+		"threadId":          threadId,
+		"allThreadsStopped": true,
+	}
+	if len(text) > 0 {
+		body["text"] = text
+	}
+
+	s.sendEvent("stopped", body)
+}
+
+// launch loads the rom and its debugging information
+func (s *Server) launch(args LaunchArguments) error {
+	if s.cpu != nil {
+		return errors.New("a rom has already been launched")
+	}
+
+	rom, err := loader.Open(args.Program)
+	if err != nil {
+		return err
+	}
+	program := rom.Data
+
+	if len(args.Symbols) > 0 {
+		if s.symbols, err = symbols.Load(args.Symbols); err != nil {
+			return err
+		}
+	}
+	if len(args.Listing) > 0 {
+		if s.listing, err = LoadListing(args.Listing); err != nil {
+			return err
+		}
+		s.listingPath = args.Listing
+	}
+
+	cpu := xip8.NewCpu()
+	db, err := romdb.Open(args.RomDatabase)
+	if err != nil {
+		return err
+	}
+	// The settings of a patched rom are the ones of the original
+	if settings, found := rom.Lookup(db); found {
+		settings.Apply(cpu)
+	}
+	if program, err = patch.ApplyFiles(program, args.Patches...); err != nil {
+		return err
+	}
+	if err := cpu.LoadProgram(program); err != nil {
+		return err
+	}
+	if err := cpu.Boot(); err != nil {
+		return err
+	}
+
+	speed := args.Speed
+	if speed == 0 {
+		speed = xip8.DefaultSpeed
+	}
+	cpu.SetSpeedInHz(speed)
+	cpu.Stop()
+
+	cpu.AddAfterCycleHook(s.afterCycle)
+	cpu.AddBreakpointHook(func(cpu *xip8.Cpu) {
+		s.step = stepNone
+		s.sendStopped("breakpoint", "")
+	})
+	cpu.AddErrorHook(func(cpu *xip8.Cpu) {
+		s.step = stepNone
+		cpu.Stop()
+	})
+
+	s.cpu = cpu
+	s.stopOnEntry = args.StopOnEntry
+
+	return nil
+}
+
+// run starts the loop once the client is configured
+func (s *Server) run() {
+	s.applyBreakpoints()
+
+	s.started = true
+	go func() {
+		err := s.cpu.Loop()
+		close(s.exited)
+
+		if err != nil {
+			s.sendStopped("exception", err.Error())
+		} else {
+			s.sendEvent("exited", map[string]any{"exitCode": 0})
+			s.sendEvent("terminated", nil)
+		}
+	}()
+
+	if s.stopOnEntry {
+		s.sendStopped("entry", "")
+	} else {
+		s.cpu.Exec(s.cpu.Start)
+	}
+}
+
+// resume continues the execution until the step mode stops it
+func (s *Server) resume(mode stepMode) {
+	s.cpu.Exec(func() {
+		s.step = mode
+		s.stepSp = s.cpu.Sp
+		s.cpu.Start()
+	})
+}
+
+// afterCycle stops the CPU once the step is complete
+func (s *Server) afterCycle(cpu *xip8.Cpu) {
+	switch {
+	case s.step == stepIn,
+		s.step == stepOver && cpu.Sp <= s.stepSp,
+		s.step == stepOut && cpu.Sp < s.stepSp:
+		s.step = stepNone
+		cpu.Stop()
+		s.sendStopped("step", "")
+	}
+}
+
+// applyBreakpoints sets the union of the breakpoints in the CPU
+func (s *Server) applyBreakpoints() {
+	if s.cpu == nil {
+		return
+	}
+
+	s.cpu.Exec(func() {
+		s.cpu.ClearBreakpoints()
+		for _, addr := range s.sourceBreakpoints {
+			s.cpu.SetBreakpoint(addr)
+		}
+		for _, addr := range s.instructionBreakpoints {
+			s.cpu.SetBreakpoint(addr)
+		}
+	})
+}
+
+func (s *Server) setBreakpoints(raw json.RawMessage) (any, error) {
+	args := struct {
+		Source      source             `json:"source"`
+		Breakpoints []sourceBreakpoint `json:"breakpoints"`
+	}{}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	isListing := len(s.listingPath) > 0 && samePath(args.Source.Path, s.listingPath)
+
+	result := make([]breakpoint, 0, len(args.Breakpoints))
+	s.sourceBreakpoints = s.sourceBreakpoints[:0]
+	for _, sb := range args.Breakpoints {
+		bp := breakpoint{Line: sb.Line}
+		if !isListing {
+			bp.Message = "the source is not the listing of the rom"
+		} else if addr, line, found := s.listing.Address(sb.Line); !found {
+			bp.Message = "no instruction at or after this line"
+		} else {
+			bp.Verified = true
+			bp.Line = line
+			bp.Source = &args.Source
+			bp.InstructionReference = formatAddress(addr)
+			s.sourceBreakpoints = append(s.sourceBreakpoints, addr)
+		}
+		result = append(result, bp)
+	}
+	s.applyBreakpoints()
+
+	return map[string]any{"breakpoints": result}, nil
+}
+
+func (s *Server) setInstructionBreakpoints(raw json.RawMessage) (any, error) {
+	args := struct {
+		Breakpoints []instructionBreakpoint `json:"breakpoints"`
+	}{}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	result := make([]breakpoint, 0, len(args.Breakpoints))
+	s.instructionBreakpoints = s.instructionBreakpoints[:0]
+	for _, ib := range args.Breakpoints {
+		addr, err := s.symbols.Resolve(ib.InstructionReference)
+		if err != nil {
+			result = append(result, breakpoint{Message: err.Error()})
+			continue
+		}
+		addr += uint16(ib.Offset)
+
+		result = append(result, breakpoint{Verified: true, InstructionReference: formatAddress(addr)})
+		s.instructionBreakpoints = append(s.instructionBreakpoints, addr)
+	}
+	s.applyBreakpoints()
+
+	return map[string]any{"breakpoints": result}, nil
+}
+
+// frame describes the instruction at addr. It must run on the loop goroutine.
+func (s *Server) frame(id int, addr uint16) stackFrame {
+	ins := analysis.Decode(s.cpu.Memory[:], addr)
+	f := stackFrame{
+		Id:                          id,
+		Name:                        fmt.Sprintf("%s: %s", s.symbols.Format(addr), ins.Format(s.symbols)),
+		InstructionPointerReference: formatAddress(addr),
+	}
+	if line, found := s.listing.Line(addr); found {
+		f.Source = &source{Name: filepath.Base(s.listingPath), Path: s.listingPath}
+		f.Line = line
+		f.Column = 1
+	}
+
+	return f
+}
+
+// stackTrace returns the PC followed by the calls in the stack
+func (s *Server) stackTrace() any {
+	var frames []stackFrame
+	s.cpu.Exec(func() {
+		frames = []stackFrame{s.frame(0, s.cpu.Pc)}
+		for i := int(s.cpu.Sp) - 1; i >= 0 && i < len(s.cpu.Stack); i-- {
+			// The stack keeps the return address, the call is right before it
+			frames = append(frames, s.frame(len(frames), s.cpu.Stack[i]-2))
+		}
+	})
+
+	return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+// registers lists the registers in the order shown to the client
+func (s *Server) registers() []variable {
+	var v [16]byte
+	var i, pc uint16
+	var sp, dt, st byte
+	s.cpu.Exec(func() {
+		v, i, pc, sp, dt, st = s.cpu.V, s.cpu.I, s.cpu.Pc, s.cpu.Sp, s.cpu.Dt, s.cpu.St
+	})
+
+	vars := make([]variable, 0, 21)
+	for x, value := range v {
+		vars = append(vars, variable{Name: fmt.Sprintf("V%X", x), Value: fmt.Sprintf("0x%02X", value)})
+	}
+
+	return append(vars,
+		variable{Name: "I", Value: fmt.Sprintf("0x%03X", i), MemoryReference: formatAddress(i)},
+		variable{Name: "PC", Value: fmt.Sprintf("0x%03X", pc), MemoryReference: formatAddress(pc)},
+		variable{Name: "SP", Value: fmt.Sprintf("0x%02X", sp)},
+		variable{Name: "DT", Value: fmt.Sprintf("0x%02X", dt)},
+		variable{Name: "ST", Value: fmt.Sprintf("0x%02X", st)},
+	)
+}
+
+func (s *Server) variables(raw json.RawMessage) (any, error) {
+	args := struct {
+		VariablesReference int `json:"variablesReference"`
+	}{}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	var vars []variable
+	switch args.VariablesReference {
+	case registersReference:
+		vars = s.registers()
+	case stackReference:
+		var stack [16]uint16
+		var sp byte
+		s.cpu.Exec(func() { stack, sp = s.cpu.Stack, s.cpu.Sp })
+
+		vars = make([]variable, 0, sp)
+		for i := 0; i < int(sp) && i < len(stack); i++ {
+			vars = append(vars, variable{
+				Name:            strconv.Itoa(i),
+				Value:           s.symbols.Format(stack[i]),
+				MemoryReference: formatAddress(stack[i]),
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unknown variables reference %d", args.VariablesReference)
+	}
+
+	return map[string]any{"variables": vars}, nil
+}
+
+// setRegister changes the value of a register by name
+func (s *Server) setRegister(name string, value uint16) error {
+	name = strings.ToUpper(name)
+	if len(name) == 2 && name[0] == 'V' {
+		if x, err := strconv.ParseUint(name[1:], 16, 8); err == nil {
+			s.cpu.Exec(func() { s.cpu.V[x] = byte(value) })
+			return nil
+		}
+	}
+
+	var set func()
+	switch name {
+	case "I":
+		set = func() { s.cpu.I = value }
+	case "PC":
+		if int(value)+1 >= xip8.MEMORY_SIZE {
+			return fmt.Errorf("PC 0x%04X is outside of the memory", value)
+		}
+		set = func() { s.cpu.Pc = value }
+	case "SP":
+		if int(value) > len(s.cpu.Stack) {
+			return fmt.Errorf("SP %d is outside of the stack", value)
+		}
+		set = func() { s.cpu.Sp = byte(value) }
+	case "DT":
+		set = func() { s.cpu.Dt = byte(value) }
+	case "ST":
+		set = func() { s.cpu.St = byte(value) }
+	default:
+		return fmt.Errorf("unknown register %s", name)
+	}
+	s.cpu.Exec(set)
+
+	return nil
+}
+
+func (s *Server) setVariable(raw json.RawMessage) (any, error) {
+	args := struct {
+		VariablesReference int    `json:"variablesReference"`
+		Name               string `json:"name"`
+		Value              string `json:"value"`
+	}{}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	if args.VariablesReference != registersReference {
+		return nil, errors.New("only registers can be changed")
+	}
+
+	value, err := s.symbols.Resolve(args.Value)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.setRegister(args.Name, value); err != nil {
+		return nil, err
+	}
+
+	for _, v := range s.registers() {
+		if strings.EqualFold(v.Name, args.Name) {
+			return map[string]any{"value": v.Value}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// evaluate resolves register names, labels and addresses
+func (s *Server) evaluate(raw json.RawMessage) (any, error) {
+	args := struct {
+		Expression string `json:"expression"`
+	}{}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	expr := strings.TrimSpace(args.Expression)
+	for _, v := range s.registers() {
+		if strings.EqualFold(v.Name, expr) {
+			return map[string]any{"result": v.Value, "variablesReference": 0, "memoryReference": v.MemoryReference}, nil
+		}
+	}
+
+	addr, err := s.symbols.Resolve(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"result":             fmt.Sprintf("0x%03X", addr),
+		"variablesReference": 0,
+		"memoryReference":    formatAddress(addr),
+	}, nil
+}
+
+func (s *Server) readMemory(raw json.RawMessage) (any, error) {
+	args := struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Count           int    `json:"count"`
+	}{}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	base, err := s.symbols.Resolve(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+
+	start := int(base) + args.Offset
+	end := min(start+args.Count, xip8.MEMORY_SIZE)
+	if start < 0 || start >= end {
+		return map[string]any{"address": formatAddress(uint16(max(start, 0))), "unreadableBytes": args.Count}, nil
+	}
+
+	data := make([]byte, end-start)
+	s.cpu.Exec(func() { copy(data, s.cpu.Memory[start:end]) })
+
+	return map[string]any{
+		"address":         formatAddress(uint16(start)),
+		"data":            base64.StdEncoding.EncodeToString(data),
+		"unreadableBytes": args.Count - (end - start),
+	}, nil
+}
+
+func (s *Server) writeMemory(raw json.RawMessage) (any, error) {
+	args := struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Data            string `json:"data"`
+	}{}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	base, err := s.symbols.Resolve(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(args.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	start := int(base) + args.Offset
+	if start < 0 || start+len(data) > xip8.MEMORY_SIZE {
+		return nil, errors.New("the data does not fit into memory")
+	}
+	s.cpu.Exec(func() { copy(s.cpu.Memory[start:], data) })
+
+	return map[string]any{"offset": args.Offset, "bytesWritten": len(data)}, nil
+}
+
+func (s *Server) disassemble(raw json.RawMessage) (any, error) {
+	args := struct {
+		MemoryReference   string `json:"memoryReference"`
+		Offset            int    `json:"offset"`
+		InstructionOffset int    `json:"instructionOffset"`
+		InstructionCount  int    `json:"instructionCount"`
+	}{}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	base, err := s.symbols.Resolve(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+
+	var mem xip8.Memory
+	s.cpu.Exec(func() { mem = *s.cpu.Memory })
+
+	addr := int(base) + args.Offset + 2*args.InstructionOffset
+	result := make([]disassembledInstruction, 0, args.InstructionCount)
+	for len(result) < args.InstructionCount {
+		if addr < 0 || addr+1 >= xip8.MEMORY_SIZE {
+			result = append(result, disassembledInstruction{
+				Address:     fmt.Sprintf("0x%03X", max(addr, 0)),
+				Instruction: "??",
+			})
+			addr += 2
+			continue
+		}
+
+		ins := analysis.Decode(mem[:], uint16(addr))
+		di := disassembledInstruction{
+			Address:          formatAddress(ins.Address),
+			InstructionBytes: hex.EncodeToString(mem[addr:min(addr+int(ins.Size), xip8.MEMORY_SIZE)]),
+			Instruction:      ins.Format(s.symbols),
+		}
+		if name, found := s.symbols.Label(ins.Address); found {
+			di.Symbol = name
+		}
+		if line, found := s.listing.Line(ins.Address); found {
+			di.Location = &source{Name: filepath.Base(s.listingPath), Path: s.listingPath}
+			di.Line = line
+		}
+		result = append(result, di)
+		addr = int(ins.Next())
+	}
+
+	return map[string]any{"instructions": result}, nil
+}
+
+func formatAddress(addr uint16) string {
+	return fmt.Sprintf("0x%03X", addr)
+}
+
+// samePath compares two paths after making them absolute
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+
+	return errA == nil && errB == nil && absA == absB
+}
@@ -0,0 +1,207 @@
+package dap_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/guslan/xip8/dap"
+)
+
+type response struct {
+	Type       string          `json:"type"`
+	Command    string          `json:"command"`
+	Event      string          `json:"event"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type client struct {
+	t   *testing.T
+	w   io.Writer
+	r   *bufio.Reader
+	seq int
+}
+
+func (c *client) read() response {
+	msgs := make(chan response)
+	go func() {
+		header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+		if err != nil {
+			close(msgs)
+			return
+		}
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		content := make([]byte, length)
+		io.ReadFull(c.r, content)
+
+		msg := response{}
+		json.Unmarshal(content, &msg)
+		msgs <- msg
+	}()
+
+	select {
+	case msg, ok := <-msgs:
+		if !ok {
+			c.t.Fatal("the server closed the connection")
+		}
+		return msg
+	case <-time.After(2 * time.Second):
+		c.t.Fatal("timed out waiting for a message")
+	}
+
+	return response{}
+}
+
+// send sends a request and returns its response, skipping events
+func (c *client) send(command string, args any) response {
+	c.seq++
+	content, _ := json.Marshal(map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(content), content)
+
+	for {
+		if msg := c.read(); msg.Type == "response" && msg.RequestSeq == c.seq {
+			return msg
+		}
+	}
+}
+
+// request sends a request and returns the body of its successful response
+func (c *client) request(command string, args any) json.RawMessage {
+	msg := c.send(command, args)
+	if !msg.Success {
+		c.t.Fatalf(`%s failed: %s`, command, msg.Message)
+	}
+
+	return msg.Body
+}
+
+// waitEvent skips messages until the event arrives
+func (c *client) waitEvent(event string) json.RawMessage {
+	for {
+		if msg := c.read(); msg.Type == "event" && msg.Event == event {
+			return msg.Body
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	rom := filepath.Join(dir, "test.ch8")
+	listing := filepath.Join(dir, "test.lst")
+	program := []byte{
+		0x60, 0x05, // 0x200: LD V0, 0x05
+		0x22, 0x08, // 0x202: CALL 0x208
+		0x12, 0x04, // 0x204: JP 0x204
+		0x00, 0x00,
+		0x61, 0x07, // 0x208: LD V1, 0x07
+		0x00, 0xEE, // 0x20A: RET
+	}
+	os.WriteFile(rom, program, 0o644)
+	os.WriteFile(listing, []byte("main:\n"+
+		"  0x200  6005  LD V0, 0x05\n"+
+		"  0x202  2208  CALL sub\n"+
+		"  0x204  1204  JP 0x204\n"+
+		"sub:\n"+
+		"  0x208  6107  LD V1, 0x07\n"+
+		"  0x20A  00EE  RET\n"), 0o644)
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go dap.NewServer(inR, outW).Serve()
+	c := &client{t: t, w: inW, r: bufio.NewReader(outR)}
+
+	c.request("initialize", map[string]any{"adapterID": "xip8"})
+	c.request("launch", map[string]any{"program": rom, "listing": listing, "stopOnEntry": true})
+	c.waitEvent("initialized")
+
+	body := c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": listing},
+		"breakpoints": []map[string]any{{"line": 5}},
+	})
+	bps := struct {
+		Breakpoints []struct {
+			Verified bool `json:"verified"`
+			Line     int  `json:"line"`
+		} `json:"breakpoints"`
+	}{}
+	json.Unmarshal(body, &bps)
+	if len(bps.Breakpoints) != 1 || !bps.Breakpoints[0].Verified || bps.Breakpoints[0].Line != 6 {
+		t.Fatalf(`setBreakpoints returned %s, expected a verified breakpoint at line 6`, body)
+	}
+
+	c.request("configurationDone", nil)
+	c.waitEvent("stopped")
+
+	c.request("continue", map[string]any{"threadId": 1})
+	stopped := struct {
+		Reason string `json:"reason"`
+	}{}
+	json.Unmarshal(c.waitEvent("stopped"), &stopped)
+	if stopped.Reason != "breakpoint" {
+		t.Fatalf(`stopped because of %q, expected "breakpoint"`, stopped.Reason)
+	}
+
+	trace := struct {
+		StackFrames []struct {
+			Line                        int    `json:"line"`
+			InstructionPointerReference string `json:"instructionPointerReference"`
+		} `json:"stackFrames"`
+	}{}
+	json.Unmarshal(c.request("stackTrace", map[string]any{"threadId": 1}), &trace)
+	if len(trace.StackFrames) != 2 {
+		t.Fatalf(`stackTrace returned %d frames, expected 2`, len(trace.StackFrames))
+	}
+	if f := trace.StackFrames[0]; f.InstructionPointerReference != "0x208" || f.Line != 6 {
+		t.Fatalf(`top frame at %s line %d, expected 0x208 line 6`, f.InstructionPointerReference, f.Line)
+	}
+	if f := trace.StackFrames[1]; f.InstructionPointerReference != "0x202" {
+		t.Fatalf(`caller frame at %s, expected 0x202`, f.InstructionPointerReference)
+	}
+
+	// Step out of the subroutine
+	c.request("stepOut", map[string]any{"threadId": 1})
+	c.waitEvent("stopped")
+
+	vars := struct {
+		Variables []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"variables"`
+	}{}
+	json.Unmarshal(c.request("variables", map[string]any{"variablesReference": 1}), &vars)
+	values := map[string]string{}
+	for _, v := range vars.Variables {
+		values[v.Name] = v.Value
+	}
+	if values["V0"] != "0x05" || values["V1"] != "0x07" || values["PC"] != "0x204" || values["SP"] != "0x00" {
+		t.Fatalf(`unexpected registers %v`, values)
+	}
+
+	// A PC whose instruction does not fit in the memory or an SP outside of the stack would crash the next cycle
+	for name, value := range map[string]string{"PC": "0xFFF", "SP": "17"} {
+		if msg := c.send("setVariable", map[string]any{"variablesReference": 1, "name": name, "value": value}); msg.Success {
+			t.Fatalf(`setVariable %s=%s succeeded, expected an error`, name, value)
+		}
+	}
+
+	c.request("writeMemory", map[string]any{"memoryReference": "0x300", "data": "q80="})
+	mem := struct {
+		Data string `json:"data"`
+	}{}
+	json.Unmarshal(c.request("readMemory", map[string]any{"memoryReference": "0x300", "count": 2}), &mem)
+	if mem.Data != "q80=" {
+		t.Fatalf(`readMemory returned %q, expected "q80="`, mem.Data)
+	}
+
+	c.request("disconnect", nil)
+}
@@ -0,0 +1,213 @@
+package xip8
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidFont = errors.New("invalid font")
+
+// Size of the sprites of the fonts, in bytes
+const (
+	smallGlyphSize = 5
+	bigGlyphSize   = 10
+)
+
+// Font is the sprites of the hexadecimal digits that the interpreter keeps in
+// memory, pointed to by Fx29 and Fx30
+type Font struct {
+	Name string
+	// 16 sprites of 4x5 pixels in the high nibble of 5 bytes
+	Small []byte
+	// 10 or 16 sprites of 8x10 pixels, empty when Fx30 is not supported
+	Big []byte
+}
+
+// Small fonts of the classic interpreters
+var (
+	VipFont = Font{Name: "vip", Small: []byte{
+		0xF0, 0x90, 0x90, 0x90, 0xF0, // 0
+		0x60, 0x20, 0x20, 0x20, 0x70, // 1
+		0xF0, 0x10, 0xF0, 0x80, 0xF0, // 2
+		0xF0, 0x10, 0xF0, 0x10, 0xF0, // 3
+		0xA0, 0xA0, 0xF0, 0x20, 0x20, // 4
+		0xF0, 0x80, 0xF0, 0x10, 0xF0, // 5
+		0xF0, 0x80, 0xF0, 0x90, 0xF0, // 6
+		0xF0, 0x10, 0x10, 0x10, 0x10, // 7
+		0xF0, 0x90, 0xF0, 0x90, 0xF0, // 8
+		0xF0, 0x90, 0xF0, 0x10, 0xF0, // 9
+		0xF0, 0x90, 0xF0, 0x90, 0x90, // A
+		0xF0, 0x50, 0x70, 0x50, 0xF0, // B
+		0xF0, 0x80, 0x80, 0x80, 0xF0, // C
+		0xF0, 0x50, 0x50, 0x50, 0xF0, // D
+		0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
+		0xF0, 0x80, 0xF0, 0x80, 0x80, // F
+	}}
+
+	Dream6800Font = Font{Name: "dream6800", Small: []byte{
+		0xE0, 0xA0, 0xA0, 0xA0, 0xE0, // 0
+		0x40, 0x40, 0x40, 0x40, 0x40, // 1
+		0xE0, 0x20, 0xE0, 0x80, 0xE0, // 2
+		0xE0, 0x20, 0xE0, 0x20, 0xE0, // 3
+		0x80, 0xA0, 0xA0, 0xE0, 0x20, // 4
+		0xE0, 0x80, 0xE0, 0x20, 0xE0, // 5
+		0xE0, 0x80, 0xE0, 0xA0, 0xE0, // 6
+		0xE0, 0x20, 0x20, 0x20, 0x20, // 7
+		0xE0, 0xA0, 0xE0, 0xA0, 0xE0, // 8
+		0xE0, 0xA0, 0xE0, 0x20, 0xE0, // 9
+		0xE0, 0xA0, 0xE0, 0xA0, 0xA0, // A
+		0xC0, 0xA0, 0xE0, 0xA0, 0xC0, // B
+		0xE0, 0x80, 0x80, 0x80, 0xE0, // C
+		0xC0, 0xA0, 0xA0, 0xA0, 0xC0, // D
+		0xE0, 0x80, 0xE0, 0x80, 0xE0, // E
+		0xE0, 0x80, 0xC0, 0x80, 0x80, // F
+	}}
+
+	Eti660Font = Font{Name: "eti660", Small: []byte{
+		0xE0, 0xA0, 0xA0, 0xA0, 0xE0, // 0
+		0x20, 0x20, 0x20, 0x20, 0x20, // 1
+		0xE0, 0x20, 0xE0, 0x80, 0xE0, // 2
+		0xE0, 0x20, 0xE0, 0x20, 0xE0, // 3
+		0xA0, 0xA0, 0xE0, 0x20, 0x20, // 4
+		0xE0, 0x80, 0xE0, 0x20, 0xE0, // 5
+		0xE0, 0x80, 0xE0, 0xA0, 0xE0, // 6
+		0xE0, 0x20, 0x20, 0x20, 0x20, // 7
+		0xE0, 0xA0, 0xE0, 0xA0, 0xE0, // 8
+		0xE0, 0xA0, 0xE0, 0x20, 0xE0, // 9
+		0xE0, 0xA0, 0xE0, 0xA0, 0xA0, // A
+		0x80, 0x80, 0xE0, 0xA0, 0xE0, // B
+		0xE0, 0x80, 0x80, 0x80, 0xE0, // C
+		0x20, 0x20, 0xE0, 0xA0, 0xE0, // D
+		0xE0, 0x80, 0xE0, 0x80, 0xE0, // E
+		0xE0, 0x80, 0xC0, 0x80, 0x80, // F
+	}}
+
+	Chip48Font = Font{Name: "chip48", Small: []byte{
+		0xF0, 0x90, 0x90, 0x90, 0xF0, // 0
+		0x20, 0x60, 0x20, 0x20, 0x70, // 1
+		0xF0, 0x10, 0xF0, 0x80, 0xF0, // 2
+		0xF0, 0x10, 0xF0, 0x10, 0xF0, // 3
+		0x90, 0x90, 0xF0, 0x10, 0x10, // 4
+		0xF0, 0x80, 0xF0, 0x10, 0xF0, // 5
+		0xF0, 0x80, 0xF0, 0x90, 0xF0, // 6
+		0xF0, 0x10, 0x20, 0x40, 0x40, // 7
+		0xF0, 0x90, 0xF0, 0x90, 0xF0, // 8
+		0xF0, 0x90, 0xF0, 0x10, 0xF0, // 9
+		0xF0, 0x90, 0xF0, 0x90, 0x90, // A
+		0xE0, 0x90, 0xE0, 0x90, 0xE0, // B
+		0xF0, 0x80, 0x80, 0x80, 0xF0, // C
+		0xE0, 0x90, 0x90, 0x90, 0xE0, // D
+		0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
+		0xF0, 0x80, 0xF0, 0x80, 0x80, // F
+	}}
+
+	FishNChipsFont = Font{Name: "fish", Small: []byte{
+		0x60, 0xA0, 0xA0, 0xA0, 0xC0, // 0
+		0x40, 0xC0, 0x40, 0x40, 0xE0, // 1
+		0xC0, 0x20, 0x40, 0x80, 0xE0, // 2
+		0xC0, 0x20, 0x40, 0x20, 0xC0, // 3
+		0x20, 0xA0, 0xE0, 0x20, 0x20, // 4
+		0xE0, 0x80, 0xC0, 0x20, 0xC0, // 5
+		0x40, 0x80, 0xC0, 0xA0, 0x40, // 6
+		0xE0, 0x20, 0x60, 0x40, 0x40, // 7
+		0x40, 0xA0, 0x40, 0xA0, 0x40, // 8
+		0x40, 0xA0, 0x60, 0x20, 0x40, // 9
+		0x40, 0xA0, 0xE0, 0xA0, 0xA0, // A
+		0xC0, 0xA0, 0xC0, 0xA0, 0xC0, // B
+		0x60, 0x80, 0x80, 0x80, 0x60, // C
+		0xC0, 0xA0, 0xA0, 0xA0, 0xC0, // D
+		0xE0, 0x80, 0xC0, 0x80, 0xE0, // E
+		0xE0, 0x80, 0xC0, 0x80, 0x80, // F
+	}}
+)
+
+// SchipBigFont is the 8x10 font of the digits of SCHIP 1.1
+var SchipBigFont = []byte{
+	0x3C, 0x7E, 0xE7, 0xC3, 0xC3, 0xC3, 0xC3, 0xE7, 0x7E, 0x3C, // 0
+	0x18, 0x38, 0x58, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x3C, // 1
+	0x3E, 0x7F, 0xC3, 0x06, 0x0C, 0x18, 0x30, 0x60, 0xFF, 0xFF, // 2
+	0x3C, 0x7E, 0xC3, 0x03, 0x0E, 0x0E, 0x03, 0xC3, 0x7E, 0x3C, // 3
+	0x06, 0x0E, 0x1E, 0x36, 0x66, 0xC6, 0xFF, 0xFF, 0x06, 0x06, // 4
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFC, 0xFE, 0x03, 0xC3, 0x7E, 0x3C, // 5
+	0x3E, 0x7C, 0xE0, 0xC0, 0xFC, 0xFE, 0xC3, 0xC3, 0x7E, 0x3C, // 6
+	0xFF, 0xFF, 0x03, 0x06, 0x0C, 0x18, 0x30, 0x60, 0x60, 0x60, // 7
+	0x3C, 0x7E, 0xC3, 0xC3, 0x7E, 0x7E, 0xC3, 0xC3, 0x7E, 0x3C, // 8
+	0x3C, 0x7E, 0xC3, 0xC3, 0x7F, 0x3F, 0x03, 0x03, 0x3E, 0x7C, // 9
+}
+
+// SchipFont is the font of SCHIP, the one of CHIP-48 with the big digits
+var SchipFont = Font{Name: "schip", Small: Chip48Font.Small, Big: SchipBigFont}
+
+// DefaultFont is the font loaded when no other is configured
+var DefaultFont = Chip48Font
+
+// Fonts are the fonts that can be selected by name
+var Fonts = map[string]Font{}
+
+func init() {
+	for _, f := range []Font{VipFont, Dream6800Font, Eti660Font, Chip48Font, FishNChipsFont, SchipFont} {
+		Fonts[f.Name] = f
+	}
+}
+
+// FontNames returns the names of the fonts in alphabetical order
+func FontNames() []string {
+	names := make([]string, 0, len(Fonts))
+	for name := range Fonts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ParseFont reads a font file: the 80 bytes of the small font, optionally
+// followed by the 100 or 160 bytes of the big one
+func ParseFont(data []byte) (Font, error) {
+	small := 16 * smallGlyphSize
+	switch len(data) - small {
+	case 0, 10 * bigGlyphSize, 16 * bigGlyphSize:
+	default:
+		return Font{}, fmt.Errorf("%w: %d bytes, expected %d, %d or %d", ErrInvalidFont,
+			len(data), small, small+10*bigGlyphSize, small+16*bigGlyphSize)
+	}
+
+	return Font{Small: data[:small], Big: data[small:]}, nil
+}
+
+// OpenFont returns the font with the given name or reads it from a file
+func OpenFont(nameOrPath string) (Font, error) {
+	if f, found := Fonts[strings.ToLower(nameOrPath)]; found {
+		return f, nil
+	}
+
+	data, err := os.ReadFile(nameOrPath)
+	if err != nil {
+		return Font{}, fmt.Errorf("%w: %q is not one of %s and cannot be read: %w",
+			ErrInvalidFont, nameOrPath, strings.Join(FontNames(), ", "), err)
+	}
+	f, err := ParseFont(data)
+	f.Name = nameOrPath
+
+	return f, err
+}
+
+// Size returns the bytes of memory the font takes
+func (f Font) Size() int {
+	return len(f.Small) + len(f.Big)
+}
+
+// LoadFont copies the small font and then the big one to the address
+func (mem *Memory) LoadFont(addr uint16, f Font) error {
+	if int(addr)+f.Size() > MEMORY_SIZE {
+		return fmt.Errorf("%w: it does not fit at 0x%03X", ErrInvalidFont, addr)
+	}
+
+	copy(mem[addr:], f.Small)
+	copy(mem[int(addr)+len(f.Small):], f.Big)
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package gdb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// interruptByte is sent by the client outside of a packet to stop the target
+const interruptByte = 0x03
+
+var ErrBadChecksum = errors.New("bad packet checksum")
+
+// event is either a packet or an interrupt request received from the client
+type event struct {
+	packet    string
+	interrupt bool
+	err       error
+}
+
+// checksum computes the modulo 256 sum of the packet data
+func checksum(data string) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+
+	return sum
+}
+
+// encodePacket frames the data as $data#checksum
+func encodePacket(data string) []byte {
+	return []byte(fmt.Sprintf("$%s#%02x", data, checksum(data)))
+}
+
+// readEvent reads the next packet or interrupt from r.
+// Acknowledgments sent by the client are skipped.
+func readEvent(r *bufio.Reader) event {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return event{err: err}
+		}
+
+		switch b {
+		case interruptByte:
+			return event{interrupt: true}
+		case '$':
+			data, err := r.ReadString('#')
+			if err != nil {
+				return event{err: err}
+			}
+			data = data[:len(data)-1]
+
+			sum := make([]byte, 2)
+			if _, err := io.ReadFull(r, sum); err != nil {
+				return event{err: err}
+			}
+			expected, err := strconv.ParseUint(string(sum), 16, 8)
+			if err != nil || byte(expected) != checksum(data) {
+				return event{packet: data, err: ErrBadChecksum}
+			}
+
+			return event{packet: unescape(data)}
+		}
+	}
+}
+
+// unescape removes the binary escapes (0x7d followed by the byte xor 0x20)
+func unescape(data string) string {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			out = append(out, data[i]^0x20)
+		} else {
+			out = append(out, data[i])
+		}
+	}
+
+	return string(out)
+}
@@ -0,0 +1,546 @@
+// Package gdb implements a GDB Remote Serial Protocol stub for the CPU, so
+// standard debugger frontends can inspect and control a running machine.
+package gdb
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guslan/xip8"
+)
+
+// Signals reported in the stop replies
+const (
+	sigInt  = 0x02
+	sigIll  = 0x04
+	sigTrap = 0x05
+)
+
+// Register numbers as exposed to the client.
+// V0-VF, SP, DT and ST are 8-bit, I and PC are 16-bit little endian.
+const (
+	RegV0 = iota
+	RegI  = iota + 15
+	RegPc
+	RegSp
+	RegDt
+	RegSt
+	RegCount
+)
+
+// pollInterval is how often the server checks whether the CPU stopped
+const pollInterval = time.Millisecond
+
+const targetXml = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+<feature name="org.xip8.chip8">
+<reg name="v0" bitsize="8" regnum="0"/>
+<reg name="v1" bitsize="8"/>
+<reg name="v2" bitsize="8"/>
+<reg name="v3" bitsize="8"/>
+<reg name="v4" bitsize="8"/>
+<reg name="v5" bitsize="8"/>
+<reg name="v6" bitsize="8"/>
+<reg name="v7" bitsize="8"/>
+<reg name="v8" bitsize="8"/>
+<reg name="v9" bitsize="8"/>
+<reg name="va" bitsize="8"/>
+<reg name="vb" bitsize="8"/>
+<reg name="vc" bitsize="8"/>
+<reg name="vd" bitsize="8"/>
+<reg name="ve" bitsize="8"/>
+<reg name="vf" bitsize="8"/>
+<reg name="i" bitsize="16" type="data_ptr"/>
+<reg name="pc" bitsize="16" type="code_ptr"/>
+<reg name="sp" bitsize="8"/>
+<reg name="dt" bitsize="8"/>
+<reg name="st" bitsize="8"/>
+</feature>
+</target>
+`
+
+var errKill = errors.New("killed by the client")
+
+// Server serves one GDB client at a time.
+// The CPU loop must be running in another goroutine, the server only pauses
+// and resumes it. The CPU is read and changed between cycles with Cpu.Exec.
+type Server struct {
+	cpu   *xip8.Cpu
+	noAck bool
+	// Packets received while the target was running
+	pending []event
+	// Breakpoints inserted by the client, the others are left on detach
+	inserted map[uint16]bool
+}
+
+// NewServer creates a new server for the cpu
+func NewServer(cpu *xip8.Cpu) *Server {
+	return &Server{cpu: cpu}
+}
+
+// ListenAndServe listens on the TCP address and serves the clients
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	return s.Serve(l)
+}
+
+// Serve accepts the clients of the listener one after the other
+func (s *Server) Serve(l net.Listener) error {
+	slog.Info("Waiting for GDB", "addr", l.Addr())
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		slog.Info("GDB attached", "remote", conn.RemoteAddr())
+		err = s.ServeConn(conn)
+		conn.Close()
+		slog.Info("GDB detached", "reason", err)
+	}
+}
+
+// ServeConn handles a single client. The CPU is stopped while attached.
+func (s *Server) ServeConn(conn net.Conn) error {
+	s.cpu.Pause()
+	s.noAck = false
+	s.pending = nil
+	s.inserted = map[uint16]bool{}
+
+	events := make(chan event)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(events)
+		r := bufio.NewReader(conn)
+		for {
+			ev := readEvent(r)
+			select {
+			case events <- ev:
+			case <-done:
+				return
+			}
+			if ev.err != nil && !errors.Is(ev.err, ErrBadChecksum) {
+				return
+			}
+		}
+	}()
+
+	for {
+		ev, ok := s.next(events)
+		if !ok {
+			return nil
+		}
+		if ev.interrupt {
+			// The target is already stopped
+			continue
+		}
+		if ev.err != nil {
+			if errors.Is(ev.err, ErrBadChecksum) {
+				conn.Write([]byte("-"))
+				continue
+			}
+			return ev.err
+		}
+		if !s.noAck {
+			if _, err := conn.Write([]byte("+")); err != nil {
+				return err
+			}
+		}
+
+		reply, err := s.handle(ev.packet, events)
+		if errors.Is(err, errKill) {
+			return err
+		}
+		if _, werr := conn.Write(encodePacket(reply)); werr != nil {
+			return werr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// next returns the packets received while the target was running before
+// reading new ones
+func (s *Server) next(events <-chan event) (event, bool) {
+	if len(s.pending) > 0 {
+		ev := s.pending[0]
+		s.pending = s.pending[1:]
+		return ev, true
+	}
+
+	ev, ok := <-events
+	return ev, ok
+}
+
+// handle executes a packet and returns the reply.
+// A non-nil error ends the session after sending the reply.
+func (s *Server) handle(packet string, events <-chan event) (string, error) {
+	if len(packet) == 0 {
+		return "", nil
+	}
+
+	args := packet[1:]
+	switch packet[0] {
+	case 's', 'c':
+		var err error
+		s.cpu.Exec(func() {
+			if err = s.resumeAt(args); err != nil {
+				return
+			}
+			if packet[0] == 's' {
+				s.cpu.Step()
+			} else {
+				s.cpu.Start()
+			}
+		})
+		if err != nil {
+			return "E01", nil
+		}
+		return s.wait(events), nil
+	}
+
+	// The target is stopped, but the loop keeps running the hooks
+	var reply string
+	var err error
+	s.cpu.Exec(func() {
+		reply, err = s.handleStopped(packet)
+	})
+
+	return reply, err
+}
+
+// handleStopped executes the packets that read and change the stopped target
+func (s *Server) handleStopped(packet string) (string, error) {
+	args := packet[1:]
+	switch packet[0] {
+	case '?':
+		return s.stopReply(sigTrap), nil
+	case 'g':
+		return s.readRegisters(), nil
+	case 'G':
+		return s.writeRegisters(args), nil
+	case 'p':
+		n, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || n >= RegCount {
+			return "E01", nil
+		}
+		return s.readRegister(int(n)), nil
+	case 'P':
+		num, value, ok := strings.Cut(args, "=")
+		n, err := strconv.ParseUint(num, 16, 8)
+		if !ok || err != nil || n >= RegCount {
+			return "E01", nil
+		}
+		return s.writeRegister(int(n), value), nil
+	case 'm':
+		return s.readMemory(args), nil
+	case 'M':
+		return s.writeMemory(args), nil
+	case 'Z', 'z':
+		return s.breakpoint(packet[0] == 'Z', args), nil
+	case 'b':
+		return s.reverse(args), nil
+	case 'D':
+		for addr := range s.inserted {
+			s.cpu.ClearBreakpoint(addr)
+		}
+		s.cpu.Start()
+		return "OK", errors.New("detached")
+	case 'k':
+		return "", errKill
+	case 'H':
+		return "OK", nil
+	case 'T':
+		return "OK", nil
+	case 'q':
+		return s.query(args), nil
+	case 'Q':
+		if args == "StartNoAckMode" {
+			s.noAck = true
+			return "OK", nil
+		}
+	}
+
+	return "", nil
+}
+
+// query answers the general query packets
+func (s *Server) query(args string) string {
+	switch {
+	case strings.HasPrefix(args, "Supported"):
+		return "PacketSize=1000;qXfer:features:read+;QStartNoAckMode+;swbreak+;hwbreak+;ReverseStep+;ReverseContinue+"
+	case args == "Attached":
+		return "1"
+	case args == "C":
+		return "QC1"
+	case args == "fThreadInfo":
+		return "m1"
+	case args == "sThreadInfo":
+		return "l"
+	case strings.HasPrefix(args, "Xfer:features:read:target.xml:"):
+		return xferChunk(targetXml, strings.TrimPrefix(args, "Xfer:features:read:target.xml:"))
+	}
+
+	return ""
+}
+
+// xferChunk returns the part of doc requested as offset,length
+func xferChunk(doc string, args string) string {
+	off, length, ok := strings.Cut(args, ",")
+	o, err1 := strconv.ParseUint(off, 16, 32)
+	l, err2 := strconv.ParseUint(length, 16, 32)
+	if !ok || err1 != nil || err2 != nil {
+		return "E01"
+	}
+	if int(o) >= len(doc) {
+		return "l"
+	}
+
+	end := int(o + l)
+	if end >= len(doc) {
+		return "l" + doc[o:]
+	}
+
+	return "m" + doc[o:end]
+}
+
+// stopReply formats the reply sent when the target stops
+func (s *Server) stopReply(signal int) string {
+	return fmt.Sprintf("S%02x", signal)
+}
+
+// wait blocks until the CPU pauses or the client sends an interrupt.
+// Other packets are answered after the target stops.
+func (s *Server) wait(events <-chan event) string {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok || ev.interrupt {
+				s.cpu.Pause()
+				return s.stopReply(sigInt)
+			}
+			s.pending = append(s.pending, ev)
+		case <-ticker.C:
+			var failed, running bool
+			s.cpu.Exec(func() {
+				failed, running = s.cpu.LastError() != nil, s.cpu.IsRunning()
+			})
+			if failed {
+				return s.stopReply(sigIll)
+			}
+			if !running {
+				return s.stopReply(sigTrap)
+			}
+		}
+	}
+}
+
+// reverse handles the bs and bc packets with the history of the CPU
+func (s *Server) reverse(args string) string {
+	var err error
+	switch args {
+	case "s":
+		err = s.cpu.ReverseStep()
+	case "c":
+		err = s.cpu.ReverseContinue()
+	default:
+		return ""
+	}
+
+	if errors.Is(err, xip8.ErrHistoryEmpty) {
+		return fmt.Sprintf("T%02xreplaylog:begin;", sigTrap)
+	}
+	if err != nil {
+		return "E01"
+	}
+
+	return s.stopReply(sigTrap)
+}
+
+// resumeAt moves the PC to the optional address of the s and c packets
+func (s *Server) resumeAt(args string) error {
+	if len(args) == 0 {
+		return nil
+	}
+
+	addr, err := strconv.ParseUint(args, 16, 16)
+	if err != nil {
+		return err
+	}
+	if addr+1 >= xip8.MEMORY_SIZE {
+		return fmt.Errorf("PC 0x%04X is outside of the memory", addr)
+	}
+	s.cpu.Pc = uint16(addr)
+
+	return nil
+}
+
+// breakpoint handles Z/z packets of software and hardware breakpoints
+func (s *Server) breakpoint(insert bool, args string) string {
+	parts := strings.Split(args, ",")
+	if len(parts) < 2 || (parts[0] != "0" && parts[0] != "1") {
+		return ""
+	}
+
+	addr, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return "E01"
+	}
+
+	// The breakpoints set before the client attached are kept
+	if insert && !s.cpu.HasBreakpoint(uint16(addr)) {
+		s.cpu.SetBreakpoint(uint16(addr))
+		s.inserted[uint16(addr)] = true
+	} else if !insert && s.inserted[uint16(addr)] {
+		s.cpu.ClearBreakpoint(uint16(addr))
+		delete(s.inserted, uint16(addr))
+	}
+
+	return "OK"
+}
+
+// registerBytes returns the encoding of a register
+func (s *Server) registerBytes(n int) []byte {
+	switch {
+	case n < RegI:
+		return []byte{s.cpu.V[n-RegV0]}
+	case n == RegI:
+		return []byte{byte(s.cpu.I), byte(s.cpu.I >> 8)}
+	case n == RegPc:
+		return []byte{byte(s.cpu.Pc), byte(s.cpu.Pc >> 8)}
+	case n == RegSp:
+		return []byte{s.cpu.Sp}
+	case n == RegDt:
+		return []byte{s.cpu.Dt}
+	default:
+		return []byte{s.cpu.St}
+	}
+}
+
+// setRegister decodes the bytes of a register.
+// It returns the number of bytes used, or 0 when the value is invalid: a PC
+// whose instruction does not fit in the memory or an SP outside of the stack.
+func (s *Server) setRegister(n int, b []byte) int {
+	size := len(s.registerBytes(n))
+	if len(b) < size {
+		return 0
+	}
+
+	switch {
+	case n < RegI:
+		s.cpu.V[n-RegV0] = b[0]
+	case n == RegI:
+		s.cpu.I = uint16(b[0]) | uint16(b[1])<<8
+	case n == RegPc:
+		pc := uint16(b[0]) | uint16(b[1])<<8
+		if int(pc)+1 >= xip8.MEMORY_SIZE {
+			return 0
+		}
+		s.cpu.Pc = pc
+	case n == RegSp:
+		if int(b[0]) > len(s.cpu.Stack) {
+			return 0
+		}
+		s.cpu.Sp = b[0]
+	case n == RegDt:
+		s.cpu.Dt = b[0]
+	default:
+		s.cpu.St = b[0]
+	}
+
+	return size
+}
+
+func (s *Server) readRegisters() string {
+	var sb strings.Builder
+	for n := 0; n < RegCount; n++ {
+		sb.WriteString(hex.EncodeToString(s.registerBytes(n)))
+	}
+
+	return sb.String()
+}
+
+func (s *Server) writeRegisters(args string) string {
+	b, err := hex.DecodeString(args)
+	if err != nil {
+		return "E01"
+	}
+
+	for n := 0; n < RegCount && len(b) > 0; n++ {
+		used := s.setRegister(n, b)
+		if used == 0 {
+			return "E01"
+		}
+		b = b[used:]
+	}
+
+	return "OK"
+}
+
+func (s *Server) readRegister(n int) string {
+	return hex.EncodeToString(s.registerBytes(n))
+}
+
+func (s *Server) writeRegister(n int, value string) string {
+	b, err := hex.DecodeString(value)
+	if err != nil || s.setRegister(n, b) == 0 {
+		return "E01"
+	}
+
+	return "OK"
+}
+
+// memoryRange parses the addr,length arguments of the memory packets
+func memoryRange(args string) (int, int, bool) {
+	a, l, ok := strings.Cut(args, ",")
+	addr, err1 := strconv.ParseUint(a, 16, 32)
+	length, err2 := strconv.ParseUint(l, 16, 32)
+	if !ok || err1 != nil || err2 != nil || addr+length > xip8.MEMORY_SIZE {
+		return 0, 0, false
+	}
+
+	return int(addr), int(length), true
+}
+
+func (s *Server) readMemory(args string) string {
+	addr, length, ok := memoryRange(args)
+	if !ok {
+		return "E01"
+	}
+
+	return hex.EncodeToString(s.cpu.Memory[addr : addr+length])
+}
+
+func (s *Server) writeMemory(args string) string {
+	r, data, found := strings.Cut(args, ":")
+	addr, length, ok := memoryRange(r)
+	if !found || !ok {
+		return "E01"
+	}
+
+	b, err := hex.DecodeString(data)
+	if err != nil || len(b) != length {
+		return "E01"
+	}
+	copy(s.cpu.Memory[addr:], b)
+
+	return "OK"
+}
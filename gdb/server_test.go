@@ -0,0 +1,183 @@
+package gdb_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/gdb"
+)
+
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// send writes a packet and returns the data of its reply
+func (c *client) send(data string) string {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	c.conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := fmt.Fprintf(c.conn, "$%s#%02x", data, sum); err != nil {
+		c.t.Fatalf(`writing %q: %v`, data, err)
+	}
+
+	return c.receive(data)
+}
+
+// receive returns the data of the next reply, the one of the packet data
+func (c *client) receive(data string) string {
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			c.t.Fatalf(`reading reply of %q: %v`, data, err)
+		}
+		if b != '$' {
+			continue
+		}
+
+		reply, err := c.r.ReadString('#')
+		if err != nil {
+			c.t.Fatalf(`reading reply of %q: %v`, data, err)
+		}
+		if _, err := io.ReadFull(c.r, make([]byte, 2)); err != nil {
+			c.t.Fatalf(`reading checksum of %q: %v`, data, err)
+		}
+
+		return strings.TrimSuffix(reply, "#")
+	}
+}
+
+func (c *client) expect(data, expected string) {
+	if reply := c.send(data); reply != expected {
+		c.t.Fatalf(`%q replied %q, expected %q`, data, reply, expected)
+	}
+}
+
+func TestServer(t *testing.T) {
+	cpu := xip8.NewCpu(func(config *xip8.CpuConfig) {
+		config.CyclesPerFrame = 1
+	})
+	program := []byte{
+		0x60, 0x05, // 0x200: LD V0, 0x05
+		0x61, 0x07, // 0x202: LD V1, 0x07
+		0xA3, 0x00, // 0x204: LD I, 0x300
+		0x80, 0x14, // 0x206: ADD V0, V1
+		0x12, 0x08, // 0x208: JP 0x208
+	}
+	if err := cpu.LoadProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.Boot(); err != nil {
+		t.Fatal(err)
+	}
+	cpu.Stop()
+	go cpu.Loop()
+
+	// The loop runs in another goroutine
+	running := func() (running bool) {
+		cpu.Exec(func() { running = cpu.IsRunning() })
+		return running
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// Set with -break before the client attached
+	cpu.SetBreakpoint(0x300)
+	go gdb.NewServer(cpu).Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+
+	c.expect("?", "S05")
+	c.expect("p11", "0002")
+
+	c.expect("s", "S05")
+	c.expect("p0", "05")
+
+	c.expect("Z0,206,2", "OK")
+	c.expect("c", "S05")
+	c.expect("p11", "0602")
+	c.expect("p10", "0003")
+
+	c.expect("P0=10", "OK")
+	c.expect("s", "S05")
+	c.expect("p0", "17")
+	c.expect("g", "1707"+strings.Repeat("00", 14)+"0003"+"0802"+"000000")
+
+	// A PC whose instruction does not fit in the memory or an SP outside of the stack would crash the next cycle
+	c.expect("P11=ff0f", "E01")
+	c.expect("P12=11", "E01")
+	c.expect("P12=10", "OK")
+	c.expect("P12=00", "OK")
+	c.expect("sfff", "E01")
+	c.expect("p11", "0802")
+
+	c.expect("M300,2:abcd", "OK")
+	c.expect("m2fe,4", "0000abcd")
+	cpu.Exec(func() {
+		if cpu.Memory[0x301] != 0xCD {
+			t.Fatalf(`Memory[0x301] = %x, expected cd`, cpu.Memory[0x301])
+		}
+	})
+
+	// The program loops forever, so continue only stops on an interrupt.
+	// Packets sent while it runs are answered after it stops.
+	c.expect("z0,206,2", "OK")
+	if _, err := fmt.Fprintf(conn, "$c#63"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if !running() {
+		t.Fatalf(`cpu should be running after continue`)
+	}
+	if _, err := fmt.Fprintf(conn, "$p0#a0"); err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte{0x03})
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b == '$' {
+			break
+		}
+	}
+	if reply, _ := c.r.ReadString('#'); reply != "S02#" {
+		t.Fatalf(`interrupt replied %q, expected "S02"`, reply)
+	}
+	c.r.Discard(2)
+	if running() {
+		t.Fatalf(`cpu should be stopped after the interrupt`)
+	}
+	if reply := c.receive("p0"); reply != "17" {
+		t.Fatalf(`"p0" sent while running replied %q, expected "17"`, reply)
+	}
+	c.expect("p1", "07")
+
+	// Detaching only removes the breakpoints of the client
+	c.expect("Z0,300,2", "OK")
+	c.expect("z0,300,2", "OK")
+	c.expect("Z0,204,2", "OK")
+	c.expect("D", "OK")
+	if !cpu.HasBreakpoint(0x300) || cpu.HasBreakpoint(0x204) {
+		t.Fatalf(`after detaching the breakpoints at 0x300 and 0x204 are %v and %v, expected only the one set before attaching`,
+			cpu.HasBreakpoint(0x300), cpu.HasBreakpoint(0x204))
+	}
+}
@@ -3,13 +3,22 @@ package gui
 import (
 	"fmt"
 	"log/slog"
-	"os"
+	"path/filepath"
 	"strings"
 
 	gui "github.com/gen2brain/raylib-go/raygui"
 	rl "github.com/gen2brain/raylib-go/raylib"
 	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/analysis"
+	"github.com/guslan/xip8/cheats"
+	"github.com/guslan/xip8/crash"
+	"github.com/guslan/xip8/heatmap"
+	"github.com/guslan/xip8/loader"
+	"github.com/guslan/xip8/patch"
 	"github.com/guslan/xip8/resources"
+	"github.com/guslan/xip8/romdb"
+	"github.com/guslan/xip8/sprites"
+	"github.com/guslan/xip8/symbols"
 )
 
 const (
@@ -57,18 +66,47 @@ type App struct {
 	// Unpacked screen representation
 	screen     []byte
 	pixelScale int32
+	// Horizontal offset that centers the screen
+	screenOffsetX int32
+	// Clockwise rotation of the screen in degrees
+	screenRotation int
+	bgColor        rl.Color
+	pixelColor     rl.Color
 
 	keyboardLayout    xip8.KeyboardLayout
 	keyboardLookupMap map[ScanCode]byte
+	// Game actions (up, down, ...) mapped to keypad keys by the ROM database
+	gameKeys map[string]byte
+
+	romDb *romdb.Database
+	// Settings of the console restored before loading a program
+	defaults romdb.Settings
+	// Font chosen by the user instead of the ones of the platforms
+	font xip8.Font
 
 	useDebugger bool
+	// Labels shown by the debugger
+	symbols *symbols.Table
+	// Memory accesses shown by the debugger
+	heatmap *heatmap.Heatmap
 
 	loadedProgramPath string
+	// SHA-1 of the loaded program
+	romHash string
+
+	// Directory of the crash dumps, empty to disable them
+	crashDir string
+	recorder *crash.Recorder
+
+	// Cheats of the loaded program and the file read after the ones of its hash
+	cheats     *cheats.Engine
+	cheatsPath string
+	showCheats bool
 
 	// Window width and height
 	winW, winH int
 
-	loadBtn, startBtn, stopBtn, stepBtn, restBtn bool
+	loadBtn, startBtn, stopBtn, stepBtn, restBtn, cheatsBtn bool
 
 	lastMessage      string
 	lastMessageColor rl.Color
@@ -88,6 +126,22 @@ type AppConfig struct {
 	Speed          uint
 	UseDebugger    bool
 	CyclesPerFrame uint
+	// Database used to configure the programs when they are loaded
+	RomDatabase *romdb.Database
+	// Labels shown by the debugger
+	Symbols *symbols.Table
+	// Addresses the console stops at
+	Breakpoints []uint16
+	// Directory where a crash dump is written when the program fails.
+	// Defaults to "" (no dumps)
+	CrashDir string
+	// Cheat file loaded with the cheats of every program found by its hash.
+	// Defaults to "" (only the cheats of the hash)
+	CheatsPath string
+	// Font of the digits. Defaults to the one of the platform of every program
+	Font xip8.Font
+	// Address where the font is loaded. Defaults to 0x000
+	FontAddress uint16
 }
 type AppConfigCb func(config *AppConfig)
 
@@ -107,21 +161,53 @@ func NewApp(configs ...AppConfigCb) *App {
 		speedFactor:       hzToSpeedFactor(config.Speed),
 		keyboardLayout:    xip8.DefaultKeyboardLayout,
 		keyboardLookupMap: map[ScanCode]byte{},
+		bgColor:           ScreenBgColor,
+		pixelColor:        ScreenPixelColor,
+		romDb:             config.RomDatabase,
 		useDebugger:       config.UseDebugger,
+		symbols:           config.Symbols,
+		crashDir:          config.CrashDir,
+		cheats:            cheats.NewEngine(),
+		cheatsPath:        config.CheatsPath,
+		font:              config.Font,
 	}
 
-	app.Cpu = xip8.NewCpu(func(config *xip8.CpuConfig) {
-		config.Display = app
-		config.Keyboard = app
-		config.Buzzer = app
+	app.Cpu = xip8.NewCpu(func(cpuConfig *xip8.CpuConfig) {
+		cpuConfig.Display = app
+		cpuConfig.Keyboard = app
+		cpuConfig.Buzzer = app
+		cpuConfig.FontAddress = config.FontAddress
+		if len(config.Font.Small) > 0 {
+			cpuConfig.Font = config.Font
+		}
 	})
+	app.defaults = romdb.Settings{
+		Quirks:         app.Cpu.Quirks(),
+		TickRate:       app.Cpu.CyclesPerFrame,
+		ScreenSettings: app.Cpu.ScreenSettings,
+		Layout:         app.Cpu.Layout,
+		Font:           app.Cpu.Font,
+	}
 	app.screen = make([]byte, app.Cpu.ScreenSettings.Width*app.Cpu.ScreenSettings.Height)
+	for _, addr := range config.Breakpoints {
+		app.Cpu.SetBreakpoint(addr)
+	}
+	app.cheats.Attach(app.Cpu)
+	if len(app.crashDir) > 0 {
+		app.recorder = crash.NewRecorder(crash.DefaultInstructions)
+		app.recorder.Attach(app.Cpu)
+	}
+	app.Cpu.AddBreakpointHook(func(cpu *xip8.Cpu) {
+		app.showMessage(fmt.Sprintf("Breakpoint at %s", app.symbols.Format(cpu.Pc)), MessageWarning)
+	})
 
 	app.updateKeyboardLookupMap()
 	app.updateWindowSize()
 
 	if app.useDebugger {
 		slog.Info("Using debugger")
+		app.heatmap = heatmap.New(heatmap.DefaultWindow)
+		app.heatmap.Attach(app.Cpu)
 	}
 
 	return app
@@ -136,8 +222,12 @@ func (app *App) Run(autostart bool) {
 			cpu.Stop()
 		}
 		if err := cpu.Loop(); err != nil {
-			app.showMessage(err.Error(), MessageError)
 			slog.Error("Error booting CPU", slog.Any("error", err))
+			if path, written := app.writeCrashDump(err); written {
+				app.showMessage(fmt.Sprintf("%s (crash dump written to %s)", err, path), MessageError)
+			} else {
+				app.showMessage(err.Error(), MessageError)
+			}
 		}
 	}(app.Cpu, autostart)
 
@@ -166,25 +256,71 @@ func (app *App) Run(autostart bool) {
 	}
 }
 
-func (app *App) Load(path string) {
-	program, err := os.ReadFile(path)
+// Load loads the program in path with the IPS or BPS patches applied in order
+func (app *App) Load(path string, patches ...string) {
+	rom, err := loader.Open(path)
 	if err != nil {
 		slog.Error("Error loading program", slog.String("path", path), slog.Any("error", err))
 		return
 	}
 
-	if err := app.Cpu.LoadProgram(program); err != nil {
+	patched, err := patch.ApplyFiles(rom.Data, patches...)
+	if err != nil {
+		slog.Error("Error patching program", slog.String("path", path), slog.Any("error", err))
+		app.showMessage(err.Error(), MessageError)
+		return
+	}
+
+	// The settings of a patched program are the ones of the original
+	info := app.applyRomSettings(rom)
+	program := patched
+
+	cartridge := xip8.NewCartridge(filepath.Base(path), program)
+	cartridge.Metadata["format"] = string(rom.Format)
+	cartridge.Metadata["info"] = info
+	list, err := cheats.Open(cartridge.Hash, app.cheatsPath)
+	if err != nil {
+		slog.Error("Error loading the cheats", slog.String("path", path), slog.Any("error", err))
+		app.showMessage(err.Error(), MessageError)
+		return
+	}
+
+	if err := app.Cpu.LoadCartridge(cartridge); err != nil {
 		slog.Error("Error loading program", slog.String("path", path), slog.Any("error", err))
 		return
 	}
+	app.cheats.Load(list)
+	if len(list) > 0 {
+		info = fmt.Sprintf("%s, %d cheats", info, len(list))
+	}
+	app.updateWindowSize()
 
 	app.loadedProgramPath = path
+	app.romHash = cartridge.Hash
 	slog.Info("Program loaded", slog.String("path", path))
-	app.showMessage(fmt.Sprintf("Program '%s' loaded", app.loadedProgramPath), MessageInfo)
+	app.showMessage(fmt.Sprintf("Program '%s' loaded (%s)", app.loadedProgramPath, info), MessageInfo)
 
 	app.Cpu.Start()
 }
 
+// writeCrashDump saves the state of the console after err stopped it
+func (app *App) writeCrashDump(err error) (string, bool) {
+	if app.recorder == nil {
+		return "", false
+	}
+
+	dump := crash.New(app.Cpu, err, app.recorder)
+	dump.RomHash = app.romHash
+	path, err := dump.WriteFile(app.crashDir, app.symbols)
+	if err != nil {
+		slog.Error("Error writing the crash dump", slog.Any("error", err))
+		return "", false
+	}
+	slog.Info("Crash dump written", slog.String("path", path))
+
+	return path, true
+}
+
 // Play implements xip8.Buzzer.
 func (app *App) Play() {
 }
@@ -193,14 +329,59 @@ func (app *App) Play() {
 func (app *App) Stop() {
 }
 
+// applyRomSettings configures the console and the UI with the settings of Octo
+// cartridges or the ones found in the ROM database, falling back to the
+// defaults for unknown programs. It returns a description of the program.
+func (app *App) applyRomSettings(rom loader.Rom) string {
+	app.bgColor = ScreenBgColor
+	app.pixelColor = ScreenPixelColor
+	app.screenRotation = 0
+	app.gameKeys = nil
+	app.defaults.Apply(app.Cpu)
+	app.updateKeyboardLookupMap()
+
+	if app.romDb == nil && rom.Settings == nil {
+		return "no ROM database"
+	}
+
+	settings, found := rom.Lookup(app.romDb)
+	if !found {
+		d := app.romDb.Detect(rom.Data)
+		slog.Info("Program not found in the ROM database", slog.String("detected", d.Platform), slog.Float64("confidence", d.Confidence))
+		return fmt.Sprintf("looks like %s, %.0f%% confidence", app.romDb.PlatformName(d.Platform), d.Confidence*100)
+	}
+	slog.Info("Program found in the ROM database", slog.String("title", settings.Title), slog.String("platform", settings.Platform))
+
+	settings.Apply(app.Cpu)
+	if len(app.font.Small) > 0 {
+		app.Cpu.Font = app.font
+	}
+	if c, ok := settings.Colors.Pixel(0); ok {
+		app.bgColor = rl.Color(c)
+	}
+	if c, ok := settings.Colors.Pixel(1); ok {
+		app.pixelColor = rl.Color(c)
+	}
+	app.screenRotation = settings.ScreenRotation
+	app.gameKeys = settings.Keys
+	app.updateKeyboardLookupMap()
+
+	if rom.Settings != nil {
+		return "Octo cartridge"
+	}
+	return fmt.Sprintf("%s, %s", settings.Title, app.romDb.PlatformName(settings.Platform))
+}
+
 func (app *App) updateWindowSize() {
 	app.winW = ScreenWidth
 	app.winH = ScreenHeight + ToolbarHeight + MessageBarHeigh
-	if app.Cpu.ScreenSettings.Width == xip8.SmallScreen.Width {
-		app.pixelScale = ScreenPixelSizeLarge
-	} else {
-		app.pixelScale = ScreenPixelSizeSmall
+
+	w, h := app.Cpu.ScreenSettings.Width, app.Cpu.ScreenSettings.Height
+	if app.screenRotation == 90 || app.screenRotation == 270 {
+		w, h = h, w
 	}
+	app.pixelScale = int32(min(ScreenWidth/w, ScreenHeight/h))
+	app.screenOffsetX = (ScreenWidth - int32(w)*app.pixelScale) / 2
 
 	if app.useDebugger {
 		app.winH += 2*DebuggerRegisterMargin + 8*DebuggerRegisterHeight
@@ -210,10 +391,15 @@ func (app *App) updateWindowSize() {
 
 func (app *App) updateKeyboardLookupMap() {
 	runeToConsoleKey := xip8.LookupMap(app.keyboardLayout)
-	// app.keyboardMap = map[ScanCode]byte{}
+	app.keyboardLookupMap = map[ScanCode]byte{}
 	for r, k := range runeToConsoleKey {
 		app.keyboardLookupMap[runeToKey[r]] = k
 	}
+	for action, k := range app.gameKeys {
+		if scanCode, found := gameActionToKey[action]; found {
+			app.keyboardLookupMap[scanCode] = k
+		}
+	}
 }
 
 func (app *App) loadStyles() {
@@ -251,24 +437,40 @@ func (app *App) handleActions() {
 		slog.Info("Stopping the console")
 	}
 	if app.restBtn {
-		app.Cpu.Reset()
-		slog.Info("Resetting the program to the beginning")
+		// Shift keeps the memory, in case the program saves something in it
+		if rl.IsKeyDown(rl.KeyLeftShift) || rl.IsKeyDown(rl.KeyRightShift) {
+			app.Cpu.Exec(app.Cpu.SoftReset)
+			slog.Info("Resetting the registers")
+		} else {
+			var err error
+			app.Cpu.Exec(func() { err = app.Cpu.HardReset() })
+			if err != nil {
+				slog.Error("Error resetting the program", slog.Any("error", err))
+				app.showMessage(err.Error(), MessageError)
+			} else {
+				slog.Info("Resetting the program to the beginning")
+			}
+		}
 	}
 	if app.stepBtn {
 		app.Cpu.LoopOnce()
 		slog.Info("Running a single frame")
 	}
+	if app.cheatsBtn {
+		app.showCheats = !app.showCheats
+	}
 }
 
 func (app *App) handleKeyPress() {
+	// Several scan codes can map to the same key, so the state is built from scratch
+	var state uint16
 	for scanCode, key := range app.keyboardLookupMap {
 		if rl.IsKeyDown(scanCode) {
-			app.InMemoryKeyboard.State |= (0b1000000000000000 >> key)
+			state |= (0b1000000000000000 >> key)
 			// fmt.Printf("keyboard pressed %016b\n", app.InMemoryKeyboard.State)
-		} else {
-			app.InMemoryKeyboard.State &= ^(0b1000000000000000 >> key)
 		}
 	}
+	app.InMemoryKeyboard.State = state
 }
 
 func (app *App) updateCpuSpeed() {
@@ -332,6 +534,11 @@ func (app *App) drawToolbar() {
 		)
 	}
 
+	app.cheatsBtn = gui.Button(
+		rl.NewRectangle(ToolbarGap+ToolbarBtnOffset*5, ToolbarGap, ToolbarBtnWidth, ToolbarBtnHeight),
+		gui.IconText(gui.ICON_STAR, "Cheats"),
+	)
+
 	gui.Label(
 		rl.NewRectangle(float32(app.winW)-ToolbarGap-150, 26, 50, 20),
 		fmt.Sprintf("%d Hz", speedFactorToHz(app.speedFactor)),
@@ -352,29 +559,80 @@ func (app *App) drawToolbar() {
 		maxSpeed,
 	)
 
+	app.drawCheats()
+}
+
+const (
+	CheatsPanelPosX       = ToolbarGap + ToolbarBtnOffset*5
+	CheatsPanelPosY       = ToolbarHeight + ToolbarGap
+	CheatsPanelWidth      = 300
+	CheatsPanelRowHeight  = 24
+	CheatsPanelCheckboxSz = 16
+)
+
+// drawCheats draws the cheats of the program under the toolbar, where they can be turned on and off
+func (app *App) drawCheats() {
+	if !app.showCheats {
+		return
+	}
+
+	list := app.cheats.Cheats()
+	gui.Panel(rl.NewRectangle(CheatsPanelPosX, CheatsPanelPosY, CheatsPanelWidth, float32(max(len(list), 1)+1)*CheatsPanelRowHeight+ToolbarGap), "Cheats")
+	if len(list) == 0 {
+		gui.Label(rl.NewRectangle(CheatsPanelPosX+ToolbarGap, CheatsPanelPosY+CheatsPanelRowHeight, CheatsPanelWidth, CheatsPanelRowHeight), "No cheats for this program")
+		return
+	}
+
+	for i, c := range list {
+		enabled := gui.CheckBox(
+			rl.NewRectangle(CheatsPanelPosX+ToolbarGap, CheatsPanelPosY+float32(i+1)*CheatsPanelRowHeight+(CheatsPanelRowHeight-CheatsPanelCheckboxSz)/2, CheatsPanelCheckboxSz, CheatsPanelCheckboxSz),
+			c.Name,
+			c.Enabled,
+		)
+		if enabled != c.Enabled {
+			app.cheats.SetEnabled(i, enabled)
+			slog.Info("Toggling cheat", slog.String("name", c.Name), slog.Bool("enabled", enabled))
+		}
+	}
 }
 
 var t int
 
 func (app *App) drawScreen() {
-	for y := 0; y < app.Cpu.ScreenSettings.Height; y++ {
-		for x := 0; x < app.Cpu.ScreenSettings.Width; x++ {
-			t = y*app.Cpu.ScreenSettings.Width + x
+	w, h := app.Cpu.ScreenSettings.Width, app.Cpu.ScreenSettings.Height
+	if len(app.screen) < w*h {
+		return
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			t = y*w + x
+
+			// Position after the rotation
+			rx, ry := x, y
+			switch app.screenRotation {
+			case 90:
+				rx, ry = h-1-y, x
+			case 180:
+				rx, ry = w-1-x, h-1-y
+			case 270:
+				rx, ry = y, w-1-x
+			}
 
 			if app.screen[t] > 0 {
 				rl.DrawRectangle(
-					ScreenPositionX+app.pixelScale*int32(x),
-					ScreenPositionY+app.pixelScale*int32(y),
+					ScreenPositionX+app.screenOffsetX+app.pixelScale*int32(rx),
+					ScreenPositionY+app.pixelScale*int32(ry),
 					app.pixelScale,
 					app.pixelScale,
-					ScreenPixelColor)
+					app.pixelColor)
 			} else {
 				rl.DrawRectangle(
-					ScreenPositionX+app.pixelScale*int32(x),
-					ScreenPositionY+app.pixelScale*int32(y),
+					ScreenPositionX+app.screenOffsetX+app.pixelScale*int32(rx),
+					ScreenPositionY+app.pixelScale*int32(ry),
 					app.pixelScale,
 					app.pixelScale,
-					ScreenBgColor)
+					app.bgColor)
 			}
 		}
 	}
@@ -402,6 +660,17 @@ const (
 
 	DebuggerRegisterCol5PosX = DebuggerRegisterCol4PosX + 2*DebuggerRegisterWidth + DebuggerRegisterColGap
 	DebuggerRegisterCol5PosY = DebuggerRegisterPosY + DebuggerRegisterMargin
+
+	DebuggerHeatmapPosX    = DebuggerRegisterCol5PosX + 2*DebuggerRegisterWidth + DebuggerRegisterColGap
+	DebuggerHeatmapPosY    = DebuggerRegisterPosY + DebuggerRegisterMargin
+	DebuggerHeatmapColumns = 128
+	DebuggerHeatmapCell    = 2
+
+	DebuggerSpritesPosX    = DebuggerHeatmapPosX + DebuggerHeatmapColumns*DebuggerHeatmapCell + DebuggerRegisterColGap
+	DebuggerSpritesPosY    = DebuggerRegisterPosY + DebuggerRegisterMargin
+	DebuggerSpritesCount   = 24
+	DebuggerSpritesColumns = 6
+	DebuggerSpritesScale   = 3
 )
 
 func (app *App) drawDebugger() {
@@ -442,6 +711,15 @@ func (app *App) drawDebugger() {
 		DebuggerRegisterCol3PosX, DebuggerRegisterCol3PosY+DebuggerRegisterHeight*3,
 		DebuggerRegisterWidth, DebuggerRegisterHeight),
 		fmt.Sprintf("DT 0x%02X", app.Cpu.Dt))
+
+	gui.Label(rl.NewRectangle(
+		DebuggerRegisterCol3PosX, DebuggerRegisterCol3PosY+DebuggerRegisterHeight*4,
+		DebuggerRegisterWidth*2, DebuggerRegisterHeight),
+		app.symbols.Format(app.Cpu.Pc))
+	gui.Label(rl.NewRectangle(
+		DebuggerRegisterCol3PosX, DebuggerRegisterCol3PosY+DebuggerRegisterHeight*5,
+		DebuggerRegisterWidth*2, DebuggerRegisterHeight),
+		analysis.Decode(app.Cpu.Memory[:], app.Cpu.Pc).Format(app.symbols))
 	gui.Label(rl.NewRectangle(
 		DebuggerRegisterCol3PosX+DebuggerRegisterMargin+DebuggerRegisterWidth, DebuggerRegisterCol3PosY+DebuggerRegisterHeight*3,
 		DebuggerRegisterWidth, DebuggerRegisterHeight),
@@ -460,6 +738,54 @@ func (app *App) drawDebugger() {
 			DebuggerRegisterWidth*2, DebuggerRegisterHeight),
 			fmt.Sprintf("S[%X] 0x%04X", i+8, si))
 	}
+
+	app.drawHeatmap()
+	app.drawSprites()
+}
+
+// drawSprites draws the memory from I as 8x8 sprites, highlighting what the next draw reads
+func (app *App) drawSprites() {
+	sheet := sprites.Sheet{
+		Start:   app.Cpu.I,
+		Count:   DebuggerSpritesCount,
+		Height:  8,
+		Columns: DebuggerSpritesColumns,
+	}
+	sheet.HighlightIndex(app.Cpu)
+
+	img := sheet.Render(app.Cpu.Memory[:])
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			rl.DrawRectangle(
+				DebuggerSpritesPosX+int32(x)*DebuggerSpritesScale,
+				DebuggerSpritesPosY+int32(y)*DebuggerSpritesScale,
+				DebuggerSpritesScale,
+				DebuggerSpritesScale,
+				rl.Color(img.RGBAAt(x, y)))
+		}
+	}
+}
+
+// drawHeatmap draws the memory accesses with DebuggerHeatmapColumns addresses per row
+func (app *App) drawHeatmap() {
+	counts := app.heatmap.Counts()
+	rows := int32((len(counts) + DebuggerHeatmapColumns - 1) / DebuggerHeatmapColumns)
+	rl.DrawRectangle(DebuggerHeatmapPosX, DebuggerHeatmapPosY, DebuggerHeatmapColumns*DebuggerHeatmapCell, rows*DebuggerHeatmapCell, rl.Black)
+
+	peak := heatmap.Peak(counts)
+	for addr, c := range counts {
+		if c == (heatmap.Counts{}) {
+			continue
+		}
+
+		rl.DrawRectangle(
+			DebuggerHeatmapPosX+int32(addr%DebuggerHeatmapColumns)*DebuggerHeatmapCell,
+			DebuggerHeatmapPosY+int32(addr/DebuggerHeatmapColumns)*DebuggerHeatmapCell,
+			DebuggerHeatmapCell,
+			DebuggerHeatmapCell,
+			rl.Color(heatmap.Color(c, peak)))
+	}
 }
 
 func (app *App) showMessage(msg string, mType MessageType) {
@@ -16,9 +16,9 @@ func (app *App) Boot() error {
 
 // Render implements xip8.Display.
 func (app *App) Render(screen xip8.Screen, settings xip8.ScreenSettings) error {
-	// if len(app.screen) < len(screen) {
-	// 	app.screen = make(xip8.Screen, settings.Width*settings.Height)
-	// }
+	if len(app.screen) != settings.Width*settings.Height {
+		app.screen = make(xip8.Screen, settings.Width*settings.Height)
+	}
 
 	for i, t := 0, 0; t < settings.Width*settings.Height; i, t = i+1, t+8 {
 		app.screen[t+0] = (screen[i] >> 7) & 0b1
@@ -72,3 +72,13 @@ var runeToKey = map[rune]ScanCode{
 	'Y': rl.KeyY,
 	'Z': rl.KeyZ,
 }
+
+// gameActionToKey maps the game actions of the ROM database to the keyboard
+var gameActionToKey = map[string]ScanCode{
+	"up":    rl.KeyUp,
+	"down":  rl.KeyDown,
+	"left":  rl.KeyLeft,
+	"right": rl.KeyRight,
+	"a":     rl.KeySpace,
+	"b":     rl.KeyEnter,
+}
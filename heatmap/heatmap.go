@@ -0,0 +1,197 @@
+// Package heatmap counts the reads, writes and executions of every address of
+// the memory over a time window and draws them as an image.
+package heatmap
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/analysis"
+)
+
+// DefaultWindow is one second of cycles at the default cycles per frame
+const DefaultWindow = 60 * xip8.DefaultCyclesPerFrame
+
+// Number of buckets the window is split in. The counts leave the window a bucket at a time.
+const buckets = 10
+
+// Layout of the image: addresses per row and size of every address in pixels
+const (
+	DefaultColumns = 64
+	DefaultScale   = 8
+)
+
+// Counts are the accesses to an address
+type Counts struct {
+	Reads    uint32
+	Writes   uint32
+	Executes uint32
+}
+
+func (c *Counts) add(o Counts) {
+	c.Reads += o.Reads
+	c.Writes += o.Writes
+	c.Executes += o.Executes
+}
+
+func (c *Counts) sub(o Counts) {
+	c.Reads -= o.Reads
+	c.Writes -= o.Writes
+	c.Executes -= o.Executes
+}
+
+// Heatmap counts the accesses of the last cycles. It is safe to read the
+// counts while the CPU runs in another goroutine.
+type Heatmap struct {
+	mu sync.Mutex
+
+	// Cycles covered by every bucket, 0 to count since the start
+	bucketSize uint
+	bucket     uint
+	// Counts of every bucket, the current one is at next
+	buckets [][]Counts
+	next    int
+	total   []Counts
+}
+
+// New creates a heatmap of the last window cycles, or of every cycle if window is 0
+func New(window uint) *Heatmap {
+	h := &Heatmap{
+		bucketSize: window / buckets,
+		total:      make([]Counts, xip8.MEMORY_SIZE),
+	}
+	if window > 0 {
+		h.bucketSize = max(h.bucketSize, 1)
+		h.buckets = make([][]Counts, buckets)
+		for i := range h.buckets {
+			h.buckets[i] = make([]Counts, xip8.MEMORY_SIZE)
+		}
+	}
+
+	return h
+}
+
+// Attach registers the hook of the heatmap in the CPU
+func (h *Heatmap) Attach(cpu *xip8.Cpu) {
+	cpu.AddBeforeCycleHook(h.beforeCycle)
+}
+
+// Reset clears the counts
+func (h *Heatmap) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	clear(h.total)
+	for _, b := range h.buckets {
+		clear(b)
+	}
+}
+
+// Counts returns a copy of the counts of every address
+func (h *Heatmap) Counts() []Counts {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]Counts{}, h.total...)
+}
+
+func (h *Heatmap) beforeCycle(cpu *xip8.Cpu) {
+	if int(cpu.Pc) >= xip8.MEMORY_SIZE {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.bucketSize > 0 {
+		if bucket := cpu.Cycles() / h.bucketSize; bucket != h.bucket {
+			h.bucket = bucket
+			h.next = (h.next + 1) % len(h.buckets)
+			for addr, c := range h.buckets[h.next] {
+				h.total[addr].sub(c)
+			}
+			clear(h.buckets[h.next])
+		}
+	}
+
+	ins := analysis.Decode(cpu.Memory[:], cpu.Pc)
+	h.count(cpu.Pc, cpu.Pc+ins.Size-1, Counts{Executes: 1})
+
+	if a, found := analysis.MemoryAccess(cpu, ins); found && a.Write {
+		h.count(a.First, a.Last, Counts{Writes: 1})
+	} else if found {
+		h.count(a.First, a.Last, Counts{Reads: 1})
+	}
+}
+
+func (h *Heatmap) count(first, last uint16, c Counts) {
+	for addr := int(first); addr <= int(last) && addr < len(h.total); addr++ {
+		h.total[addr].add(c)
+		if h.buckets != nil {
+			h.buckets[h.next][addr].add(c)
+		}
+	}
+}
+
+// Peak returns the highest count of every kind of access
+func Peak(counts []Counts) Counts {
+	var peak Counts
+	for _, c := range counts {
+		peak.Reads = max(peak.Reads, c.Reads)
+		peak.Writes = max(peak.Writes, c.Writes)
+		peak.Executes = max(peak.Executes, c.Executes)
+	}
+
+	return peak
+}
+
+// Color returns the color of an address: red for writes, green for reads and
+// blue for executions, brighter the closer they are to the peak.
+func Color(c, peak Counts) color.RGBA {
+	return color.RGBA{
+		R: intensity(c.Writes, peak.Writes),
+		G: intensity(c.Reads, peak.Reads),
+		B: intensity(c.Executes, peak.Executes),
+		A: 0xFF,
+	}
+}
+
+// intensity scales the count logarithmically so that rare accesses are still visible
+func intensity(count, peak uint32) byte {
+	if count == 0 || peak == 0 {
+		return 0
+	}
+
+	// Accessed addresses are never darker than a quarter of the maximum
+	return byte(0x40 + 0xBF*math.Log1p(float64(count))/math.Log1p(float64(peak)))
+}
+
+// Image draws the counts as a grid of columns addresses per row, with every
+// address as a square of scale pixels
+func Image(counts []Counts, columns, scale int) image.Image {
+	rows := (len(counts) + columns - 1) / columns
+	img := image.NewRGBA(image.Rect(0, 0, columns*scale, rows*scale))
+
+	peak := Peak(counts)
+	for addr, c := range counts {
+		col := Color(c, peak)
+		x, y := addr%columns*scale, addr/columns*scale
+		for dy := range scale {
+			for dx := range scale {
+				img.SetRGBA(x+dx, y+dy, col)
+			}
+		}
+	}
+
+	return img
+}
+
+// WritePNG writes the heatmap as a PNG with the default layout
+func (h *Heatmap) WritePNG(w io.Writer) error {
+	return png.Encode(w, Image(h.Counts(), DefaultColumns, DefaultScale))
+}
@@ -0,0 +1,73 @@
+package heatmap_test
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/heatmap"
+)
+
+func TestHeatmap(t *testing.T) {
+	cpu := xip8.NewCpu()
+	program := []byte{
+		0xA3, 0x00, // 0x200: LD I, 0x300
+		0xF1, 0x55, // 0x202: LD [I], V1
+		0xD0, 0x03, // 0x204: DRW V0, V0, 3
+		0x12, 0x06, // 0x206: JP 0x206
+	}
+	if err := cpu.LoadProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.Boot(); err != nil {
+		t.Fatal(err)
+	}
+
+	h := heatmap.New(100)
+	h.Attach(cpu)
+	for range 50 {
+		if err := cpu.LoopOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counts := h.Counts()
+	// LD [I] increments I with the default quirks
+	expected := map[uint16]heatmap.Counts{
+		0x200: {Executes: 1},
+		0x207: {Executes: 47},
+		0x300: {Writes: 1},
+		0x301: {Writes: 1},
+		0x302: {Reads: 1},
+		0x304: {Reads: 1},
+		0x305: {},
+	}
+	for addr, c := range expected {
+		if counts[addr] != c {
+			t.Errorf(`counts[%03X] = %+v, expected %+v`, addr, counts[addr], c)
+		}
+	}
+
+	// The first instructions leave the window
+	for range 100 {
+		if err := cpu.LoopOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if counts := h.Counts(); counts[0x200] != (heatmap.Counts{}) || counts[0x206].Executes < 90 {
+		t.Errorf(`the window kept %+v at 0x200 and %+v at 0x206`, counts[0x200], counts[0x206])
+	}
+
+	out := &bytes.Buffer{}
+	if err := h.WritePNG(out); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != heatmap.DefaultColumns*heatmap.DefaultScale {
+		t.Fatalf(`the image is %d pixels wide`, img.Bounds().Dx())
+	}
+}
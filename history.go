@@ -0,0 +1,212 @@
+package xip8
+
+import "errors"
+
+// DefaultHistorySize is the number of cycles kept by the debuggers
+const DefaultHistorySize = 4096
+
+var ErrHistoryEmpty = errors.New("no more execution history")
+
+// undoRecord keeps what a cycle can change so that it can be undone.
+// Memory and screen are only saved for the instructions that write them.
+// The screen is saved for the machine routines called with SYS, which can
+// change its mode, but not their writes to the memory.
+type undoRecord struct {
+	v              [16]byte
+	i              uint16
+	pc             uint16
+	sp             byte
+	stack          [16]uint16
+	dt, st         byte
+	waitingForKey  bool
+	keyDstRegister uint16
+	cycles, frames uint
+
+	memoryAddr uint16
+	memory     []byte
+
+	screen         []byte
+	screenSettings ScreenSettings
+}
+
+// history is a ring buffer with the undo records of the last cycles
+type history struct {
+	records []undoRecord
+	// Index of the oldest record
+	start int
+	size  int
+}
+
+func newHistory(size int) *history {
+	return &history{records: make([]undoRecord, size)}
+}
+
+// push adds a record, dropping the oldest one when the buffer is full
+func (h *history) push(r undoRecord) {
+	if h.size < len(h.records) {
+		h.records[(h.start+h.size)%len(h.records)] = r
+		h.size++
+		return
+	}
+
+	h.records[h.start] = r
+	h.start = (h.start + 1) % len(h.records)
+}
+
+// pop removes the newest record
+func (h *history) pop() (undoRecord, bool) {
+	if h.size == 0 {
+		return undoRecord{}, false
+	}
+
+	h.size--
+	r := h.records[(h.start+h.size)%len(h.records)]
+	h.records[(h.start+h.size)%len(h.records)] = undoRecord{}
+
+	return r, true
+}
+
+func (h *history) clear() {
+	clear(h.records)
+	h.start = 0
+	h.size = 0
+}
+
+// SetHistorySize keeps the undo records of the last size cycles.
+// A size of 0 disables the history.
+func (cpu *Cpu) SetHistorySize(size int) {
+	if size <= 0 {
+		cpu.history = nil
+		return
+	}
+
+	cpu.history = newHistory(size)
+}
+
+// HistoryLen returns the number of cycles that can be undone
+func (cpu Cpu) HistoryLen() int {
+	if cpu.history == nil {
+		return 0
+	}
+
+	return cpu.history.size
+}
+
+// recordHistory saves the state that the next cycle is going to change
+func (cpu *Cpu) recordHistory() {
+	if cpu.history == nil {
+		return
+	}
+
+	r := undoRecord{
+		v:              cpu.V,
+		i:              cpu.I,
+		pc:             cpu.Pc,
+		sp:             cpu.Sp,
+		stack:          cpu.Stack,
+		dt:             cpu.Dt,
+		st:             cpu.St,
+		waitingForKey:  cpu.waitingForKey,
+		keyDstRegister: cpu.keyDstRegister,
+		cycles:         cpu.cycles,
+		frames:         cpu.frames,
+	}
+
+	if !cpu.waitingForKey && int(cpu.Pc)+1 < MEMORY_SIZE {
+		opCode := uint16(cpu.Memory[cpu.Pc])<<8 | uint16(cpu.Memory[cpu.Pc+1])
+		x := (opCode & 0x0F00) >> 8
+
+		switch {
+		case opCode&0xF0FF == 0xF033:
+			r.memoryAddr, r.memory = cpu.saveMemory(cpu.I, 3)
+		case opCode&0xF0FF == 0xF055:
+			r.memoryAddr, r.memory = cpu.saveMemory(cpu.I, int(x)+1)
+		case opCode == 0x00E0, opCode&0xF000 == 0xD000,
+			opCode&0xF000 == 0x1000 && cpu.Layout.isHiresJump(cpu.Pc, opCode&0x0FFF),
+			opCode&0xF000 == 0x0000 && opCode != 0x00EE && cpu.MachineRoutineInterpreter != nil:
+			r.screen = cpu.Screen()
+			r.screenSettings = cpu.ScreenSettings
+		}
+	}
+
+	cpu.history.push(r)
+}
+
+// saveMemory copies up to n bytes starting at addr
+func (cpu *Cpu) saveMemory(addr uint16, n int) (uint16, []byte) {
+	end := min(int(addr)+n, MEMORY_SIZE)
+	if int(addr) >= end {
+		return addr, nil
+	}
+
+	saved := make([]byte, end-int(addr))
+	copy(saved, cpu.Memory[addr:end])
+
+	return addr, saved
+}
+
+// undo restores the state before the last recorded cycle
+func (cpu *Cpu) undo() bool {
+	if cpu.history == nil {
+		return false
+	}
+
+	r, found := cpu.history.pop()
+	if !found {
+		return false
+	}
+
+	cpu.V = r.v
+	cpu.I = r.i
+	cpu.Pc = r.pc
+	cpu.Sp = r.sp
+	cpu.Stack = r.stack
+	cpu.Dt = r.dt
+	cpu.St = r.st
+	cpu.waitingForKey = r.waitingForKey
+	cpu.keyDstRegister = r.keyDstRegister
+	cpu.cycles = r.cycles
+	cpu.frames = r.frames
+	cpu.lastError = nil
+
+	if r.memory != nil {
+		copy(cpu.Memory[r.memoryAddr:], r.memory)
+	}
+	if r.screen != nil {
+		cpu.screen = r.screen
+		cpu.ScreenSettings = r.screenSettings
+		cpu.isScreenDirty = true
+	}
+
+	return true
+}
+
+// ReverseStep undoes the last cycle
+func (cpu *Cpu) ReverseStep() error {
+	if !cpu.undo() {
+		return ErrHistoryEmpty
+	}
+
+	return cpu.Display.Render(cpu.screen, cpu.ScreenSettings)
+}
+
+// ReverseContinue undoes cycles until the PC is at a breakpoint.
+// It returns ErrHistoryEmpty when it runs out of history first.
+func (cpu *Cpu) ReverseContinue() error {
+	var err error
+	for {
+		if !cpu.undo() {
+			err = ErrHistoryEmpty
+			break
+		}
+		if cpu.HasBreakpoint(cpu.Pc) {
+			break
+		}
+	}
+
+	if renderErr := cpu.Display.Render(cpu.screen, cpu.ScreenSettings); renderErr != nil {
+		return renderErr
+	}
+
+	return err
+}
@@ -4,12 +4,19 @@ type Hook func(cpu *Cpu)
 
 func (cpu *Cpu) Start() {
 	cpu.isPaused = false
+	cpu.resuming = true
 }
 
 func (cpu *Cpu) Stop() {
 	cpu.isPaused = true
 }
 
+// Step resumes the CPU for a single cycle of the loop, after which it pauses again
+func (cpu *Cpu) Step() {
+	cpu.stepping = true
+	cpu.Start()
+}
+
 // AddBeforeFrameHook adds a hook that will before every cicle of the CPU
 func (cpu *Cpu) AddBeforeFrameHook(h Hook) int {
 	cpu.beforeFrameHooks = append(cpu.beforeFrameHooks, h)
@@ -45,6 +52,14 @@ func (cpu *Cpu) AddErrorHook(h Hook) int {
 	return len(cpu.errorHooks)
 }
 
+// AddLoadHook adds a hook that will run after the ROM is loaded into the
+// memory, when a cartridge is loaded and after a hard reset
+func (cpu *Cpu) AddLoadHook(h Hook) int {
+	cpu.loadHooks = append(cpu.loadHooks, h)
+
+	return len(cpu.loadHooks)
+}
+
 // runBeforeFrameHooks
 func (cpu *Cpu) runBeforeFrameHooks() {
 	cpu.runHooks(cpu.beforeFrameHooks)
@@ -70,6 +85,11 @@ func (cpu *Cpu) runErrorHooks() {
 	cpu.runHooks(cpu.errorHooks)
 }
 
+// runLoadHooks
+func (cpu *Cpu) runLoadHooks() {
+	cpu.runHooks(cpu.loadHooks)
+}
+
 // runHooks executes the given set of hooks
 func (cpu *Cpu) runHooks(hooks []Hook) {
 	for _, h := range hooks {
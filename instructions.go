@@ -41,6 +41,10 @@ func (cpu *Cpu) executeInstruction(opCode uint16) error {
 
 	case 0x1000:
 		// JP addr :: Jump to location nnn.
+		if cpu.Layout.isHiresJump(cpu.Pc-2, nnn) {
+			cpu.startHires()
+			break
+		}
 		cpu.Pc = nnn
 
 	case 0x2000:
@@ -230,7 +234,17 @@ func (cpu *Cpu) executeInstruction(opCode uint16) error {
 			cpu.I = cpu.I + uint16(cpu.V[x])
 		case 0x0029:
 			// LD F, Vx :: Set I = location of sprite for digit Vx.
-			cpu.I = uint16(cpu.V[x]) * 5
+			cpu.I = cpu.FontAddress + uint16(cpu.V[x]&0x0F)*smallGlyphSize
+		case 0x0030:
+			// LD HF, Vx :: Set I = location of the big sprite for digit Vx, if the font has them.
+			if len(cpu.Font.Big) == 0 {
+				return ErrOpCodeUnknown{
+					OpCode: opCode,
+					Pc:     cpu.Pc,
+				}
+			}
+			glyphs := uint16(len(cpu.Font.Big) / bigGlyphSize)
+			cpu.I = cpu.FontAddress + uint16(len(cpu.Font.Small)) + uint16(cpu.V[x])%glyphs*bigGlyphSize
 		case 0x0033:
 			// LD B, Vx :: Store BCD representation of Vx in memory locations I, I+1, and I+2.
 			top := x / 100
@@ -0,0 +1,56 @@
+package xip8
+
+// Layout is where an interpreter loads the programs and starts running them
+type Layout struct {
+	// Address where the ROM is loaded
+	LoadAddress uint16
+	// Address of the first instruction. Zero means the load address.
+	EntryPoint uint16
+	// Whether the jump to 0x260 at 0x200 that starts the programs of the
+	// two-page hi-res CHIP-8 interpreter switches to the 64x64 screen
+	HiresJump bool
+}
+
+// Addresses of the two-page hi-res CHIP-8 interpreter. The programs start by
+// jumping to its setup at 0x260, which ends jumping to the program at 0x2C0.
+const (
+	hiresJumpAddress = 0x200
+	hiresSetup       = 0x260
+	hiresStart       = 0x2C0
+)
+
+var (
+	// Layout of the COSMAC VIP and most interpreters
+	Chip8Layout = Layout{LoadAddress: startOfProgram}
+	// Layout of the ETI-660, whose interpreter takes the first 1.5KB
+	Eti660Layout = Layout{LoadAddress: startOfEtiProgram}
+	// Layout of the two-page hi-res CHIP-8 for the COSMAC VIP
+	HiresLayout = Layout{LoadAddress: startOfProgram, HiresJump: true}
+)
+
+// Screens of the ETI-660 and the hi-res CHIP-8
+var (
+	Eti660Screen = ScreenSettings{Width: 64, Height: 48}
+	HiresScreen  = ScreenSettings{Width: 64, Height: 64}
+)
+
+// Entry returns the address of the first instruction
+func (l Layout) Entry() uint16 {
+	if l.EntryPoint == 0 {
+		return l.LoadAddress
+	}
+	return l.EntryPoint
+}
+
+// isHiresJump returns whether the jump to nnn from pc switches to the hi-res screen
+func (l Layout) isHiresJump(pc, nnn uint16) bool {
+	return l.HiresJump && pc == hiresJumpAddress && nnn == hiresSetup
+}
+
+// startHires switches to the 64x64 screen and skips the setup of the
+// interpreter, which is not emulated
+func (cpu *Cpu) startHires() {
+	cpu.ScreenSettings = HiresScreen
+	cpu.clearScreen()
+	cpu.Pc = hiresStart
+}
@@ -0,0 +1,151 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/guslan/xip8"
+)
+
+var ErrInvalidHex = errors.New("invalid hex")
+
+// Address where programs start. Intel HEX files whose addresses start there
+// have memory addresses instead of offsets in the rom.
+const startOfProgram = 0x200
+
+// Intel HEX record types
+const (
+	ihexData                   = 0x00
+	ihexEndOfFile              = 0x01
+	ihexExtendedSegmentAddress = 0x02
+	ihexExtendedLinearAddress  = 0x04
+)
+
+func lines(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func isIntelHex(data []byte) bool {
+	ls := lines(data)
+	for _, line := range ls {
+		if !strings.HasPrefix(line, ":") {
+			return false
+		}
+	}
+	return len(ls) > 0
+}
+
+// decodeIntelHex reads the data records of an Intel HEX file. The gaps
+// between them are zeros, and every address must be in the memory.
+func decodeIntelHex(data []byte) ([]byte, error) {
+	memory := map[int]byte{}
+	lowest, highest := -1, -1
+	base := 0
+
+records:
+	for n, line := range lines(data) {
+		record, err := hex.DecodeString(line[1:])
+		if err != nil || len(record) < 5 || len(record) != 5+int(record[0]) {
+			return nil, fmt.Errorf("%w: line %d is not an Intel HEX record", ErrInvalidHex, n+1)
+		}
+
+		var sum byte
+		for _, b := range record {
+			sum += b
+		}
+		if sum != 0 {
+			return nil, fmt.Errorf("%w: wrong checksum in line %d", ErrInvalidHex, n+1)
+		}
+
+		addr := int(record[1])<<8 | int(record[2])
+		payload := record[4 : len(record)-1]
+		switch record[3] {
+		case ihexData:
+			for i, b := range payload {
+				a := base + addr + i
+				if a >= xip8.MEMORY_SIZE {
+					return nil, fmt.Errorf("%w: address 0x%X in line %d is outside of the memory", ErrInvalidHex, a, n+1)
+				}
+				memory[a] = b
+				if lowest < 0 || a < lowest {
+					lowest = a
+				}
+				highest = max(highest, a)
+			}
+		case ihexEndOfFile:
+			break records
+		case ihexExtendedSegmentAddress:
+			if len(payload) == 2 {
+				base = (int(payload[0])<<8 | int(payload[1])) << 4
+			}
+		case ihexExtendedLinearAddress:
+			if len(payload) == 2 {
+				base = (int(payload[0])<<8 | int(payload[1])) << 16
+			}
+		}
+	}
+	if lowest < 0 {
+		return nil, ErrEmpty
+	}
+
+	start := 0
+	if lowest >= startOfProgram {
+		start = startOfProgram
+	}
+	rom := make([]byte, highest-start+1)
+	for a, b := range memory {
+		rom[a-start] = b
+	}
+
+	return rom, nil
+}
+
+// hexWords splits a hex dump in words. Addresses at the start of the lines
+// (0200: or 0x200:), commas and 0x prefixes are dropped.
+func hexWords(data []byte) []string {
+	var words []string
+	for _, line := range lines(data) {
+		if i := strings.Index(line, ":"); i >= 0 {
+			line = line[i+1:]
+		}
+		for _, w := range strings.Fields(strings.ReplaceAll(line, ",", " ")) {
+			w = strings.TrimPrefix(strings.ToLower(w), "0x")
+			words = append(words, strings.TrimPrefix(w, "$"))
+		}
+	}
+	return words
+}
+
+func isHexText(data []byte) bool {
+	words := hexWords(data)
+	for _, w := range words {
+		if _, err := hex.DecodeString(w); err != nil || len(w) == 0 {
+			return false
+		}
+	}
+	return len(words) > 0
+}
+
+// decodeHexText reads a dump of bytes or words in hexadecimal
+func decodeHexText(data []byte) ([]byte, error) {
+	var rom []byte
+	for _, w := range hexWords(data) {
+		b, err := hex.DecodeString(w)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidHex, w)
+		}
+		rom = append(rom, b...)
+	}
+	return rom, nil
+}
@@ -0,0 +1,157 @@
+// Package loader reads ROMs stored as raw binaries, Intel HEX files, hex dumps,
+// Octo cartridges or zip archives, telling them apart by their content.
+package loader
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/guslan/xip8/cartridge"
+	"github.com/guslan/xip8/romdb"
+)
+
+var (
+	ErrEmpty    = errors.New("the rom is empty")
+	ErrNoRom    = errors.New("the archive has no rom")
+	ErrNotFound = errors.New("rom not found in the archive")
+)
+
+// Format of a ROM file
+type Format string
+
+const (
+	Raw      Format = "raw"
+	IntelHex Format = "ihex"
+	HexText  Format = "hex"
+	Zip      Format = "zip"
+	// Octo cartridge
+	Gif Format = "gif"
+)
+
+// Separates the path of an archive from the name of a rom in it, as in games.zip#pong.ch8
+const EntrySeparator = "#"
+
+var zipHeader = []byte("PK\x03\x04")
+
+// Detect returns the format of the data
+func Detect(data []byte) Format {
+	switch {
+	case bytes.HasPrefix(data, zipHeader):
+		return Zip
+	case cartridge.IsCartridge(data):
+		return Gif
+	case !isText(data):
+		return Raw
+	case isIntelHex(data):
+		return IntelHex
+	case isHexText(data):
+		return HexText
+	}
+
+	return Raw
+}
+
+// isText returns whether the data only has printable ASCII and whitespace
+func isText(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	for _, b := range data {
+		if (b < 0x20 || b > 0x7E) && b != '\n' && b != '\r' && b != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// Rom is a loaded rom
+type Rom struct {
+	Data   []byte
+	Format Format
+	// Settings that come with the rom, like the options of Octo cartridges.
+	// Nil for the other formats.
+	Settings *romdb.Settings
+}
+
+// Lookup returns the settings that come with the rom, or the ones of the
+// database. The database can be nil.
+func (r Rom) Lookup(db *romdb.Database) (romdb.Settings, bool) {
+	if r.Settings != nil {
+		return *r.Settings, true
+	}
+	if db == nil {
+		return romdb.Settings{}, false
+	}
+	return db.Lookup(r.Data)
+}
+
+// DecodeRom returns the rom in the data. name selects a rom of a zip archive,
+// the first one in name order is used when it is empty.
+func DecodeRom(data []byte, name string) (Rom, error) {
+	rom := Rom{Format: Detect(data)}
+	var err error
+	switch rom.Format {
+	case Zip:
+		return decodeZip(data, name)
+	case Gif:
+		rom.Data, rom.Settings, err = decodeCartridge(data)
+	case IntelHex:
+		rom.Data, err = decodeIntelHex(data)
+	case HexText:
+		rom.Data, err = decodeHexText(data)
+	default:
+		rom.Data = data
+	}
+
+	if err == nil && len(rom.Data) == 0 {
+		err = ErrEmpty
+	}
+	return rom, err
+}
+
+// Decode returns the bytes of the rom in the data, see DecodeRom
+func Decode(data []byte, name string) ([]byte, error) {
+	rom, err := DecodeRom(data, name)
+	return rom.Data, err
+}
+
+func decodeCartridge(data []byte) ([]byte, *romdb.Settings, error) {
+	c, err := cartridge.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rom, err := c.Rom()
+	if err != nil {
+		return nil, nil, err
+	}
+	settings := c.Options.Settings()
+
+	return rom, &settings, nil
+}
+
+// Open reads the rom in path. A rom of a zip archive is selected with
+// archive.zip#name, when no file has that path.
+func Open(path string) (Rom, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return DecodeRom(data, "")
+	}
+
+	i := strings.LastIndex(path, EntrySeparator)
+	if i < 0 {
+		return Rom{}, err
+	}
+	if data, err = os.ReadFile(path[:i]); err != nil {
+		return Rom{}, err
+	}
+	return DecodeRom(data, path[i+len(EntrySeparator):])
+}
+
+// Load reads the bytes of the rom in path, see Open
+func Load(path string) ([]byte, error) {
+	rom, err := Open(path)
+	return rom.Data, err
+}
@@ -0,0 +1,111 @@
+package loader_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/cartridge"
+	"github.com/guslan/xip8/loader"
+)
+
+var program = []byte{0x00, 0xE0, 0xA2, 0x2A, 0x60, 0x0C}
+
+func TestDecode(t *testing.T) {
+	inputs := map[string]struct {
+		data   string
+		format loader.Format
+	}{
+		"raw":         {string(program), loader.Raw},
+		"intel hex":   {":0602000000E0A22A600CE0\n:00000001FF\n", loader.IntelHex},
+		"hex words":   {"00E0 A22A\n600C\n", loader.HexText},
+		"hex dump":    {"0200: 00 E0 A2 2A\n0204: 0x60, 0x0C\n", loader.HexText},
+		"zip archive": {string(zipOf(t, map[string][]byte{"readme.txt": []byte("hi"), "b.ch8": {1}, "a.ch8": program})), loader.Zip},
+	}
+
+	for name, input := range inputs {
+		if f := loader.Detect([]byte(input.data)); f != input.format {
+			t.Errorf(`%s: detected %q, expected %q`, name, f, input.format)
+		}
+
+		rom, err := loader.Decode([]byte(input.data), "")
+		if err != nil {
+			t.Fatalf(`%s: %v`, name, err)
+		}
+		if !bytes.Equal(rom, program) {
+			t.Errorf(`%s: decoded % X, expected % X`, name, rom, program)
+		}
+	}
+}
+
+func TestZipEntries(t *testing.T) {
+	archive := zipOf(t, map[string][]byte{"games/pong.ch8": program, "games/tetris.ch8": {0x12, 0x00}})
+
+	entries, err := loader.Entries(archive)
+	if err != nil || len(entries) != 2 || entries[1] != "games/tetris.ch8" {
+		t.Fatalf(`entries = %v, %v`, entries, err)
+	}
+
+	rom, err := loader.Decode(archive, "games/tetris.ch8")
+	if err != nil || !bytes.Equal(rom, []byte{0x12, 0x00}) {
+		t.Fatalf(`decoded % X, %v`, rom, err)
+	}
+	if _, err := loader.Decode(archive, "missing.ch8"); !errors.Is(err, loader.ErrNotFound) {
+		t.Fatalf(`expected the rom to not be found, got %v`, err)
+	}
+}
+
+func TestInvalidIntelHex(t *testing.T) {
+	if _, err := loader.Decode([]byte(":0602000000E0A22A600CE1\n"), ""); !errors.Is(err, loader.ErrInvalidHex) {
+		t.Fatalf(`expected a checksum error, got %v`, err)
+	}
+	// Data at 0x10000, past the end of the memory
+	if _, err := loader.Decode([]byte(":020000040001F9\n:0100000012ED\n:00000001FF\n"), ""); !errors.Is(err, loader.ErrInvalidHex) {
+		t.Fatalf(`expected an address error, got %v`, err)
+	}
+}
+
+func TestZipTooLarge(t *testing.T) {
+	archive := zipOf(t, map[string][]byte{"huge.ch8": make([]byte, xip8.MEMORY_SIZE+1)})
+	if _, err := loader.Decode(archive, ""); !errors.Is(err, xip8.ErrProgramDoesNotFitIntoMemory) {
+		t.Fatalf(`expected the rom to not fit, got %v`, err)
+	}
+}
+
+func TestDecodeCartridge(t *testing.T) {
+	options := cartridge.DefaultOptions
+	options.Tickrate = 500
+	buf := &bytes.Buffer{}
+	if err := cartridge.Encode(buf, cartridge.Cartridge{Options: options, Program: cartridge.Source(program)}); err != nil {
+		t.Fatal(err)
+	}
+
+	rom, err := loader.DecodeRom(buf.Bytes(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rom.Format != loader.Gif || !bytes.Equal(rom.Data, program) {
+		t.Fatalf(`decoded %q % X, expected the program of the cartridge`, rom.Format, rom.Data)
+	}
+	if settings, found := rom.Lookup(nil); !found || settings.TickRate != 500 {
+		t.Fatalf(`settings = %+v, expected the options of the cartridge`, settings)
+	}
+}
+
+func zipOf(t *testing.T, files map[string][]byte) []byte {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	for name, data := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,85 @@
+package loader
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/guslan/xip8"
+)
+
+// Extensions of the files of an archive that are roms. When an archive has
+// none of them, every file is a rom.
+var romExtensions = []string{".ch8", ".c8", ".sc8", ".xo8", ".hc8", ".hex", ".bin", ".rom"}
+
+// Entries returns the names of the roms in a zip archive in name order
+func Entries(data []byte) ([]string, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var roms, others []string
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		ext := strings.ToLower(path.Ext(f.Name))
+		isRom := false
+		for _, e := range romExtensions {
+			isRom = isRom || ext == e
+		}
+		if isRom {
+			roms = append(roms, f.Name)
+		} else {
+			others = append(others, f.Name)
+		}
+	}
+	if len(roms) == 0 {
+		roms = others
+	}
+	sort.Strings(roms)
+
+	return roms, nil
+}
+
+func decodeZip(data []byte, name string) (Rom, error) {
+	entries, err := Entries(data)
+	if err != nil {
+		return Rom{}, err
+	}
+	if len(entries) == 0 {
+		return Rom{}, ErrNoRom
+	}
+
+	if len(name) == 0 {
+		name = entries[0]
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Rom{}, err
+	}
+	f, err := r.Open(name)
+	if err != nil {
+		return Rom{}, fmt.Errorf("%w: %s, the roms are %s", ErrNotFound, name, strings.Join(entries, ", "))
+	}
+	defer f.Close()
+
+	// Larger files cannot be roms, they are not read past the memory size
+	rom, err := io.ReadAll(io.LimitReader(f, xip8.MEMORY_SIZE+1))
+	if err != nil {
+		return Rom{}, err
+	}
+	if len(rom) > xip8.MEMORY_SIZE {
+		return Rom{}, fmt.Errorf("%w: %s is larger than %d bytes", xip8.ErrProgramDoesNotFitIntoMemory, name, xip8.MEMORY_SIZE)
+	}
+
+	// The roms of the archive can be in any of the other formats
+	return DecodeRom(rom, "")
+}
@@ -64,51 +64,19 @@ func (mem Memory) IsEqual(other Memory) bool {
 	return yes
 }
 
-// LoadProgram loads the program at the appropriate location
+// LoadProgram loads the default font and the program at the appropriate location
 func (mem *Memory) LoadProgram(program []byte) error {
-	loadCharactersInto(mem)
+	mem.LoadFont(0, DefaultFont)
+	return mem.LoadProgramAt(startOfProgram, program)
+}
 
-	if len(program) > MEMORY_SIZE-startOfProgram {
+// LoadProgramAt loads the program at the given address
+func (mem *Memory) LoadProgramAt(addr uint16, program []byte) error {
+	if int(addr)+len(program) > MEMORY_SIZE {
 		return ErrProgramDoesNotFitIntoMemory
 	}
 
-	copy(mem[startOfProgram:], program)
+	copy(mem[addr:], program)
 
 	return nil
 }
-
-func loadCharactersInto(mem *Memory) {
-	copy(mem[:], []byte{
-		// 0
-		0xF0, 0x90, 0x90, 0x90, 0xF0,
-		// 1
-		0x20, 0x60, 0x20, 0x20, 0x70,
-		// 2
-		0xF0, 0x10, 0xF0, 0x80, 0xF0,
-		// 3
-		0xF0, 0x10, 0xF0, 0x10, 0xF0,
-		// 4
-		0x90, 0x90, 0xF0, 0x10, 0x10,
-		// 5
-		0xF0, 0x80, 0xF0, 0x10, 0xF0,
-		// 6
-		0xF0, 0x80, 0xF0, 0x90, 0xF0,
-		// 7
-		0xF0, 0x10, 0x20, 0x40, 0x40,
-		// 8
-		0xF0, 0x90, 0xF0, 0x90, 0xF0,
-		// 9
-		0xF0, 0x90, 0xF0, 0x10, 0xF0,
-		// A
-		0xF0, 0x90, 0xF0, 0x90, 0x90,
-		// B
-		0xE0, 0x90, 0xE0, 0x90, 0xE0,
-		// C
-		0xF0, 0x80, 0x80, 0x80, 0xF0,
-		// D
-		0xE0, 0x90, 0x90, 0x90, 0xE0,
-		// E
-		0xF0, 0x80, 0xF0, 0x80, 0xF0,
-		// F
-		0xF0, 0x80, 0xF0, 0x80, 0x80})
-}
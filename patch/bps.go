@@ -0,0 +1,209 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/guslan/xip8"
+)
+
+var bpsHeader = []byte("BPS1")
+
+// Actions of a BPS patch
+const (
+	bpsSourceRead = iota
+	bpsTargetRead
+	bpsSourceCopy
+	bpsTargetCopy
+)
+
+// Size of the checksums of the source, the target and the patch at the end of a BPS patch
+const bpsFooterSize = 12
+
+type bpsReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bpsReader) byte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, fmt.Errorf("%w: truncated BPS patch", ErrInvalidPatch)
+	}
+	r.pos++
+	return r.data[r.pos-1], nil
+}
+
+// number reads a number in the variable length encoding of BPS
+func (r *bpsReader) number() (int, error) {
+	n, shift := 0, 1
+	for {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		n += int(b&0x7F) * shift
+		if b&0x80 != 0 {
+			return n, nil
+		}
+		shift <<= 7
+		n += shift
+		if shift > 1<<28 {
+			return 0, fmt.Errorf("%w: BPS number too large", ErrInvalidPatch)
+		}
+	}
+}
+
+// offset reads a relative offset, a number whose lowest bit is the sign
+func (r *bpsReader) offset() (int, error) {
+	n, err := r.number()
+	if n&1 != 0 {
+		return -(n >> 1), err
+	}
+	return n >> 1, err
+}
+
+// ApplyBps applies a BPS patch after checking the checksums of the ROM and the
+// patch, and checks the checksum of the result
+func ApplyBps(rom, patch []byte) ([]byte, error) {
+	if !bytes.HasPrefix(patch, bpsHeader) || len(patch) < len(bpsHeader)+bpsFooterSize {
+		return nil, fmt.Errorf("%w: missing the BPS header", ErrInvalidPatch)
+	}
+
+	footer := patch[len(patch)-bpsFooterSize:]
+	sourceCrc := binary.LittleEndian.Uint32(footer[0:])
+	targetCrc := binary.LittleEndian.Uint32(footer[4:])
+	patchCrc := binary.LittleEndian.Uint32(footer[8:])
+	if crc32.ChecksumIEEE(patch[:len(patch)-4]) != patchCrc {
+		return nil, fmt.Errorf("%w: the patch is damaged", ErrChecksum)
+	}
+	if crc32.ChecksumIEEE(rom) != sourceCrc {
+		return nil, fmt.Errorf("%w: the patch is for another ROM", ErrChecksum)
+	}
+
+	r := &bpsReader{data: patch[:len(patch)-bpsFooterSize], pos: len(bpsHeader)}
+	sourceSize, err := r.number()
+	if err != nil {
+		return nil, err
+	}
+	targetSize, err := r.number()
+	if err != nil {
+		return nil, err
+	}
+	metadataSize, err := r.number()
+	if err != nil {
+		return nil, err
+	}
+	r.pos += metadataSize
+	if sourceSize != len(rom) || r.pos > len(r.data) {
+		return nil, fmt.Errorf("%w: unexpected BPS sizes", ErrInvalidPatch)
+	}
+	// The size comes from the patch, the target is allocated once it fits in the memory
+	if targetSize > xip8.MEMORY_SIZE {
+		return nil, fmt.Errorf("%w: the BPS target of %d bytes does not fit in the memory", ErrInvalidPatch, targetSize)
+	}
+
+	out := make([]byte, 0, targetSize)
+	sourceOffset, targetOffset := 0, 0
+	for r.pos < len(r.data) {
+		n, err := r.number()
+		if err != nil {
+			return nil, err
+		}
+		action, length := n&3, n>>2+1
+		if len(out)+length > targetSize {
+			return nil, fmt.Errorf("%w: the BPS actions write past the target", ErrInvalidPatch)
+		}
+
+		switch action {
+		case bpsSourceRead:
+			if len(out)+length > len(rom) {
+				return nil, fmt.Errorf("%w: the BPS actions read past the source", ErrInvalidPatch)
+			}
+			out = append(out, rom[len(out):len(out)+length]...)
+		case bpsTargetRead:
+			if r.pos+length > len(r.data) {
+				return nil, fmt.Errorf("%w: truncated BPS patch", ErrInvalidPatch)
+			}
+			out = append(out, r.data[r.pos:r.pos+length]...)
+			r.pos += length
+		case bpsSourceCopy:
+			d, err := r.offset()
+			if err != nil {
+				return nil, err
+			}
+			sourceOffset += d
+			if sourceOffset < 0 || sourceOffset+length > len(rom) {
+				return nil, fmt.Errorf("%w: the BPS actions read past the source", ErrInvalidPatch)
+			}
+			out = append(out, rom[sourceOffset:sourceOffset+length]...)
+			sourceOffset += length
+		case bpsTargetCopy:
+			d, err := r.offset()
+			if err != nil {
+				return nil, err
+			}
+			targetOffset += d
+			if targetOffset < 0 || targetOffset >= len(out) {
+				return nil, fmt.Errorf("%w: the BPS actions read past the target", ErrInvalidPatch)
+			}
+			// The copy can overlap what it writes, so it goes a byte at a time
+			for range length {
+				out = append(out, out[targetOffset])
+				targetOffset++
+			}
+		}
+	}
+
+	if len(out) != targetSize {
+		return nil, fmt.Errorf("%w: the BPS actions wrote %d bytes, not %d", ErrInvalidPatch, len(out), targetSize)
+	}
+	if crc32.ChecksumIEEE(out) != targetCrc {
+		return nil, fmt.Errorf("%w: the patched ROM is not the expected one", ErrChecksum)
+	}
+
+	return out, nil
+}
+
+func appendBpsNumber(b []byte, n int) []byte {
+	for {
+		x := byte(n & 0x7F)
+		n >>= 7
+		if n == 0 {
+			return append(b, 0x80|x)
+		}
+		b = append(b, x)
+		n--
+	}
+}
+
+// CreateBps returns a BPS patch that reads the bytes that did not change from
+// the source and has the rest
+func CreateBps(source, target []byte) []byte {
+	out := bytes.Clone(bpsHeader)
+	out = appendBpsNumber(out, len(source))
+	out = appendBpsNumber(out, len(target))
+	// No metadata
+	out = appendBpsNumber(out, 0)
+
+	for i := 0; i < len(target); {
+		same := i < len(source) && source[i] == target[i]
+		end := i + 1
+		for end < len(target) && (end < len(source) && source[end] == target[end]) == same {
+			end++
+		}
+
+		if same {
+			out = appendBpsNumber(out, (end-i-1)<<2|bpsSourceRead)
+		} else {
+			out = appendBpsNumber(out, (end-i-1)<<2|bpsTargetRead)
+			out = append(out, target[i:end]...)
+		}
+		i = end
+	}
+
+	out = binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(source))
+	out = binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(target))
+	return binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(out))
+}
@@ -0,0 +1,99 @@
+package patch
+
+import (
+	"bytes"
+	"fmt"
+)
+
+var (
+	ipsHeader = []byte("PATCH")
+	ipsFooter = []byte("EOF")
+)
+
+// Largest offset of an IPS record, the next one reads as the footer
+const maxIpsOffset = 0x454F45
+
+// Largest number of bytes of an IPS record
+const maxIpsSize = 0xFFFF
+
+// ApplyIps applies an IPS patch, including run-length encoded records and the
+// truncation extension
+func ApplyIps(rom, patch []byte) ([]byte, error) {
+	if !bytes.HasPrefix(patch, ipsHeader) {
+		return nil, fmt.Errorf("%w: missing the IPS header", ErrInvalidPatch)
+	}
+
+	out := bytes.Clone(rom)
+	p := patch[len(ipsHeader):]
+	for {
+		if bytes.HasPrefix(p, ipsFooter) {
+			p = p[len(ipsFooter):]
+			break
+		}
+		if len(p) < 5 {
+			return nil, fmt.Errorf("%w: truncated IPS record", ErrInvalidPatch)
+		}
+
+		offset := int(p[0])<<16 | int(p[1])<<8 | int(p[2])
+		size := int(p[3])<<8 | int(p[4])
+		p = p[5:]
+
+		var data []byte
+		if size == 0 {
+			// Run of the same byte
+			if len(p) < 3 {
+				return nil, fmt.Errorf("%w: truncated IPS run", ErrInvalidPatch)
+			}
+			data = bytes.Repeat(p[2:3], int(p[0])<<8|int(p[1]))
+			p = p[3:]
+		} else {
+			if len(p) < size {
+				return nil, fmt.Errorf("%w: truncated IPS record", ErrInvalidPatch)
+			}
+			data, p = p[:size], p[size:]
+		}
+
+		if end := offset + len(data); end > len(out) {
+			out = append(out, make([]byte, end-len(out))...)
+		}
+		copy(out[offset:], data)
+	}
+
+	// Truncation extension
+	if len(p) >= 3 {
+		size := int(p[0])<<16 | int(p[1])<<8 | int(p[2])
+		out = out[:min(size, len(out))]
+	}
+
+	return out, nil
+}
+
+// CreateIps returns an IPS patch with a record for every run of different bytes
+func CreateIps(source, target []byte) ([]byte, error) {
+	if len(target) > maxIpsOffset {
+		return nil, fmt.Errorf("%w: IPS patches cover up to %d bytes", ErrInvalidPatch, maxIpsOffset)
+	}
+
+	out := bytes.Clone(ipsHeader)
+	for i := 0; i < len(target); {
+		if i < len(source) && source[i] == target[i] {
+			i++
+			continue
+		}
+
+		end := i
+		for end < len(target) && end-i < maxIpsSize && (end >= len(source) || source[end] != target[end]) {
+			end++
+		}
+		out = append(out, byte(i>>16), byte(i>>8), byte(i), byte((end-i)>>8), byte(end-i))
+		out = append(out, target[i:end]...)
+		i = end
+	}
+	out = append(out, ipsFooter...)
+
+	if len(target) < len(source) {
+		out = append(out, byte(len(target)>>16), byte(len(target)>>8), byte(len(target)))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,103 @@
+// Package patch applies and creates the IPS and BPS patches that fan
+// translations and fixes of ROMs are distributed as.
+package patch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown patch format")
+	ErrInvalidPatch  = errors.New("invalid patch")
+	ErrChecksum      = errors.New("checksum mismatch")
+)
+
+// Format of a patch
+type Format string
+
+const (
+	Ips Format = "ips"
+	Bps Format = "bps"
+)
+
+// Detect returns the format of a patch from its header
+func Detect(patch []byte) (Format, error) {
+	switch {
+	case bytes.HasPrefix(patch, ipsHeader):
+		return Ips, nil
+	case bytes.HasPrefix(patch, bpsHeader):
+		return Bps, nil
+	}
+
+	return "", ErrUnknownFormat
+}
+
+// ParseFormat parses the name of a format, like the extension of a patch file
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimPrefix(s, "."))); f {
+	case Ips, Bps:
+		return f, nil
+	}
+
+	return "", fmt.Errorf("%w %q, use ips or bps", ErrUnknownFormat, s)
+}
+
+// Apply returns the ROM with the patch applied. The ROM is not modified.
+func Apply(rom, patch []byte) ([]byte, error) {
+	f, err := Detect(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	if f == Bps {
+		return ApplyBps(rom, patch)
+	}
+	return ApplyIps(rom, patch)
+}
+
+// Create returns a patch in the given format that turns source into target
+func Create(f Format, source, target []byte) ([]byte, error) {
+	switch f {
+	case Ips:
+		return CreateIps(source, target)
+	case Bps:
+		return CreateBps(source, target), nil
+	}
+
+	return nil, fmt.Errorf("%w %q", ErrUnknownFormat, f)
+}
+
+// ApplyFiles applies the patches in the given paths, in order
+func ApplyFiles(rom []byte, paths ...string) ([]byte, error) {
+	for _, path := range paths {
+		if len(path) == 0 {
+			continue
+		}
+
+		p, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if rom, err = Apply(rom, p); err != nil {
+			return nil, fmt.Errorf("applying %s: %w", path, err)
+		}
+	}
+
+	return rom, nil
+}
+
+// SplitList splits a comma-separated list of patch paths
+func SplitList(s string) []string {
+	var paths []string
+	for _, path := range strings.Split(s, ",") {
+		if path = strings.TrimSpace(path); len(path) > 0 {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
@@ -0,0 +1,87 @@
+package patch_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"runtime"
+	"testing"
+
+	"github.com/guslan/xip8/patch"
+)
+
+func TestRoundTrip(t *testing.T) {
+	source := []byte{0x60, 0x05, 0x61, 0x07, 0x12, 0x04, 0xAA, 0xBB}
+	targets := map[string][]byte{
+		"changed":   {0x60, 0x09, 0x61, 0x07, 0x12, 0x00, 0xAA, 0xBB},
+		"longer":    {0x60, 0x05, 0x61, 0x07, 0x12, 0x04, 0xAA, 0xBB, 0x01, 0x02},
+		"shorter":   {0x60, 0x05, 0x61},
+		"identical": source,
+	}
+
+	for _, f := range []patch.Format{patch.Ips, patch.Bps} {
+		for name, target := range targets {
+			p, err := patch.Create(f, source, target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if detected, _ := patch.Detect(p); detected != f {
+				t.Fatalf(`%s %s: detected %q`, f, name, detected)
+			}
+
+			out, err := patch.Apply(source, p)
+			if err != nil {
+				t.Fatalf(`%s %s: %v`, f, name, err)
+			}
+			if !bytes.Equal(out, target) {
+				t.Fatalf(`%s %s: patched % X, expected % X`, f, name, out, target)
+			}
+		}
+	}
+}
+
+func TestIpsRun(t *testing.T) {
+	p := []byte("PATCH\x00\x00\x01\x00\x00\x00\x03\xFFEOF")
+	out, err := patch.Apply([]byte{1, 2, 3, 4, 5}, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, []byte{1, 0xFF, 0xFF, 0xFF, 5}) {
+		t.Fatalf(`patched % X`, out)
+	}
+}
+
+func TestBpsChecksums(t *testing.T) {
+	source, target := []byte{1, 2, 3, 4}, []byte{1, 2, 9, 4}
+	p := patch.CreateBps(source, target)
+
+	if _, err := patch.Apply([]byte{1, 2, 3, 5}, p); !errors.Is(err, patch.ErrChecksum) {
+		t.Fatalf(`expected a checksum error for another ROM, got %v`, err)
+	}
+
+	p[len(p)-13] ^= 0xFF
+	if _, err := patch.Apply(source, p); !errors.Is(err, patch.ErrChecksum) {
+		t.Fatalf(`expected a checksum error for a damaged patch, got %v`, err)
+	}
+
+	// A target of 1GiB with valid checksums is rejected before it is allocated
+	large := append([]byte("BPS1"), 0x84, 0x00, 0x7F, 0x7E, 0x7E, 0x82, 0x80)
+	large = binary.LittleEndian.AppendUint32(large, crc32.ChecksumIEEE(source))
+	large = binary.LittleEndian.AppendUint32(large, 0)
+	large = binary.LittleEndian.AppendUint32(large, crc32.ChecksumIEEE(large))
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := patch.Apply(source, large)
+	runtime.ReadMemStats(&after)
+	if !errors.Is(err, patch.ErrInvalidPatch) {
+		t.Fatalf(`expected an invalid patch for a target larger than the memory, got %v`, err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Fatalf(`allocated %d bytes for a target larger than the memory`, allocated)
+	}
+
+	if _, err := patch.Apply(source, []byte("UPS1")); !errors.Is(err, patch.ErrUnknownFormat) {
+		t.Fatalf(`expected an unknown format, got %v`, err)
+	}
+}
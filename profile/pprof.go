@@ -0,0 +1,160 @@
+package profile
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// Fields of the messages of profile.proto used by pprof
+const (
+	profileSampleType  = 1
+	profileSample      = 2
+	profileLocation    = 4
+	profileFunction    = 5
+	profileStringTable = 6
+	profilePeriodType  = 11
+	profilePeriod      = 12
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID      = 1
+	locationAddress = 3
+	locationLine    = 4
+
+	lineFunctionID = 1
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+)
+
+// protobuf encodes the few protocol buffer types needed by the profile
+type protobuf struct {
+	buf []byte
+}
+
+func (b *protobuf) varint(x uint64) {
+	b.buf = binary.AppendUvarint(b.buf, x)
+}
+
+func (b *protobuf) uint64(field int, x uint64) {
+	b.varint(uint64(field)<<3 | 0)
+	b.varint(x)
+}
+
+func (b *protobuf) bytes(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.buf = append(b.buf, data...)
+}
+
+func (b *protobuf) packed(field int, xs []uint64) {
+	inner := protobuf{}
+	for _, x := range xs {
+		inner.varint(x)
+	}
+	b.bytes(field, inner.buf)
+}
+
+func (b *protobuf) message(field int, encode func(m *protobuf)) {
+	inner := protobuf{}
+	encode(&inner)
+	b.bytes(field, inner.buf)
+}
+
+// WritePprof writes the profile in the gzipped protocol buffer format read by pprof.
+// Every address is a location of the subroutine it was executed in.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	strs := []string{""}
+	strIndex := map[string]uint64{"": 0}
+	str := func(s string) uint64 {
+		if i, found := strIndex[s]; found {
+			return i
+		}
+		strIndex[s] = uint64(len(strs))
+		strs = append(strs, s)
+		return strIndex[s]
+	}
+
+	type location struct {
+		addr, entry uint16
+	}
+	locations := map[location]uint64{}
+	functions := map[uint16]uint64{}
+
+	m := protobuf{}
+	m.message(profileSampleType, func(m *protobuf) {
+		m.uint64(valueTypeType, str("cycles"))
+		m.uint64(valueTypeUnit, str("count"))
+	})
+
+	var locationOrder []location
+	// Sorted to write the same file for the same profile
+	for _, s := range p.sortedSamples() {
+		ids := make([]uint64, len(s.addrs))
+		for i, addr := range s.addrs {
+			l := location{addr, s.entries[i]}
+			if _, found := locations[l]; !found {
+				locations[l] = uint64(len(locations) + 1)
+				locationOrder = append(locationOrder, l)
+			}
+			if _, found := functions[l.entry]; !found {
+				functions[l.entry] = uint64(len(functions) + 1)
+			}
+			ids[i] = locations[l]
+		}
+
+		m.message(profileSample, func(m *protobuf) {
+			m.packed(sampleLocationID, ids)
+			m.packed(sampleValue, []uint64{uint64(s.cycles)})
+		})
+	}
+
+	for _, l := range locationOrder {
+		m.message(profileLocation, func(m *protobuf) {
+			m.uint64(locationID, locations[l])
+			m.uint64(locationAddress, uint64(l.addr))
+			m.message(locationLine, func(m *protobuf) {
+				m.uint64(lineFunctionID, functions[l.entry])
+			})
+		})
+	}
+
+	entries := make([]uint16, 0, len(functions))
+	for entry := range functions {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return functions[entries[i]] < functions[entries[j]] })
+	for _, entry := range entries {
+		name := str(p.FunctionName(entry))
+		m.message(profileFunction, func(m *protobuf) {
+			m.uint64(functionID, functions[entry])
+			m.uint64(functionName, name)
+			m.uint64(functionSystemName, name)
+		})
+	}
+
+	m.message(profilePeriodType, func(m *protobuf) {
+		m.uint64(valueTypeType, str("cycles"))
+		m.uint64(valueTypeUnit, str("count"))
+	})
+	m.uint64(profilePeriod, 1)
+
+	// The string table goes last, after every string was added
+	for _, s := range strs {
+		m.bytes(profileStringTable, []byte(s))
+	}
+
+	z := gzip.NewWriter(w)
+	if _, err := z.Write(m.buf); err != nil {
+		return err
+	}
+
+	return z.Close()
+}
@@ -0,0 +1,263 @@
+// Package profile attributes the cycles of the CPU to addresses and
+// subroutines to find the code that makes a program miss frames.
+package profile
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/symbols"
+)
+
+// unknownEntry stands for the subroutines called before the profiler was attached
+const unknownEntry uint16 = 0xFFFF
+
+// sample is the number of cycles spent at an address with a given call stack
+type sample struct {
+	// Address of the instruction followed by the addresses of the calls, from the innermost
+	addrs []uint16
+	// Entries of the subroutines that the addresses belong to, from the innermost
+	entries []uint16
+	cycles  uint
+}
+
+// Profiler records the cycles spent in every address and subroutine.
+// Subroutines are tracked through the CALL and RET instructions, using the
+// stack pointer of the CPU after every cycle.
+type Profiler struct {
+	// Labels used to name the subroutines
+	Symbols *symbols.Table
+
+	cpu        *xip8.Cpu
+	startFrame uint
+
+	// Entries of the subroutines in the call stack, the first one is the main program
+	entries []uint16
+	// Samples by the address of their instruction, each with a different call stack
+	samples map[uint16][]*sample
+	cycles  uint
+	// Call stack of the current cycle, reused between cycles
+	stackAddrs, stackEntries []uint16
+
+	calls map[uint16]uint
+	// Calls of the current frame and maximum calls in a single frame
+	frameCalls    map[uint16]uint
+	maxFrameCalls map[uint16]uint
+	frame         uint
+}
+
+func NewProfiler(table *symbols.Table) *Profiler {
+	return &Profiler{
+		Symbols:       table,
+		samples:       map[uint16][]*sample{},
+		calls:         map[uint16]uint{},
+		frameCalls:    map[uint16]uint{},
+		maxFrameCalls: map[uint16]uint{},
+	}
+}
+
+// Attach registers the hooks of the profiler in the CPU.
+// The code running when it is attached is considered the main program.
+func (p *Profiler) Attach(cpu *xip8.Cpu) {
+	p.cpu = cpu
+	p.startFrame = cpu.Frames()
+	p.frame = cpu.Frames()
+
+	p.entries = []uint16{cpu.Pc}
+	for range cpu.Sp {
+		p.entries = append(p.entries, unknownEntry)
+	}
+
+	cpu.AddBeforeCycleHook(p.beforeCycle)
+	cpu.AddAfterCycleHook(p.afterCycle)
+}
+
+// Cycles returns the number of profiled cycles
+func (p *Profiler) Cycles() uint {
+	return p.cycles
+}
+
+// Frames returns the number of frames since the profiler was attached
+func (p *Profiler) Frames() uint {
+	if p.cpu == nil {
+		return 0
+	}
+
+	return p.cpu.Frames() - p.startFrame
+}
+
+func (p *Profiler) beforeCycle(cpu *xip8.Cpu) {
+	depth := min(int(cpu.Sp), len(cpu.Stack), len(p.entries)-1)
+
+	addrs := append(p.stackAddrs[:0], cpu.Pc)
+	entries := append(p.stackEntries[:0], p.entries[depth])
+	for i := depth - 1; i >= 0; i-- {
+		// The stack keeps the return address, the call is right before it
+		addrs = append(addrs, cpu.Stack[i]-2)
+		entries = append(entries, p.entries[i])
+	}
+	p.stackAddrs, p.stackEntries = addrs, entries
+
+	p.sample(addrs, entries).cycles++
+	p.cycles++
+}
+
+// sample returns the sample of the call stack, adding it if it is new
+func (p *Profiler) sample(addrs, entries []uint16) *sample {
+	for _, s := range p.samples[addrs[0]] {
+		if slices.Equal(s.addrs, addrs) && slices.Equal(s.entries, entries) {
+			return s
+		}
+	}
+
+	s := &sample{addrs: slices.Clone(addrs), entries: slices.Clone(entries)}
+	p.samples[addrs[0]] = append(p.samples[addrs[0]], s)
+	return s
+}
+
+// sortedSamples returns every sample by the address of its instruction
+func (p *Profiler) sortedSamples() []*sample {
+	addrs := make([]uint16, 0, len(p.samples))
+	for addr := range p.samples {
+		addrs = append(addrs, addr)
+	}
+	slices.Sort(addrs)
+
+	var samples []*sample
+	for _, addr := range addrs {
+		samples = append(samples, p.samples[addr]...)
+	}
+
+	return samples
+}
+
+func (p *Profiler) afterCycle(cpu *xip8.Cpu) {
+	if cpu.Frames() != p.frame {
+		clear(p.frameCalls)
+		p.frame = cpu.Frames()
+	}
+
+	depth := int(cpu.Sp)
+	if depth > len(p.entries)-1 {
+		// CALL: the PC is the entry of the subroutine
+		p.entries = append(p.entries, cpu.Pc)
+		p.calls[cpu.Pc]++
+		p.frameCalls[cpu.Pc]++
+		p.maxFrameCalls[cpu.Pc] = max(p.maxFrameCalls[cpu.Pc], p.frameCalls[cpu.Pc])
+	}
+	for depth < len(p.entries)-1 {
+		// RET
+		p.entries = p.entries[:len(p.entries)-1]
+	}
+}
+
+// FunctionName returns the label of a subroutine or a name based on its entry
+func (p *Profiler) FunctionName(entry uint16) string {
+	if entry == unknownEntry {
+		return "unknown"
+	}
+	if name, found := p.Symbols.Label(entry); found {
+		return name
+	}
+	if len(p.entries) > 0 && entry == p.entries[0] {
+		return "main"
+	}
+
+	return fmt.Sprintf("sub_%03X", entry)
+}
+
+// Hotspot is the number of cycles spent in a single address
+type Hotspot struct {
+	Address uint16
+	Cycles  uint
+}
+
+// Hotspots returns the addresses sorted by their cycles, from the hottest
+func (p *Profiler) Hotspots() []Hotspot {
+	hotspots := make([]Hotspot, 0, len(p.samples))
+	for addr, samples := range p.samples {
+		h := Hotspot{Address: addr}
+		for _, s := range samples {
+			h.Cycles += s.cycles
+		}
+		hotspots = append(hotspots, h)
+	}
+	sort.Slice(hotspots, func(i, j int) bool {
+		if hotspots[i].Cycles != hotspots[j].Cycles {
+			return hotspots[i].Cycles > hotspots[j].Cycles
+		}
+		return hotspots[i].Address < hotspots[j].Address
+	})
+
+	return hotspots
+}
+
+// Subroutine has the cycles and calls attributed to a subroutine
+type Subroutine struct {
+	Entry uint16
+	Name  string
+	// Cycles spent in the subroutine and in the ones it called
+	Inclusive uint
+	// Cycles spent in the subroutine itself
+	Exclusive uint
+	Calls     uint
+	// Maximum number of calls in a single frame
+	MaxCallsPerFrame uint
+}
+
+// Subroutines returns the subroutines sorted by their inclusive cycles
+func (p *Profiler) Subroutines() []Subroutine {
+	subs := map[uint16]*Subroutine{}
+	get := func(entry uint16) *Subroutine {
+		if s, found := subs[entry]; found {
+			return s
+		}
+		s := &Subroutine{
+			Entry:            entry,
+			Name:             p.FunctionName(entry),
+			Calls:            p.calls[entry],
+			MaxCallsPerFrame: p.maxFrameCalls[entry],
+		}
+		subs[entry] = s
+		return s
+	}
+
+	for _, s := range p.sortedSamples() {
+		get(s.entries[0]).Exclusive += s.cycles
+
+		// Recursive subroutines count only once
+		seen := map[uint16]bool{}
+		for _, entry := range s.entries {
+			if !seen[entry] {
+				seen[entry] = true
+				get(entry).Inclusive += s.cycles
+			}
+		}
+	}
+
+	result := make([]Subroutine, 0, len(subs))
+	for _, s := range subs {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Inclusive != result[j].Inclusive {
+			return result[i].Inclusive > result[j].Inclusive
+		}
+		return result[i].Entry < result[j].Entry
+	})
+
+	return result
+}
+
+// folded returns the call stack of a sample from the outermost subroutine
+func (p *Profiler) folded(s *sample) string {
+	names := make([]string, len(s.entries))
+	for i, entry := range s.entries {
+		names[len(s.entries)-1-i] = p.FunctionName(entry)
+	}
+
+	return strings.Join(names, ";")
+}
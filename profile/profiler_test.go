@@ -0,0 +1,173 @@
+package profile_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/profile"
+)
+
+func TestProfiler(t *testing.T) {
+	cpu := xip8.NewCpu()
+	cpu.CyclesPerFrame = 10
+
+	program := []byte{
+		0x22, 0x04, // 0x200: CALL 0x204
+		0x12, 0x00, // 0x202: JP 0x200
+		0x22, 0x08, // 0x204: CALL 0x208
+		0x00, 0xEE, // 0x206: RET
+		0x00, 0xEE, // 0x208: RET
+	}
+	if err := cpu.LoadProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.Boot(); err != nil {
+		t.Fatal(err)
+	}
+
+	profiler := profile.NewProfiler(nil)
+	profiler.Attach(cpu)
+
+	// 5 cycles per iteration of the main loop
+	for range 50 {
+		if err := cpu.LoopOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if profiler.Cycles() != 50 || profiler.Frames() != 5 {
+		t.Fatalf(`profiled %d cycles in %d frames, expected 50 in 5`, profiler.Cycles(), profiler.Frames())
+	}
+
+	expected := []profile.Subroutine{
+		{Entry: 0x200, Name: "main", Inclusive: 50, Exclusive: 20},
+		{Entry: 0x204, Name: "sub_204", Inclusive: 30, Exclusive: 20, Calls: 10, MaxCallsPerFrame: 2},
+		{Entry: 0x208, Name: "sub_208", Inclusive: 10, Exclusive: 10, Calls: 10, MaxCallsPerFrame: 2},
+	}
+	subs := profiler.Subroutines()
+	if len(subs) != len(expected) {
+		t.Fatalf(`found %d subroutines, expected %d`, len(subs), len(expected))
+	}
+	for i, s := range subs {
+		if s != expected[i] {
+			t.Errorf(`subroutine %d = %+v, expected %+v`, i, s, expected[i])
+		}
+	}
+
+	folded := &bytes.Buffer{}
+	if err := profiler.WriteFolded(folded); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(folded.String(), "main;sub_204;sub_208 10\n") {
+		t.Fatalf("unexpected folded stacks:\n%s", folded.String())
+	}
+
+	pprof := &bytes.Buffer{}
+	if err := profiler.WritePprof(pprof); err != nil {
+		t.Fatal(err)
+	}
+	z, err := gzip.NewReader(pprof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(z)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cycles of every sample by the addresses of its locations, from the innermost
+	addrs := map[uint64]uint64{}
+	var samples [][]uint64
+	var values []uint64
+	for _, f := range decodeMessage(t, data) {
+		switch f.number {
+		case 2: // sample
+			sample := decodeMessage(t, f.data)
+			samples = append(samples, decodePacked(t, sample[0].data))
+			values = append(values, decodePacked(t, sample[1].data)...)
+		case 4: // location
+			location := decodeMessage(t, f.data)
+			addrs[location[0].value] = location[1].value
+		}
+	}
+
+	stacks := map[string]uint64{}
+	for i, ids := range samples {
+		stack := make([]uint64, len(ids))
+		for j, id := range ids {
+			stack[j] = addrs[id]
+		}
+		stacks[fmt.Sprintf("%03X", stack)] = values[i]
+	}
+	expectedStacks := map[string]uint64{
+		"[200]":         10,
+		"[202]":         10,
+		"[204 200]":     10,
+		"[206 200]":     10,
+		"[208 204 200]": 10,
+	}
+	if fmt.Sprint(stacks) != fmt.Sprint(expectedStacks) {
+		t.Fatalf(`pprof samples = %v, expected %v`, stacks, expectedStacks)
+	}
+}
+
+// field of a protocol buffer message, with the value of varints or the data of the others
+type field struct {
+	number int
+	value  uint64
+	data   []byte
+}
+
+// decodeMessage decodes the varint and length-delimited fields of a message
+func decodeMessage(t *testing.T, buf []byte) []field {
+	t.Helper()
+
+	var fields []field
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			t.Fatalf(`invalid field key`)
+		}
+		buf = buf[n:]
+
+		value, n := binary.Uvarint(buf)
+		if n <= 0 {
+			t.Fatalf(`invalid value of field %d`, key>>3)
+		}
+		buf = buf[n:]
+
+		f := field{number: int(key >> 3), value: value}
+		if key&7 == 2 {
+			if value > uint64(len(buf)) {
+				t.Fatalf(`field %d is longer than the message`, f.number)
+			}
+			f.data, buf = buf[:value], buf[value:]
+		}
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+// decodePacked decodes a packed repeated varint field
+func decodePacked(t *testing.T, buf []byte) []uint64 {
+	t.Helper()
+
+	var values []uint64
+	for len(buf) > 0 {
+		v, n := binary.Uvarint(buf)
+		if n <= 0 {
+			t.Fatalf(`invalid packed varint`)
+		}
+		values = append(values, v)
+		buf = buf[n:]
+	}
+
+	return values
+}
@@ -0,0 +1,96 @@
+package profile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/guslan/xip8/analysis"
+)
+
+// DefaultHotspots is the number of addresses listed in the report
+const DefaultHotspots = 20
+
+// WriteReport writes the hottest addresses and the cycles of every subroutine.
+// Subroutines that need more cycles than a frame has are marked with a '!'.
+func (p *Profiler) WriteReport(w io.Writer, hotspots int) error {
+	out := bufio.NewWriter(w)
+	frames := p.Frames()
+
+	fmt.Fprintf(out, "Cycles: %d\n", p.cycles)
+	fmt.Fprintf(out, "Frames: %d\n", frames)
+	if p.cpu != nil {
+		fmt.Fprintf(out, "Cycles per frame: %d\n", p.cpu.CyclesPerFrame)
+	}
+	fmt.Fprintln(out)
+
+	fmt.Fprintf(out, "Hotspots\n")
+	fmt.Fprintf(out, "  %10s %6s  %-16s %s\n", "cycles", "%", "address", "instruction")
+	for i, h := range p.Hotspots() {
+		if i >= hotspots {
+			break
+		}
+
+		instruction := ""
+		if p.cpu != nil {
+			instruction = analysis.Decode(p.cpu.Memory[:], h.Address).Format(p.Symbols)
+		}
+		fmt.Fprintf(out, "  %10d %6.2f  %-16s %s\n", h.Cycles, p.percent(h.Cycles), p.Symbols.Format(h.Address), instruction)
+	}
+	fmt.Fprintln(out)
+
+	fmt.Fprintf(out, "Subroutines\n")
+	fmt.Fprintf(out, "  %10s %6s %10s %6s %8s %11s %9s %11s  %s\n",
+		"inclusive", "%", "exclusive", "%", "calls", "calls/frame", "max/frame", "cycles/call", "name")
+	for _, s := range p.Subroutines() {
+		callsPerFrame, cyclesPerCall := 0.0, 0.0
+		if frames > 0 {
+			callsPerFrame = float64(s.Calls) / float64(frames)
+		}
+		if s.Calls > 0 {
+			cyclesPerCall = float64(s.Inclusive) / float64(s.Calls)
+		}
+
+		marker := ""
+		if s.Calls > 0 && p.cpu != nil && cyclesPerCall > float64(p.cpu.CyclesPerFrame) {
+			marker = " !"
+		}
+
+		fmt.Fprintf(out, "  %10d %6.2f %10d %6.2f %8d %11.2f %9d %11.1f  %s (0x%03X)%s\n",
+			s.Inclusive, p.percent(s.Inclusive), s.Exclusive, p.percent(s.Exclusive),
+			s.Calls, callsPerFrame, s.MaxCallsPerFrame, cyclesPerCall, s.Name, s.Entry, marker)
+	}
+
+	return out.Flush()
+}
+
+func (p *Profiler) percent(cycles uint) float64 {
+	if p.cycles == 0 {
+		return 0
+	}
+
+	return 100 * float64(cycles) / float64(p.cycles)
+}
+
+// WriteFolded writes the call stacks in the folded format used by flamegraph tools,
+// one line per stack with the names separated by ';' followed by the cycles.
+func (p *Profiler) WriteFolded(w io.Writer) error {
+	stacks := map[string]uint{}
+	for _, s := range p.sortedSamples() {
+		stacks[p.folded(s)] += s.cycles
+	}
+
+	lines := make([]string, 0, len(stacks))
+	for stack := range stacks {
+		lines = append(lines, stack)
+	}
+	sort.Strings(lines)
+
+	out := bufio.NewWriter(w)
+	for _, stack := range lines {
+		fmt.Fprintf(out, "%s %d\n", stack, stacks[stack])
+	}
+
+	return out.Flush()
+}
@@ -0,0 +1,226 @@
+package romdb
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/guslan/xip8"
+)
+
+const (
+	PlatformChip8     = "originalChip8"
+	PlatformHiresVip  = "hybridVIP"
+	PlatformSuperChip = "superchip"
+	PlatformXoChip    = "xochip"
+	// ETI-660 and DREAM 6800 are not part of the community database
+	PlatformEti660    = "eti660"
+	PlatformDream6800 = "dream6800"
+)
+
+const (
+	hiresEntryJump   = 0x1260
+	eti660EntryPoint = 0x600
+	startOfProgram   = 0x200
+)
+
+// Signature found in a program
+type Signature struct {
+	Address  uint16
+	OpCode   uint16
+	Platform string
+	// Description of the signature
+	Reason string
+	// How much the signature counts towards the platform
+	Weight float64
+}
+
+// Detection is the result of the static analysis of a program
+type Detection struct {
+	Platform string
+	// In the range [0, 1)
+	Confidence float64
+	Signatures []Signature
+	// Address where the execution starts
+	EntryPoint uint16
+	// Suggested settings for the platform
+	Settings Settings
+}
+
+// Detect scans the program for instructions that only exist in some
+// platforms and suggests the settings of the most likely one.
+//
+// Data bytes can look like instructions, so the confidence grows with the
+// number of signatures found rather than being certain after the first one.
+func (db *Database) Detect(program []byte) Detection {
+	d := Detection{
+		Platform:   PlatformChip8,
+		Signatures: findSignatures(program),
+	}
+
+	scores := map[string]float64{}
+	for _, s := range d.Signatures {
+		scores[s.Platform] += s.Weight
+	}
+
+	switch {
+	case scores[PlatformXoChip] >= 1:
+		d.Platform = PlatformXoChip
+	case scores[PlatformSuperChip]+scores[PlatformXoChip] >= 1:
+		d.Platform = PlatformSuperChip
+	case scores[PlatformEti660] >= 1:
+		d.Platform = PlatformEti660
+	case scores[PlatformHiresVip] > 0:
+		d.Platform = PlatformHiresVip
+	}
+
+	score := scores[d.Platform]
+	if d.Platform == PlatformSuperChip {
+		score += scores[PlatformXoChip]
+	}
+	if d.Platform == PlatformChip8 {
+		// Nothing but the absence of extensions points to plain CHIP-8
+		d.Confidence = 0.5
+	} else {
+		d.Confidence = 1 - math.Pow(0.5, score)
+	}
+
+	d.Settings = db.suggest(d.Platform)
+
+	// The signatures are found at offsets of the program, which is loaded
+	// where the interpreter of the platform loads it
+	d.EntryPoint = d.Settings.Layout.Entry()
+	for i := range d.Signatures {
+		d.Signatures[i].Address += d.Settings.Layout.LoadAddress
+	}
+
+	return d
+}
+
+// suggest returns the default settings of a platform
+func (db *Database) suggest(platform string) Settings {
+	settings := Settings{
+		Platform:       platform,
+		Quirks:         xip8.Chip8Quirks,
+		ScreenSettings: xip8.SmallScreen,
+		Layout:         Layout(platform),
+		Font:           Font(platform),
+	}
+
+	id := platform
+	if platform == PlatformEti660 {
+		id = PlatformChip8
+	}
+	if p, found := db.platforms[id]; found {
+		settings.Quirks = p.Quirks.Flags()
+		settings.TickRate = p.DefaultTickrate
+		settings.ScreenSettings = p.ScreenSettings()
+	}
+
+	switch platform {
+	case PlatformEti660:
+		settings.ScreenSettings = xip8.Eti660Screen
+	case PlatformHiresVip:
+		settings.ScreenSettings = xip8.HiresScreen
+	}
+
+	return settings
+}
+
+// Layout returns where the interpreter of a platform loads the programs
+func Layout(platform string) xip8.Layout {
+	switch platform {
+	case PlatformEti660:
+		return xip8.Eti660Layout
+	case PlatformHiresVip:
+		return xip8.HiresLayout
+	}
+	return xip8.Chip8Layout
+}
+
+// Font returns the font of the interpreter of a platform, an empty one when
+// the platform does not have its own
+func Font(platform string) xip8.Font {
+	switch platform {
+	case PlatformChip8, PlatformHiresVip, "chip8x":
+		return xip8.VipFont
+	case PlatformDream6800:
+		return xip8.Dream6800Font
+	case PlatformEti660:
+		return xip8.Eti660Font
+	case "chip48":
+		return xip8.Chip48Font
+	case "superchip1", PlatformSuperChip, "megachip8", PlatformXoChip:
+		return xip8.SchipFont
+	}
+	return xip8.Font{}
+}
+
+// findSignatures returns the signatures with their offset in the program as their address
+func findSignatures(program []byte) []Signature {
+	signatures := make([]Signature, 0)
+	add := func(offset int, opCode uint16, platform string, weight float64, reason string) {
+		signatures = append(signatures, Signature{
+			Address:  uint16(offset),
+			OpCode:   opCode,
+			Platform: platform,
+			Reason:   reason,
+			Weight:   weight,
+		})
+	}
+
+	// Jumps and calls that land inside the program when it is loaded at 0x600
+	// but outside of it when loaded at 0x200
+	etiTargets, chip8Targets := 0, 0
+
+	for offset := 0; offset+1 < len(program); offset += 2 {
+		opCode := uint16(program[offset])<<8 | uint16(program[offset+1])
+		nnn := opCode & 0x0FFF
+
+		if offset == 0 && opCode == hiresEntryJump {
+			add(offset, opCode, PlatformHiresVip, 1, "jump to 0x260 at the start of the program")
+		}
+
+		switch {
+		case opCode == 0x00FE || opCode == 0x00FF:
+			add(offset, opCode, PlatformSuperChip, 0.5, "switch between low and high resolution")
+		case opCode == 0x00FB || opCode == 0x00FC || opCode&0xFFF0 == 0x00C0:
+			add(offset, opCode, PlatformSuperChip, 0.3, "scroll the screen")
+		case opCode == 0x00FD:
+			add(offset, opCode, PlatformSuperChip, 0.3, "exit the interpreter")
+		case opCode&0xF00F == 0xD000:
+			add(offset, opCode, PlatformSuperChip, 0.2, "draw a 16x16 sprite")
+		case opCode&0xF0FF == 0xF030:
+			add(offset, opCode, PlatformSuperChip, 0.3, "point I to a big font character")
+		case opCode&0xF0FF == 0xF075 || opCode&0xF0FF == 0xF085:
+			add(offset, opCode, PlatformSuperChip, 0.3, "save or load the flag registers")
+
+		case opCode == 0xF000:
+			add(offset, opCode, PlatformXoChip, 0.5, "load a 16-bit address into I")
+		case opCode&0xF0FF == 0xF001:
+			add(offset, opCode, PlatformXoChip, 0.5, "select the drawing planes")
+		case opCode == 0xF002:
+			add(offset, opCode, PlatformXoChip, 0.3, "load the audio pattern")
+		case opCode&0xF0FF == 0xF03A:
+			add(offset, opCode, PlatformXoChip, 0.3, "set the audio pitch")
+		case opCode&0xF00F == 0x5002 || opCode&0xF00F == 0x5003:
+			add(offset, opCode, PlatformXoChip, 0.3, "save or load a range of registers")
+		case opCode&0xFFF0 == 0x00D0:
+			add(offset, opCode, PlatformXoChip, 0.3, "scroll the screen up")
+		}
+
+		if opCode&0xF000 == 0x1000 || opCode&0xF000 == 0x2000 {
+			if nnn >= eti660EntryPoint && int(nnn) < eti660EntryPoint+len(program) {
+				etiTargets++
+			}
+			if nnn >= startOfProgram && int(nnn) < startOfProgram+len(program) {
+				chip8Targets++
+			}
+		}
+	}
+
+	if etiTargets > 0 && chip8Targets == 0 {
+		add(0, 0, PlatformEti660, float64(etiTargets)*0.5, fmt.Sprintf("%d jumps and calls only fit a program loaded at 0x600", etiTargets))
+	}
+
+	return signatures
+}
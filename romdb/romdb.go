@@ -0,0 +1,322 @@
+package romdb
+
+import (
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/guslan/xip8"
+)
+
+// The embedded files follow the layout of the community chip-8-database
+// (https://github.com/chip-8/chip-8-database), so they can be replaced by
+// the upstream copies as they are.
+
+//go:embed data/programs.json
+var programsJson []byte
+
+//go:embed data/platforms.json
+var platformsJson []byte
+
+var ErrInvalidColor = errors.New("invalid color: expected #RRGGBB")
+
+// Quirks as named in the community database
+type Quirks map[string]bool
+
+// Flags translates the quirks into the flags understood by the CPU
+func (q Quirks) Flags() xip8.QuirkFlag {
+	var flags xip8.QuirkFlag
+
+	if q["logic"] {
+		flags |= xip8.FlagQuirkVfReset
+	}
+	if !q["memoryLeaveIUnchanged"] {
+		flags |= xip8.FlagQuirkMemoryMovesIndex
+	}
+	if !q["wrap"] {
+		flags |= xip8.FlagQuirkClipping
+	}
+	if !q["shift"] {
+		flags |= xip8.FlagQuirkShiftWithVy
+	}
+	if q["jump"] {
+		flags |= xip8.FlagQuirkJumpUsesVx
+	}
+
+	return flags
+}
+
+// QuirksFromFlags translates the flags of the CPU into named quirks
+func QuirksFromFlags(flags xip8.QuirkFlag) Quirks {
+	return Quirks{
+		"logic":                 flags&xip8.FlagQuirkVfReset > 0,
+		"memoryLeaveIUnchanged": flags&xip8.FlagQuirkMemoryMovesIndex == 0,
+		"wrap":                  flags&xip8.FlagQuirkClipping == 0,
+		"shift":                 flags&xip8.FlagQuirkShiftWithVy == 0,
+		"jump":                  flags&xip8.FlagQuirkJumpUsesVx > 0,
+	}
+}
+
+type Platform struct {
+	Id                 string   `json:"id"`
+	Name               string   `json:"name"`
+	DisplayResolutions []string `json:"displayResolutions"`
+	DefaultTickrate    uint     `json:"defaultTickrate"`
+	Quirks             Quirks   `json:"quirks"`
+}
+
+// ScreenSettings returns the default resolution of the platform
+func (p Platform) ScreenSettings() xip8.ScreenSettings {
+	if len(p.DisplayResolutions) == 0 {
+		return xip8.SmallScreen
+	}
+
+	w, h, found := strings.Cut(p.DisplayResolutions[0], "x")
+	if !found {
+		return xip8.SmallScreen
+	}
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if errW != nil || errH != nil {
+		return xip8.SmallScreen
+	}
+
+	return xip8.ScreenSettings{Width: width, Height: height}
+}
+
+type Colors struct {
+	// Background first, then the foreground (and the extra planes on XO-CHIP)
+	Pixels  []string `json:"pixels,omitempty"`
+	Buzzer  string   `json:"buzzer,omitempty"`
+	Silence string   `json:"silence,omitempty"`
+}
+
+// Pixel returns the i-th pixel color if it is defined
+func (c Colors) Pixel(i int) (color.RGBA, bool) {
+	if i >= len(c.Pixels) {
+		return color.RGBA{}, false
+	}
+
+	rgba, err := ParseColor(c.Pixels[i])
+	if err != nil {
+		return color.RGBA{}, false
+	}
+
+	return rgba, true
+}
+
+// ParseColor parses colors in the #RRGGBB notation
+func ParseColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return color.RGBA{}, ErrInvalidColor
+	}
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return color.RGBA{}, ErrInvalidColor
+	}
+
+	return color.RGBA{R: b[0], G: b[1], B: b[2], A: 0xFF}, nil
+}
+
+type Rom struct {
+	File            string            `json:"file,omitempty"`
+	Platforms       []string          `json:"platforms"`
+	QuirkyPlatforms map[string]Quirks `json:"quirkyPlatforms,omitempty"`
+	Tickrate        uint              `json:"tickrate,omitempty"`
+	Keys            map[string]byte   `json:"keys,omitempty"`
+	Colors          Colors            `json:"colors,omitempty"`
+	ScreenRotation  int               `json:"screenRotation,omitempty"`
+}
+
+type Program struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Authors     []string       `json:"authors,omitempty"`
+	Roms        map[string]Rom `json:"roms"`
+}
+
+type entry struct {
+	title string
+	rom   Rom
+}
+
+// Database of ROM metadata keyed by the SHA-1 of the ROM
+type Database struct {
+	platforms map[string]Platform
+	roms      map[string]entry
+}
+
+// New returns a database with the embedded platforms and programs
+func New() (*Database, error) {
+	db := &Database{
+		platforms: map[string]Platform{},
+		roms:      map[string]entry{},
+	}
+
+	var platforms []Platform
+	if err := json.Unmarshal(platformsJson, &platforms); err != nil {
+		return nil, fmt.Errorf("loading embedded platforms: %w", err)
+	}
+	for _, p := range platforms {
+		db.platforms[p.Id] = p
+	}
+
+	var programs []Program
+	if err := json.Unmarshal(programsJson, &programs); err != nil {
+		return nil, fmt.Errorf("loading embedded programs: %w", err)
+	}
+	db.AddPrograms(programs)
+
+	return db, nil
+}
+
+// Open returns the embedded database with the user overrides applied.
+// The override file in the user config directory is read if it exists,
+// followed by the given paths, which must exist.
+func Open(overridePaths ...string) (*Database, error) {
+	db, err := New()
+	if err != nil {
+		return nil, err
+	}
+
+	if path, err := UserOverridePath(); err == nil {
+		if err := db.LoadOverride(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	for _, path := range overridePaths {
+		if len(path) == 0 {
+			continue
+		}
+		if err := db.LoadOverride(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// UserOverridePath returns the location of the user override file
+func UserOverridePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "xip8", "romdb.json"), nil
+}
+
+// LoadOverride reads a list of programs in the same format as the
+// programs.json of the community database. Its entries replace the existing
+// ones with the same hash.
+func (db *Database) LoadOverride(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var programs []Program
+	if err := json.Unmarshal(data, &programs); err != nil {
+		return fmt.Errorf("loading rom database override %s: %w", path, err)
+	}
+	db.AddPrograms(programs)
+
+	return nil
+}
+
+// AddPrograms adds the programs to the database
+func (db *Database) AddPrograms(programs []Program) {
+	for _, p := range programs {
+		for hash, rom := range p.Roms {
+			db.roms[strings.ToLower(hash)] = entry{title: p.Title, rom: rom}
+		}
+	}
+}
+
+// Platform returns the platform with the given id
+func (db *Database) Platform(id string) (Platform, bool) {
+	p, found := db.platforms[id]
+	return p, found
+}
+
+// PlatformName returns the human readable name of a platform
+func (db *Database) PlatformName(id string) string {
+	if p, found := db.platforms[id]; found {
+		return p.Name
+	}
+	switch id {
+	case PlatformEti660:
+		return "ETI-660 CHIP-8"
+	case PlatformDream6800:
+		return "DREAM 6800 CHIP-8"
+	}
+
+	return id
+}
+
+// Lookup finds the settings of the program by its hash
+func (db *Database) Lookup(program []byte) (Settings, bool) {
+	return db.LookupHash(Hash(program))
+}
+
+// LookupHash finds the settings of a program by its SHA-1 in hexadecimal
+func (db *Database) LookupHash(hash string) (Settings, bool) {
+	hash = strings.ToLower(hash)
+	e, found := db.roms[hash]
+	if !found {
+		return Settings{}, false
+	}
+
+	settings := Settings{
+		Hash:           hash,
+		Title:          e.title,
+		Quirks:         xip8.Chip8Quirks,
+		TickRate:       e.rom.Tickrate,
+		ScreenSettings: xip8.SmallScreen,
+		Keys:           e.rom.Keys,
+		Colors:         e.rom.Colors,
+		ScreenRotation: e.rom.ScreenRotation,
+	}
+
+	if len(e.rom.Platforms) > 0 {
+		settings.Platform = e.rom.Platforms[0]
+	}
+	settings.Layout = Layout(settings.Platform)
+	settings.Font = Font(settings.Platform)
+
+	quirks := Quirks{}
+	if p, found := db.platforms[settings.Platform]; found {
+		for k, v := range p.Quirks {
+			quirks[k] = v
+		}
+		settings.ScreenSettings = p.ScreenSettings()
+		if settings.TickRate == 0 {
+			settings.TickRate = p.DefaultTickrate
+		}
+	}
+	for k, v := range e.rom.QuirkyPlatforms[settings.Platform] {
+		quirks[k] = v
+	}
+	if len(quirks) > 0 {
+		settings.Quirks = quirks.Flags()
+	}
+
+	return settings, true
+}
+
+// Hash returns the SHA-1 of the program in hexadecimal
+func Hash(program []byte) string {
+	sum := sha1.Sum(program)
+	return hex.EncodeToString(sum[:])
+}
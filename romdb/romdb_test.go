@@ -0,0 +1,139 @@
+package romdb_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/romdb"
+)
+
+// TestLookupOverride adds a program through an override file and looks it up by its hash
+func TestLookupOverride(t *testing.T) {
+	program := []byte{0x12, 0x00}
+	hash := romdb.Hash(program)
+
+	path := filepath.Join(t.TempDir(), "romdb.json")
+	override := `[{
+		"title": "Loop",
+		"roms": {
+			"` + hash + `": {
+				"platforms": ["superchip"],
+				"quirkyPlatforms": {"superchip": {"logic": true}},
+				"colors": {"pixels": ["#000000", "#ff8000"]},
+				"screenRotation": 90
+			}
+		}
+	}]`
+	if err := os.WriteFile(path, []byte(override), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := romdb.New()
+	if err != nil {
+		t.Fatalf(`New() returned an error %v`, err)
+	}
+	if _, found := db.Lookup(program); found {
+		t.Fatalf(`Lookup() found the program before loading the override`)
+	}
+	if err := db.LoadOverride(path); err != nil {
+		t.Fatalf(`LoadOverride() returned an error %v`, err)
+	}
+
+	settings, found := db.Lookup(program)
+	if !found {
+		t.Fatalf(`Lookup() did not find the program`)
+	}
+	if settings.Title != "Loop" || settings.Platform != "superchip" {
+		t.Fatalf(`settings = %+v, expected the title and platform of the override`, settings)
+	}
+
+	wantQuirks := xip8.FlagQuirkVfReset | xip8.FlagQuirkClipping | xip8.FlagQuirkJumpUsesVx
+	if settings.Quirks != wantQuirks {
+		t.Fatalf(`settings.Quirks = %05b, expected %05b`, settings.Quirks, wantQuirks)
+	}
+	if settings.TickRate != 30 {
+		t.Fatalf(`settings.TickRate = %d, expected the platform default 30`, settings.TickRate)
+	}
+	if settings.ScreenSettings != xip8.SmallScreen {
+		t.Fatalf(`settings.ScreenSettings = %v, expected %v`, settings.ScreenSettings, xip8.SmallScreen)
+	}
+	if settings.Font.Name != xip8.SchipFont.Name {
+		t.Fatalf(`settings.Font = %s, expected the font of the platform %s`, settings.Font.Name, xip8.SchipFont.Name)
+	}
+	if c, ok := settings.Colors.Pixel(1); !ok || c.R != 0xFF || c.G != 0x80 || c.B != 0 {
+		t.Fatalf(`settings.Colors.Pixel(1) = %v, expected #ff8000`, c)
+	}
+}
+
+// TestLookupEmbedded looks up the IBM logo in the embedded database
+func TestLookupEmbedded(t *testing.T) {
+	ibmLogo := []byte{
+		0x00, 0xe0, 0xa2, 0x2a, 0x60, 0x0c, 0x61, 0x08, 0xd0, 0x1f, 0x70, 0x09, 0xa2, 0x39, 0xd0, 0x1f,
+		0xa2, 0x48, 0x70, 0x08, 0xd0, 0x1f, 0x70, 0x04, 0xa2, 0x57, 0xd0, 0x1f, 0x70, 0x08, 0xa2, 0x66,
+		0xd0, 0x1f, 0x70, 0x08, 0xa2, 0x75, 0xd0, 0x1f, 0x12, 0x28, 0xff, 0x00, 0xff, 0x00, 0x3c, 0x00,
+		0x3c, 0x00, 0x3c, 0x00, 0x3c, 0x00, 0xff, 0x00, 0xff, 0xff, 0x00, 0xff, 0x00, 0x38, 0x00, 0x3f,
+		0x00, 0x3f, 0x00, 0x38, 0x00, 0xff, 0x00, 0xff, 0x80, 0x00, 0xe0, 0x00, 0xe0, 0x00, 0x80, 0x00,
+		0x80, 0x00, 0xe0, 0x00, 0xe0, 0x00, 0x80, 0xf8, 0x00, 0xfc, 0x00, 0x3e, 0x00, 0x3f, 0x00, 0x3b,
+		0x00, 0x39, 0x00, 0xf8, 0x00, 0xf8, 0x03, 0x00, 0x07, 0x00, 0x0f, 0x00, 0xbf, 0x00, 0xfb, 0x00,
+		0xf3, 0x00, 0xe3, 0x00, 0x43, 0xe0, 0x00, 0xe0, 0x00, 0x80, 0x00, 0x80, 0x00, 0x80, 0x00, 0x80,
+		0x00, 0xe0, 0x00, 0xe0,
+	}
+
+	db, err := romdb.New()
+	if err != nil {
+		t.Fatalf(`New() returned an error %v`, err)
+	}
+
+	settings, found := db.Lookup(ibmLogo)
+	if !found {
+		t.Fatalf(`Lookup() did not find the IBM logo with the hash %s`, romdb.Hash(ibmLogo))
+	}
+	if settings.Title != "IBM Logo" || settings.Platform != romdb.PlatformChip8 {
+		t.Fatalf(`settings = %+v, expected the title and platform of the IBM logo`, settings)
+	}
+	if settings.TickRate != 15 {
+		t.Fatalf(`settings.TickRate = %d, expected the platform default 15`, settings.TickRate)
+	}
+	wantQuirks := xip8.FlagQuirkVfReset | xip8.FlagQuirkMemoryMovesIndex | xip8.FlagQuirkClipping | xip8.FlagQuirkShiftWithVy
+	if settings.Quirks != wantQuirks {
+		t.Fatalf(`settings.Quirks = %05b, expected %05b`, settings.Quirks, wantQuirks)
+	}
+}
+
+// TestDetect checks the platforms detected from the signatures of small programs
+func TestDetect(t *testing.T) {
+	db, err := romdb.New()
+	if err != nil {
+		t.Fatalf(`New() returned an error %v`, err)
+	}
+
+	// The signatures are at the addresses of the program loaded by the interpreter of the platform
+	cases := []struct {
+		name      string
+		program   []byte
+		platform  string
+		entry     uint16
+		signature uint16
+	}{
+		{"plain", []byte{0x60, 0x01, 0x12, 0x02}, romdb.PlatformChip8, 0x200, 0},
+		{"superchip", []byte{0x00, 0xFF, 0xD0, 0x10, 0x00, 0xFE, 0x12, 0x06}, romdb.PlatformSuperChip, 0x200, 0x200},
+		{"xochip", []byte{0xF0, 0x00, 0x03, 0x00, 0xF2, 0x01, 0x12, 0x06}, romdb.PlatformXoChip, 0x200, 0x200},
+		{"hires", []byte{0x12, 0x60}, romdb.PlatformHiresVip, 0x200, 0x200},
+		{"eti660", []byte{0x00, 0xFF, 0x60, 0x01, 0x26, 0x08, 0x16, 0x06, 0x00, 0xEE}, romdb.PlatformEti660, 0x600, 0x600},
+	}
+
+	for _, c := range cases {
+		d := db.Detect(c.program)
+		if d.Platform != c.platform {
+			t.Fatalf(`%s: Detect().Platform = %s, expected %s`, c.name, d.Platform, c.platform)
+		}
+		if d.EntryPoint != c.entry {
+			t.Fatalf(`%s: Detect().EntryPoint = 0x%03X, expected 0x%03X`, c.name, d.EntryPoint, c.entry)
+		}
+		if c.signature > 0 && (len(d.Signatures) == 0 || d.Signatures[0].Address != c.signature) {
+			t.Fatalf(`%s: Detect().Signatures = %+v, expected the first one at 0x%03X`, c.name, d.Signatures, c.signature)
+		}
+	}
+}
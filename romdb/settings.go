@@ -0,0 +1,62 @@
+package romdb
+
+import "github.com/guslan/xip8"
+
+// Settings of a ROM
+type Settings struct {
+	// SHA-1 of the ROM
+	Hash     string
+	Title    string
+	Platform string
+
+	Quirks xip8.QuirkFlag
+	// Instructions per frame. Zero keeps the current value.
+	TickRate       uint
+	ScreenSettings xip8.ScreenSettings
+	// Where the program is loaded and starts. A zero load address keeps the current one.
+	Layout xip8.Layout
+	// Font of the interpreter of the platform. An empty one keeps the current one.
+	Font xip8.Font
+
+	// Keys maps the actions of the game (up, down, a, ...) to keypad keys
+	Keys map[string]byte
+	// Colors of the screen and the buzzer
+	Colors Colors
+	// Clockwise rotation of the screen in degrees
+	ScreenRotation int
+}
+
+// Configure is a xip8.CpuConfigCb that applies the settings to the config
+func (s Settings) Configure(config *xip8.CpuConfig) {
+	config.Quirks = s.Quirks
+	if s.TickRate > 0 {
+		config.CyclesPerFrame = s.TickRate
+	}
+	if s.ScreenSettings.Width > 0 && s.ScreenSettings.Height > 0 {
+		config.ScreenSettings = s.ScreenSettings
+	}
+	if s.Layout.LoadAddress > 0 {
+		config.Layout = s.Layout
+	}
+	if len(s.Font.Small) > 0 {
+		config.Font = s.Font
+	}
+}
+
+// Apply applies the settings to an existing CPU.
+// It should be called before loading the program, which resizes the screen.
+func (s Settings) Apply(cpu *xip8.Cpu) {
+	cpu.SetQuirks(s.Quirks)
+	if s.TickRate > 0 {
+		cpu.CyclesPerFrame = s.TickRate
+	}
+	if s.ScreenSettings.Width > 0 && s.ScreenSettings.Height > 0 {
+		cpu.ScreenSettings = s.ScreenSettings
+	}
+	if s.Layout.LoadAddress > 0 {
+		cpu.Layout = s.Layout
+	}
+	if len(s.Font.Small) > 0 {
+		cpu.Font = s.Font
+	}
+}
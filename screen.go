@@ -24,6 +24,36 @@ var BigScreen = ScreenSettings{
 	Height: 64,
 }
 
+// Screen returns a copy of the current frame
+func (cpu Cpu) Screen() Screen {
+	screen := make(Screen, len(cpu.screen))
+	copy(screen, cpu.screen)
+
+	return screen
+}
+
+// Pixel returns whether the pixel at x, y of a screen w pixels wide is on.
+// Pixels are packed 8 per byte from the most significant bit, left to right
+// and top to bottom, so a sprite is a screen 8 (or 16) pixels wide.
+func (s Screen) Pixel(x, y, w int) bool {
+	bit := y*w + x
+	return bit/8 < len(s) && s[bit/8]&(0x80>>(bit%8)) != 0
+}
+
+// SetPixel turns the pixel at x, y of a screen w pixels wide on or off
+func (s Screen) SetPixel(x, y, w int, on bool) {
+	bit := y*w + x
+	if bit/8 >= len(s) {
+		return
+	}
+
+	if on {
+		s[bit/8] |= 0x80 >> (bit % 8)
+	} else {
+		s[bit/8] &^= 0x80 >> (bit % 8)
+	}
+}
+
 func (cpu *Cpu) clearScreen() {
 	cpu.screen = make([]byte, sizeInBytesOfScreen(cpu.ScreenSettings.Width, cpu.ScreenSettings.Height))
 }
@@ -0,0 +1,170 @@
+// Package search finds the addresses where a program keeps a value, like the
+// lives or the score of a game, by comparing snapshots of the memory.
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/guslan/xip8"
+)
+
+var (
+	ErrNotStarted    = errors.New("the search has not started")
+	ErrUnknownFilter = errors.New("unknown filter")
+)
+
+// Filter keeps the candidates whose value compares to the previous snapshot, or to a value
+type Filter int
+
+const (
+	// The value did not change
+	Equal Filter = iota
+	Changed
+	Increased
+	Decreased
+	// The value is the one given
+	Value
+)
+
+var filterNames = map[Filter]string{
+	Equal:     "equal",
+	Changed:   "changed",
+	Increased: "increased",
+	Decreased: "decreased",
+	Value:     "value",
+}
+
+func (f Filter) String() string {
+	if name, found := filterNames[f]; found {
+		return name
+	}
+	return fmt.Sprintf("Filter(%d)", int(f))
+}
+
+// ParseFilter parses the name of a filter
+func ParseFilter(s string) (Filter, error) {
+	for f, name := range filterNames {
+		if strings.EqualFold(s, name) {
+			return f, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w %q, use equal, changed, increased, decreased or value", ErrUnknownFilter, s)
+}
+
+func (f Filter) keep(previous, current, value byte) bool {
+	switch f {
+	case Equal:
+		return current == previous
+	case Changed:
+		return current != previous
+	case Increased:
+		return current > previous
+	case Decreased:
+		return current < previous
+	case Value:
+		return current == value
+	}
+	return false
+}
+
+// Candidate is an address that passed every filter
+type Candidate struct {
+	Address uint16 `json:"address"`
+	// Value in the previous snapshot
+	Previous byte `json:"previous"`
+	Value    byte `json:"value"`
+}
+
+// Search narrows down the candidate addresses one snapshot at a time. Its
+// methods can be called from any goroutine, but Start and Filter copy the
+// memory, which must not change meanwhile: call them from a hook or through
+// xip8.Cpu.Exec while the CPU runs.
+type Search struct {
+	mu sync.Mutex
+
+	started    bool
+	snapshot   [xip8.MEMORY_SIZE]byte
+	previous   [xip8.MEMORY_SIZE]byte
+	candidates []uint16
+}
+
+func New() *Search {
+	return &Search{}
+}
+
+// Start takes the first snapshot, every address is a candidate
+func (s *Search) Start(mem *xip8.Memory) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.started = true
+	s.snapshot = *mem
+	s.previous = *mem
+	s.candidates = make([]uint16, xip8.MEMORY_SIZE)
+	for i := range s.candidates {
+		s.candidates[i] = uint16(i)
+	}
+}
+
+// Started returns whether Start was called
+func (s *Search) Started() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.started
+}
+
+// Filter takes a snapshot and keeps the candidates whose value passes the
+// filter. value is only used by the Value filter.
+func (s *Search) Filter(mem *xip8.Memory, f Filter, value byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.started {
+		return 0, ErrNotStarted
+	}
+	if _, found := filterNames[f]; !found {
+		return 0, fmt.Errorf("%w %v", ErrUnknownFilter, f)
+	}
+
+	s.previous = s.snapshot
+	s.snapshot = *mem
+	kept := s.candidates[:0]
+	for _, addr := range s.candidates {
+		if f.keep(s.previous[addr], s.snapshot[addr], value) {
+			kept = append(kept, addr)
+		}
+	}
+	s.candidates = kept
+
+	return len(s.candidates), nil
+}
+
+// Count returns the number of candidates
+func (s *Search) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.candidates)
+}
+
+// Candidates returns up to limit candidates in address order, all of them if limit is 0
+func (s *Search) Candidates(limit int) []Candidate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.candidates)
+	if limit > 0 {
+		n = min(n, limit)
+	}
+	candidates := make([]Candidate, n)
+	for i, addr := range s.candidates[:n] {
+		candidates[i] = Candidate{Address: addr, Previous: s.previous[addr], Value: s.snapshot[addr]}
+	}
+
+	return candidates
+}
@@ -0,0 +1,45 @@
+package search_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/search"
+)
+
+func TestSearch(t *testing.T) {
+	s := search.New()
+	mem := &xip8.Memory{}
+	if _, err := s.Filter(mem, search.Equal, 0); !errors.Is(err, search.ErrNotStarted) {
+		t.Fatalf(`expected the search to not be started, got %v`, err)
+	}
+
+	mem[0x300], mem[0x301], mem[0x302] = 3, 3, 7
+	s.Start(mem)
+	if s.Count() != xip8.MEMORY_SIZE {
+		t.Fatalf(`%d candidates, expected every address`, s.Count())
+	}
+
+	// A life is lost
+	mem[0x300], mem[0x302] = 2, 8
+	if n, _ := s.Filter(mem, search.Decreased, 0); n != 1 {
+		t.Fatalf(`%d decreased candidates, expected 1`, n)
+	}
+
+	mem[0x300] = 1
+	if n, _ := s.Filter(mem, search.Value, 1); n != 1 {
+		t.Fatalf(`%d candidates with the value 1, expected 1`, n)
+	}
+	if c := s.Candidates(0); c[0] != (search.Candidate{Address: 0x300, Previous: 2, Value: 1}) {
+		t.Fatalf(`unexpected candidate %+v`, c[0])
+	}
+
+	if n, _ := s.Filter(mem, search.Changed, 0); n != 0 {
+		t.Fatalf(`%d changed candidates, expected none`, n)
+	}
+
+	if f, err := search.ParseFilter("Increased"); err != nil || f != search.Increased {
+		t.Fatalf(`ParseFilter = %v, %v`, f, err)
+	}
+}
@@ -0,0 +1,143 @@
+package sprites
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+var ErrUnsupportedBmp = errors.New("unsupported BMP")
+
+func init() {
+	image.RegisterFormat("bmp", "BM????\x00\x00\x00\x00", decodeBmp, decodeBmpConfig)
+}
+
+// bmpHeader has the fields of the file header and the BITMAPINFOHEADER that are used
+type bmpHeader struct {
+	dataOffset    uint32
+	width, height int32
+	bitsPerPixel  uint16
+	compression   uint32
+	colors        uint32
+	headerSize    uint32
+}
+
+func readBmpHeader(r io.Reader) (bmpHeader, error) {
+	var buf [54]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return bmpHeader{}, err
+	}
+
+	h := bmpHeader{
+		dataOffset:   binary.LittleEndian.Uint32(buf[10:]),
+		headerSize:   binary.LittleEndian.Uint32(buf[14:]),
+		width:        int32(binary.LittleEndian.Uint32(buf[18:])),
+		height:       int32(binary.LittleEndian.Uint32(buf[22:])),
+		bitsPerPixel: binary.LittleEndian.Uint16(buf[28:]),
+		compression:  binary.LittleEndian.Uint32(buf[30:]),
+		colors:       binary.LittleEndian.Uint32(buf[46:]),
+	}
+	switch {
+	case h.headerSize < 40:
+		return h, fmt.Errorf("%w: header of %d bytes", ErrUnsupportedBmp, h.headerSize)
+	case h.compression != 0:
+		return h, fmt.Errorf("%w: compressed images", ErrUnsupportedBmp)
+	case h.width <= 0 || h.height == 0:
+		return h, fmt.Errorf("%w: %dx%d pixels", ErrUnsupportedBmp, h.width, h.height)
+	}
+	switch h.bitsPerPixel {
+	case 1, 4, 8, 24, 32:
+	default:
+		return h, fmt.Errorf("%w: %d bits per pixel", ErrUnsupportedBmp, h.bitsPerPixel)
+	}
+	// Palettes have at most one color per index, 256 with 8 bits per pixel
+	if h.bitsPerPixel <= 8 && h.colors > 1<<h.bitsPerPixel {
+		return h, fmt.Errorf("%w: %d colors with %d bits per pixel", ErrUnsupportedBmp, h.colors, h.bitsPerPixel)
+	}
+
+	return h, nil
+}
+
+func decodeBmpConfig(r io.Reader) (image.Config, error) {
+	h, err := readBmpHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	return image.Config{ColorModel: color.RGBAModel, Width: int(h.width), Height: int(abs(h.height))}, nil
+}
+
+// decodeBmp decodes uncompressed BMP images, the ones drawn by simple paint programs
+func decodeBmp(r io.Reader) (image.Image, error) {
+	h, err := readBmpHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// The palette follows the header
+	if _, err := io.CopyN(io.Discard, r, int64(h.headerSize)-40); err != nil {
+		return nil, err
+	}
+	var palette color.Palette
+	if h.bitsPerPixel <= 8 {
+		n := h.colors
+		if n == 0 {
+			n = 1 << h.bitsPerPixel
+		}
+		entries := make([]byte, 4*n)
+		if _, err := io.ReadFull(r, entries); err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(entries); i += 4 {
+			palette = append(palette, color.RGBA{entries[i+2], entries[i+1], entries[i], 0xFF})
+		}
+	}
+	read := 14 + int64(h.headerSize) + 4*int64(len(palette))
+	if _, err := io.CopyN(io.Discard, r, int64(h.dataOffset)-read); err != nil {
+		return nil, err
+	}
+
+	w, height := int(h.width), int(abs(h.height))
+	img := image.NewRGBA(image.Rect(0, 0, w, height))
+	// Rows are padded to 4 bytes
+	row := make([]byte, (w*int(h.bitsPerPixel)+31)/32*4)
+	for i := range height {
+		if _, err := io.ReadFull(r, row); err != nil {
+			return nil, err
+		}
+
+		// Rows go from the bottom to the top unless the height is negative
+		y := height - 1 - i
+		if h.height < 0 {
+			y = i
+		}
+		for x := range w {
+			var c color.RGBA
+			switch h.bitsPerPixel {
+			case 24, 32:
+				n := int(h.bitsPerPixel) / 8
+				c = color.RGBA{row[x*n+2], row[x*n+1], row[x*n], 0xFF}
+			default:
+				bit := x * int(h.bitsPerPixel)
+				index := int(row[bit/8]>>(8-int(h.bitsPerPixel)-bit%8)) & (1<<h.bitsPerPixel - 1)
+				if index >= len(palette) {
+					return nil, fmt.Errorf("%w: color %d is not in the palette", ErrUnsupportedBmp, index)
+				}
+				c = palette[index].(color.RGBA)
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	return img, nil
+}
+
+func abs(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,125 @@
+package sprites
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/guslan/xip8"
+)
+
+var ErrInvalidSize = errors.New("invalid sprite size")
+
+// Palettes of the decoded sprites. With two planes the colors are none, the
+// first plane, the second plane and both.
+var (
+	MonochromePalette = color.Palette{
+		color.Gray{Y: 0x00},
+		color.Gray{Y: 0xFF},
+	}
+	FourColorPalette = color.Palette{
+		color.Gray{Y: 0x00},
+		color.Gray{Y: 0x55},
+		color.Gray{Y: 0xAA},
+		color.Gray{Y: 0xFF},
+	}
+)
+
+func checkSize(width, height, planes int) error {
+	if width != 8 && width != 16 {
+		return fmt.Errorf("%w: sprites are 8 or 16 pixels wide, not %d", ErrInvalidSize, width)
+	}
+	if height < 1 || height > 16 {
+		return fmt.Errorf("%w: sprites have 1 to 16 rows, not %d", ErrInvalidSize, height)
+	}
+	if planes != 1 && planes != 2 {
+		return fmt.Errorf("%w: sprites have 1 or 2 planes, not %d", ErrInvalidSize, planes)
+	}
+
+	return nil
+}
+
+// colorIndex returns the color of a pixel from 0 to 2^planes-1. Images with a
+// small palette use the index of the color, the others its brightness.
+func colorIndex(img image.Image, x, y, planes int) int {
+	colors := 1 << planes
+	if p, ok := img.(*image.Paletted); ok && len(p.Palette) <= colors {
+		return int(p.ColorIndexAt(x, y))
+	}
+
+	// Transparent pixels are off
+	if _, _, _, a := img.At(x, y).RGBA(); a < 0x8000 {
+		return 0
+	}
+
+	gray := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+	return (int(gray.Y)*(colors-1) + 0x7F) / 0xFF
+}
+
+// Encode splits the image in sprites of width by height pixels, from left to
+// right and top to bottom, and packs their rows like the screen. With two planes
+// (XO-CHIP) every sprite has the rows of the first plane followed by the second.
+func Encode(img image.Image, width, height, planes int) ([][]byte, error) {
+	if err := checkSize(width, height, planes); err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	if b.Dx()%width != 0 || b.Dy()%height != 0 {
+		return nil, fmt.Errorf("%w: the image is %dx%d, not a multiple of %dx%d", ErrInvalidSize, b.Dx(), b.Dy(), width, height)
+	}
+
+	size := width / 8 * height
+	sprites := make([][]byte, 0, b.Dx()/width*b.Dy()/height)
+	for top := b.Min.Y; top < b.Max.Y; top += height {
+		for left := b.Min.X; left < b.Max.X; left += width {
+			sprite := make([]byte, size*planes)
+			for plane := range planes {
+				s := xip8.Screen(sprite[plane*size : (plane+1)*size])
+				for y := range height {
+					for x := range width {
+						s.SetPixel(x, y, width, colorIndex(img, left+x, top+y, planes)&(1<<plane) != 0)
+					}
+				}
+			}
+			sprites = append(sprites, sprite)
+		}
+	}
+
+	return sprites, nil
+}
+
+// Decode draws the sprites in data, columns per row, with the palette of the number of planes
+func Decode(data []byte, width, height, planes, columns int) (*image.Paletted, error) {
+	if err := checkSize(width, height, planes); err != nil {
+		return nil, err
+	}
+
+	size := width / 8 * height
+	count := (len(data) + size*planes - 1) / (size * planes)
+	columns = max(min(columns, count), 1)
+	rows := (count + columns - 1) / columns
+
+	palette := MonochromePalette
+	if planes == 2 {
+		palette = FourColorPalette
+	}
+	img := image.NewPaletted(image.Rect(0, 0, columns*width, rows*height), palette)
+
+	for i := range count {
+		left, top := i%columns*width, i/columns*height
+		for plane := range planes {
+			start := min((i*planes+plane)*size, len(data))
+			s := xip8.Screen(data[start:min(start+size, len(data))])
+			for y := range height {
+				for x := range width {
+					if s.Pixel(x, y, width) {
+						img.SetColorIndex(left+x, top+y, img.ColorIndexAt(left+x, top+y)|1<<plane)
+					}
+				}
+			}
+		}
+	}
+
+	return img, nil
+}
@@ -0,0 +1,126 @@
+package sprites
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+
+	"github.com/guslan/xip8"
+)
+
+// Layout of the sheet written by the ripper
+const (
+	DefaultRipColumns = 16
+	DefaultRipScale   = 4
+)
+
+// Ripped is a sprite drawn by the program
+type Ripped struct {
+	// Value of I when it was drawn
+	Address uint16 `json:"address"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	// Bytes in hexadecimal
+	Bytes      string `json:"bytes"`
+	FirstFrame uint   `json:"firstFrame"`
+	Draws      uint   `json:"draws"`
+	// Position of the sprite in the sheet, in pixels
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Ripper records every different sprite drawn with DXYN. Sprites are
+// different when their address, size or bytes are.
+type Ripper struct {
+	sprites []*Ripped
+	byKey   map[string]*Ripped
+}
+
+func NewRipper() *Ripper {
+	return &Ripper{byKey: map[string]*Ripped{}}
+}
+
+// Attach registers the hook of the ripper in the CPU
+func (r *Ripper) Attach(cpu *xip8.Cpu) {
+	cpu.AddBeforeCycleHook(r.beforeCycle)
+}
+
+func (r *Ripper) beforeCycle(cpu *xip8.Cpu) {
+	if int(cpu.Pc)+1 >= xip8.MEMORY_SIZE {
+		return
+	}
+	opCode := uint16(cpu.Memory[cpu.Pc])<<8 | uint16(cpu.Memory[cpu.Pc+1])
+	if opCode&0xF000 != 0xD000 {
+		return
+	}
+
+	width, height := 8, int(opCode&0x000F)
+	if height == 0 {
+		width, height = 16, 16
+	}
+	end := min(int(cpu.I)+width/8*height, xip8.MEMORY_SIZE)
+	if int(cpu.I) >= end {
+		return
+	}
+	data := hex.EncodeToString(cpu.Memory[cpu.I:end])
+
+	key := fmt.Sprintf("%03X:%dx%d:%s", cpu.I, width, height, data)
+	s, found := r.byKey[key]
+	if !found {
+		s = &Ripped{Address: cpu.I, Width: width, Height: height, Bytes: data, FirstFrame: cpu.Frames()}
+		r.byKey[key] = s
+		r.sprites = append(r.sprites, s)
+	}
+	s.Draws++
+}
+
+// Sprites returns the sprites in the order they were first drawn
+func (r *Ripper) Sprites() []Ripped {
+	sprites := make([]Ripped, len(r.sprites))
+	for i, s := range r.sprites {
+		sprites[i] = *s
+	}
+
+	return sprites
+}
+
+// Render draws the sprites in a grid of 16x16 cells with columns cells per
+// row, and sets the position of every sprite in the sheet
+func (r *Ripper) Render(columns, scale int) *image.RGBA {
+	columns = max(min(columns, len(r.sprites)), 1)
+	rows := (len(r.sprites) + columns - 1) / columns
+	scale = max(scale, 1)
+	// The largest sprite and the gap around it
+	cell := 17 * scale
+
+	img := image.NewRGBA(image.Rect(0, 0, columns*cell+scale, rows*cell+scale))
+	draw.Draw(img, img.Bounds(), image.NewUniform(GapColor), image.Point{}, draw.Src)
+
+	for i, s := range r.sprites {
+		data, _ := hex.DecodeString(s.Bytes)
+		sheet := Sheet{Count: 1, Height: s.Height, Wide: s.Width == 16, Scale: scale}
+		sprite := sheet.Render(data)
+
+		// The sheet of a single sprite has a gap around it too
+		s.X, s.Y = i%columns*cell+scale, i/columns*cell+scale
+		r := sprite.Bounds().Inset(scale)
+		draw.Draw(img, r.Sub(r.Min).Add(image.Pt(s.X, s.Y)), sprite, r.Min, draw.Src)
+	}
+
+	return img
+}
+
+// Write writes the sheet as a PNG and the index of the sprites as JSON
+func (r *Ripper) Write(sheet io.Writer, index io.Writer, columns, scale int) error {
+	if err := png.Encode(sheet, r.Render(columns, scale)); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(index)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.Sprites())
+}
@@ -0,0 +1,142 @@
+// Package sprites draws regions of the memory as CHIP-8 sprites to inspect
+// the graphics of a program.
+package sprites
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	"github.com/guslan/xip8"
+)
+
+// Colors of the sheet
+var (
+	GapColor            = color.RGBA{0x40, 0x40, 0x40, 0xFF}
+	OffColor            = color.RGBA{0x00, 0x00, 0x00, 0xFF}
+	OnColor             = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	HighlightedOffColor = color.RGBA{0x00, 0x30, 0x60, 0xFF}
+	HighlightedOnColor  = color.RGBA{0xFF, 0xD0, 0x00, 0xFF}
+)
+
+// Sheet describes how a region of the memory is drawn
+type Sheet struct {
+	// Address of the first sprite
+	Start uint16
+	// Number of sprites
+	Count int
+	// Rows of every 8 pixels wide sprite
+	Height int
+	// Draws 16x16 SCHIP sprites, two bytes per row, instead. Height is ignored.
+	Wide bool
+	// Sprites per row of the sheet
+	Columns int
+	// Size of the pixels
+	Scale int
+
+	// The bytes in [HighlightStart, HighlightStart+HighlightSize) are drawn in other colors
+	HighlightStart uint16
+	HighlightSize  int
+}
+
+// SpriteWidth returns the width of the sprites in pixels
+func (s Sheet) SpriteWidth() int {
+	if s.Wide {
+		return 16
+	}
+	return 8
+}
+
+// SpriteHeight returns the height of the sprites in pixels
+func (s Sheet) SpriteHeight() int {
+	if s.Wide {
+		return 16
+	}
+	return max(s.Height, 1)
+}
+
+// SpriteSize returns the bytes taken by every sprite
+func (s Sheet) SpriteSize() int {
+	return s.SpriteWidth() / 8 * s.SpriteHeight()
+}
+
+// HighlightIndex highlights the bytes that the DXYN at the PC draws from I, or
+// a sprite of the sheet at I if the PC is at another instruction
+func (s *Sheet) HighlightIndex(cpu *xip8.Cpu) {
+	s.HighlightStart = cpu.I
+	s.HighlightSize = s.SpriteSize()
+
+	if int(cpu.Pc)+1 >= xip8.MEMORY_SIZE {
+		return
+	}
+	opCode := uint16(cpu.Memory[cpu.Pc])<<8 | uint16(cpu.Memory[cpu.Pc+1])
+	if opCode&0xF000 == 0xD000 {
+		s.HighlightSize = int(opCode & 0x000F)
+		if s.HighlightSize == 0 {
+			// 16x16 sprite
+			s.HighlightSize = 32
+		}
+	}
+}
+
+func (s Sheet) highlighted(addr int) bool {
+	return addr >= int(s.HighlightStart) && addr < int(s.HighlightStart)+s.HighlightSize
+}
+
+// Render draws the sprites in a grid separated by a pixel. Bytes outside the memory are drawn as off.
+func (s Sheet) Render(mem []byte) *image.RGBA {
+	columns := max(min(s.Columns, s.Count), 1)
+	rows := (s.Count + columns - 1) / columns
+	scale := max(s.Scale, 1)
+	w, h := s.SpriteWidth(), s.SpriteHeight()
+
+	img := image.NewRGBA(image.Rect(0, 0, (columns*(w+1)+1)*scale, (rows*(h+1)+1)*scale))
+	fill(img, img.Bounds(), GapColor)
+
+	for i := range s.Count {
+		left := (i%columns*(w+1) + 1) * scale
+		top := (i/columns*(h+1) + 1) * scale
+		base := int(s.Start) + i*s.SpriteSize()
+
+		for y := range h {
+			for x := range w {
+				addr := base + y*w/8 + x/8
+
+				var b byte
+				if addr < len(mem) {
+					b = mem[addr]
+				}
+				on := b&(0x80>>(x%8)) != 0
+
+				var c color.RGBA
+				switch {
+				case s.highlighted(addr) && on:
+					c = HighlightedOnColor
+				case s.highlighted(addr):
+					c = HighlightedOffColor
+				case on:
+					c = OnColor
+				default:
+					c = OffColor
+				}
+				fill(img, image.Rect(left+x*scale, top+y*scale, left+(x+1)*scale, top+(y+1)*scale), c)
+			}
+		}
+	}
+
+	return img
+}
+
+// WritePNG writes the sprites as a PNG
+func (s Sheet) WritePNG(w io.Writer, mem []byte) error {
+	return png.Encode(w, s.Render(mem))
+}
+
+func fill(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package sprites_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/sprites"
+)
+
+func TestRender(t *testing.T) {
+	mem := make([]byte, 64)
+	mem[0x10] = 0x80 // top left pixel of the second sprite
+	mem[0x21] = 0x01 // second row, last pixel of the 16x16 sprite
+
+	sheet := sprites.Sheet{Start: 0x08, Count: 2, Height: 8, Columns: 2, Scale: 2, HighlightStart: 0x10, HighlightSize: 1}
+	img := sheet.Render(mem)
+	if img.Bounds().Dx() != (2*9+1)*2 || img.Bounds().Dy() != (9+1)*2 {
+		t.Fatalf(`the sheet is %v, expected 38x20`, img.Bounds())
+	}
+
+	expected := map[[2]int]color.RGBA{
+		{0, 0}:               sprites.GapColor,
+		{2, 2}:               sprites.OffColor,
+		{(9 + 1) * 2, 2}:     sprites.HighlightedOnColor,
+		{(9 + 2) * 2, 2}:     sprites.HighlightedOffColor,
+		{(9 + 1) * 2, 2 * 2}: sprites.OffColor,
+	}
+	for p, c := range expected {
+		if img.RGBAAt(p[0], p[1]) != c {
+			t.Errorf(`pixel %v = %v, expected %v`, p, img.RGBAAt(p[0], p[1]), c)
+		}
+	}
+
+	wide := sprites.Sheet{Start: 0x1E, Count: 1, Wide: true}
+	img = wide.Render(mem)
+	if img.Bounds().Dx() != 18 || img.RGBAAt(1+15, 1+1) != sprites.OnColor {
+		t.Fatalf(`unexpected 16x16 sprite`)
+	}
+}
+
+func TestRipper(t *testing.T) {
+	cpu := xip8.NewCpu()
+	program := []byte{
+		0x60, 0x00, // 0x200: LD V0, 0x00
+		0xF0, 0x29, // 0x202: LD F, V0
+		0xD1, 0x15, // 0x204: DRW V1, V1, 5
+		0x70, 0x01, // 0x206: ADD V0, 0x01
+		0x30, 0x03, // 0x208: SE V0, 0x03
+		0x12, 0x02, // 0x20A: JP 0x202
+		0x12, 0x00, // 0x20C: JP 0x200
+	}
+	if err := cpu.LoadProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.Boot(); err != nil {
+		t.Fatal(err)
+	}
+
+	ripper := sprites.NewRipper()
+	ripper.Attach(cpu)
+	// Two rounds of the digits 0 to 2
+	for range 2 * (1 + 3*5 + 1) {
+		if err := cpu.LoopOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sheet, index := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := ripper.Write(sheet, index, 2, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var ripped []sprites.Ripped
+	if err := json.Unmarshal(index.Bytes(), &ripped); err != nil {
+		t.Fatal(err)
+	}
+	if len(ripped) != 3 {
+		t.Fatalf(`ripped %d sprites, expected 3`, len(ripped))
+	}
+	if r := ripped[1]; r.Address != 5 || r.Height != 5 || r.Bytes != "2060202070" || r.Draws != 2 || r.X != 18 || r.Y != 1 {
+		t.Fatalf(`unexpected sprite %+v`, r)
+	}
+
+	img, err := png.Decode(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 2*17+1 || img.Bounds().Dy() != 2*17+1 {
+		t.Fatalf(`the sheet is %v, expected 35x35`, img.Bounds())
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	// Two 8x2 sprites of two planes side by side
+	data := []byte{
+		0x81, 0x00, 0xFF, 0x01,
+		0x00, 0x0F, 0xF0, 0x00,
+	}
+	img, err := sprites.Decode(data, 8, 2, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 16 || img.Bounds().Dy() != 2 {
+		t.Fatalf(`the image is %v, expected 16x2`, img.Bounds())
+	}
+	// Both planes at the top left, the second one at the top right and the first one at the bottom right
+	if img.ColorIndexAt(0, 0) != 3 || img.ColorIndexAt(8, 0) != 2 || img.ColorIndexAt(15, 1) != 1 || img.ColorIndexAt(8, 1) != 0 {
+		t.Fatalf(`unexpected colors %v`, img.Pix)
+	}
+
+	encoded, err := sprites.Encode(img, 8, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bytes.Join(encoded, nil), data) {
+		t.Fatalf(`encoded % X, expected % X`, encoded, data)
+	}
+
+	if _, err := sprites.Encode(img, 16, 3, 1); !errors.Is(err, sprites.ErrInvalidSize) {
+		t.Fatalf(`expected an invalid size, got %v`, err)
+	}
+}
+
+// bmp returns an 8x1 BMP of 1 bit per pixel with a palette of the given colors
+func bmp(colors uint32, pixels byte) []byte {
+	data := make([]byte, 54+4*colors+4)
+	copy(data, "BM")
+	binary.LittleEndian.PutUint32(data[2:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(data[10:], 54+4*colors)
+	binary.LittleEndian.PutUint32(data[14:], 40)
+	binary.LittleEndian.PutUint32(data[18:], 8)
+	binary.LittleEndian.PutUint32(data[22:], 1)
+	binary.LittleEndian.PutUint16(data[26:], 1)
+	binary.LittleEndian.PutUint16(data[28:], 1)
+	binary.LittleEndian.PutUint32(data[46:], colors)
+	// Black and white
+	for i := range colors {
+		c := byte(0xFF * i)
+		copy(data[54+4*i:], []byte{c, c, c, 0})
+	}
+	data[len(data)-4] = pixels
+
+	return data
+}
+
+func TestBmpPalette(t *testing.T) {
+	img, _, err := image.Decode(bytes.NewReader(bmp(2, 0x81)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r != 0xFFFF {
+		t.Fatalf(`the first pixel is %v, expected white`, img.At(0, 0))
+	}
+	if r, _, _, _ := img.At(1, 0).RGBA(); r != 0 {
+		t.Fatalf(`the second pixel is %v, expected black`, img.At(1, 0))
+	}
+
+	// A palette larger than the bits per pixel allow is rejected before reading it
+	if _, _, err := image.Decode(bytes.NewReader(bmp(3, 0x81))); !errors.Is(err, sprites.ErrUnsupportedBmp) {
+		t.Fatalf(`expected an unsupported BMP, got %v`, err)
+	}
+	huge := bmp(2, 0x81)
+	binary.LittleEndian.PutUint32(huge[46:], 0xFFFFFFFF)
+	if _, _, err := image.Decode(bytes.NewReader(huge)); !errors.Is(err, sprites.ErrUnsupportedBmp) {
+		t.Fatalf(`expected an unsupported BMP, got %v`, err)
+	}
+}
@@ -0,0 +1,104 @@
+package xip8
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidState = errors.New("invalid state")
+
+// State is a copy of everything that the CPU needs to continue a program
+type State struct {
+	V     [16]byte
+	I     uint16
+	Dt    byte
+	St    byte
+	Pc    uint16
+	Sp    byte
+	Stack [16]uint16
+
+	Memory         Memory
+	Screen         Screen
+	ScreenSettings ScreenSettings
+	Quirks         QuirkFlag
+	Layout         Layout
+	Font           Font
+	FontAddress    uint16
+
+	Cycles         uint
+	Frames         uint
+	WaitingForKey  bool
+	KeyDstRegister uint16
+}
+
+// State returns a copy of the state of the machine
+func (cpu Cpu) State() State {
+	return State{
+		V:     cpu.V,
+		I:     cpu.I,
+		Dt:    cpu.Dt,
+		St:    cpu.St,
+		Pc:    cpu.Pc,
+		Sp:    cpu.Sp,
+		Stack: cpu.Stack,
+
+		Memory:         *cpu.Memory,
+		Screen:         cpu.Screen(),
+		ScreenSettings: cpu.ScreenSettings,
+		Quirks:         cpu.quirks,
+		Layout:         cpu.Layout,
+		Font:           cpu.Font,
+		FontAddress:    cpu.FontAddress,
+
+		Cycles:         cpu.cycles,
+		Frames:         cpu.frames,
+		WaitingForKey:  cpu.waitingForKey,
+		KeyDstRegister: cpu.keyDstRegister,
+	}
+}
+
+// Restore replaces the state of the machine. The history and the last error
+// are cleared and the screen is rendered. A state with the instruction at the
+// program counter outside of the memory or the stack pointer outside of the
+// stack is rejected.
+func (cpu *Cpu) Restore(s State) error {
+	if int(s.Pc)+1 >= MEMORY_SIZE {
+		return fmt.Errorf("%w: PC 0x%04X is outside of the memory", ErrInvalidState, s.Pc)
+	}
+	if int(s.Sp) > len(s.Stack) {
+		return fmt.Errorf("%w: SP %d is outside of the stack", ErrInvalidState, s.Sp)
+	}
+
+	cpu.V = s.V
+	cpu.I = s.I
+	cpu.Dt = s.Dt
+	cpu.St = s.St
+	cpu.Pc = s.Pc
+	cpu.Sp = s.Sp
+	cpu.Stack = s.Stack
+
+	*cpu.Memory = s.Memory
+	cpu.ScreenSettings = s.ScreenSettings
+	cpu.screen = newScreen(s.ScreenSettings.Width, s.ScreenSettings.Height)
+	copy(cpu.screen, s.Screen)
+	cpu.quirks = s.Quirks
+	// States saved before the layout and the font were kept leave them as they are
+	if s.Layout.LoadAddress > 0 {
+		cpu.Layout = s.Layout
+	}
+	if len(s.Font.Small) > 0 {
+		cpu.Font = s.Font
+		cpu.FontAddress = s.FontAddress
+	}
+
+	cpu.cycles = s.Cycles
+	cpu.frames = s.Frames
+	cpu.waitingForKey = s.WaitingForKey
+	cpu.keyDstRegister = s.KeyDstRegister
+	cpu.lastError = nil
+	if cpu.history != nil {
+		cpu.history.clear()
+	}
+
+	return cpu.Display.Render(cpu.screen, cpu.ScreenSettings)
+}
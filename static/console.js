@@ -16,6 +16,7 @@ document.addEventListener("alpine:init", () => {
     instruction_kk: "",
     instruction_n: "",
     pc: 0,
+    pcLabel: "",
     registers: [0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0],
     i: 0,
     stackPointer: 0,
@@ -23,10 +24,22 @@ document.addEventListener("alpine:init", () => {
     delay: 0,
     timer: 0,
     // };
+    cheats: [],
+
+    // toggleCheat turns a cheat on or off and shows the new state of all of them
+    toggleCheat(index) {
+      fetch("http://" + url + "/cheats?toggle=" + index, { method: "post" })
+        .then((res) => res.json())
+        .then((cheats) => (this.cheats = cheats));
+    },
 
     init() {
       const component = this;
 
+      fetch("http://" + url + "/cheats")
+        .then((res) => res.json())
+        .then((cheats) => (component.cheats = cheats));
+
       const debugEvent = new WebSocket("ws://" + url + "/debugger");
       debugEvent.binaryType = "arraybuffer";
       debugEvent.addEventListener("open", function (event) {
@@ -63,6 +76,11 @@ document.addEventListener("alpine:init", () => {
         // Why is it jumping one byte? IDK
         component.screenWidth = view.getUint8(57);
         component.screenHeight = view.getUint8(58);
+        // Label of the PC when the server has symbols
+        const labelLength = view.getUint8(59);
+        component.pcLabel = new TextDecoder().decode(
+          new Uint8Array(msg, 60, labelLength)
+        );
 
         for (let i = 0; i < 16; i++) {
           component.registers[i] = view.getUint8(4 + i).toString(16);
@@ -205,6 +223,22 @@ document.getElementById("step").addEventListener("submit", (event) => {
   }).then((res) => console.log(res));
 });
 
+document.getElementById("reverse-step").addEventListener("submit", (event) => {
+  event.preventDefault();
+
+  fetch("http://" + url + "/reverse-step", {
+    method: "post",
+  }).then((res) => console.log(res));
+});
+
+document.getElementById("reverse-continue").addEventListener("submit", (event) => {
+  event.preventDefault();
+
+  fetch("http://" + url + "/reverse-continue", {
+    method: "post",
+  }).then((res) => console.log(res));
+});
+
 document.getElementById("reset").addEventListener("submit", (event) => {
   event.preventDefault();
 
@@ -212,3 +246,18 @@ document.getElementById("reset").addEventListener("submit", (event) => {
     method: "post",
   }).then((res) => console.log(res));
 });
+
+// A soft reset keeps the memory as the program left it
+document.getElementById("soft-reset").addEventListener("submit", (event) => {
+  event.preventDefault();
+
+  fetch("http://" + url + "/reset?soft", {
+    method: "post",
+  }).then((res) => console.log(res));
+});
+
+// The heatmap is reloaded twice per second, the timestamp avoids cached images
+const heatmapEl = document.getElementById("heatmap");
+setInterval(() => {
+  heatmapEl.src = "http://" + url + "/heatmap.png?t=" + Date.now();
+}, 500);
@@ -0,0 +1,248 @@
+package symbols
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrUnknownSymbol = errors.New("unknown symbol")
+
+// Symbol is a label of an address
+type Symbol struct {
+	Name    string
+	Address uint16
+}
+
+// Table of symbols, as emitted by Octo and other assemblers
+type Table struct {
+	// Sorted by address
+	symbols []Symbol
+	byName  map[string]uint16
+}
+
+func NewTable() *Table {
+	return &Table{
+		symbols: make([]Symbol, 0),
+		byName:  map[string]uint16{},
+	}
+}
+
+// Load reads a symbol file
+func Load(path string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("loading symbols from %s: %w", path, err)
+	}
+
+	return t, nil
+}
+
+// Parse reads a symbol map. Both a JSON object of labels and addresses
+// and text files with one label per line are accepted. Lines can take any of
+// the forms
+//
+//	label 0x200
+//	label = 0x200
+//	label: 0x200
+//	0x200 label
+//	:const label 0x200
+//
+// Comments start with # or ;.
+func Parse(r io.Reader) (*Table, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	t := NewTable()
+
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") {
+		m := map[string]uint16{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		for name, addr := range m {
+			t.Add(name, addr)
+		}
+		return t, nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexAny(text, "#;"); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.NewReplacer("=", " ", ":const", " ", ":", " ").Replace(text)
+
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected a label and an address", line)
+		}
+
+		if addr, err := ParseAddress(fields[1]); err == nil {
+			t.Add(fields[0], addr)
+		} else if addr, err := ParseAddress(fields[0]); err == nil {
+			t.Add(fields[1], addr)
+		} else {
+			return nil, fmt.Errorf("line %d: no address in %q", line, scanner.Text())
+		}
+	}
+
+	return t, scanner.Err()
+}
+
+// ParseAddress parses decimal, 0x-prefixed and $-prefixed hexadecimal addresses
+func ParseAddress(s string) (uint16, error) {
+	s = strings.ToLower(s)
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "0x"):
+		s, base = s[2:], 16
+	case strings.HasPrefix(s, "$"):
+		s, base = s[1:], 16
+	}
+
+	n, err := strconv.ParseUint(s, base, 16)
+	return uint16(n), err
+}
+
+// Add adds a label to the table
+func (t *Table) Add(name string, addr uint16) {
+	if prev, found := t.byName[name]; found {
+		t.remove(name, prev)
+	}
+	t.byName[name] = addr
+
+	i := sort.Search(len(t.symbols), func(i int) bool {
+		return t.symbols[i].Address > addr
+	})
+	t.symbols = append(t.symbols, Symbol{})
+	copy(t.symbols[i+1:], t.symbols[i:])
+	t.symbols[i] = Symbol{Name: name, Address: addr}
+}
+
+func (t *Table) remove(name string, addr uint16) {
+	for i, s := range t.symbols {
+		if s.Name == name && s.Address == addr {
+			t.symbols = append(t.symbols[:i], t.symbols[i+1:]...)
+			return
+		}
+	}
+}
+
+// Len returns the number of symbols
+func (t *Table) Len() int {
+	if t == nil {
+		return 0
+	}
+
+	return len(t.symbols)
+}
+
+// Symbols returns the symbols sorted by address
+func (t *Table) Symbols() []Symbol {
+	if t == nil {
+		return nil
+	}
+
+	return append([]Symbol{}, t.symbols...)
+}
+
+// Lookup returns the closest label at or before the address
+func (t *Table) Lookup(addr uint16) (name string, offset uint16, found bool) {
+	if t == nil {
+		return "", 0, false
+	}
+
+	i := sort.Search(len(t.symbols), func(i int) bool {
+		return t.symbols[i].Address > addr
+	})
+	if i == 0 {
+		return "", 0, false
+	}
+
+	s := t.symbols[i-1]
+	return s.Name, addr - s.Address, true
+}
+
+// Label returns the label at exactly the address
+func (t *Table) Label(addr uint16) (string, bool) {
+	name, offset, found := t.Lookup(addr)
+	return name, found && offset == 0
+}
+
+// Format formats an address as label+offset, or in hexadecimal if there
+// is no label before it. A nil table formats every address in hexadecimal.
+func (t *Table) Format(addr uint16) string {
+	name, offset, found := t.Lookup(addr)
+	switch {
+	case !found:
+		return fmt.Sprintf("0x%03X", addr)
+	case offset == 0:
+		return name
+	}
+
+	return fmt.Sprintf("%s+%d", name, offset)
+}
+
+// Resolve returns the address of a label, a label+offset or a number
+func (t *Table) Resolve(s string) (uint16, error) {
+	s = strings.TrimSpace(s)
+	if addr, err := ParseAddress(s); err == nil {
+		return addr, nil
+	}
+
+	name, offsetText, hasOffset := strings.Cut(s, "+")
+	if t == nil {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownSymbol, name)
+	}
+	addr, found := t.byName[name]
+	if !found {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownSymbol, name)
+	}
+
+	if hasOffset {
+		offset, err := ParseAddress(offsetText)
+		if err != nil {
+			return 0, fmt.Errorf("invalid offset in %s: %w", s, err)
+		}
+		addr += offset
+	}
+
+	return addr, nil
+}
+
+// ResolveList resolves a comma-separated list of addresses and labels
+func (t *Table) ResolveList(s string) ([]uint16, error) {
+	addrs := make([]uint16, 0)
+	for _, item := range strings.Split(s, ",") {
+		if len(strings.TrimSpace(item)) == 0 {
+			continue
+		}
+
+		addr, err := t.Resolve(item)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, nil
+}
@@ -0,0 +1,50 @@
+package symbols_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/guslan/xip8/symbols"
+)
+
+// TestParse reads the supported line forms and formats addresses with them
+func TestParse(t *testing.T) {
+	table, err := symbols.Parse(strings.NewReader(`
+# labels of the game
+main 0x200
+draw = 0x21A ; sprite routine
+score: 0x300
+:const lives 0x302
+0x240 loop
+`))
+	if err != nil {
+		t.Fatalf(`Parse() returned an error %v`, err)
+	}
+	if table.Len() != 5 {
+		t.Fatalf(`table.Len() = %d, expected 5`, table.Len())
+	}
+
+	formats := map[uint16]string{
+		0x1FE: "0x1FE",
+		0x200: "main",
+		0x21E: "draw+4",
+		0x242: "loop+2",
+		0x303: "lives+1",
+	}
+	for addr, want := range formats {
+		if got := table.Format(addr); got != want {
+			t.Fatalf(`table.Format(%X) = %s, expected %s`, addr, got, want)
+		}
+	}
+
+	addrs, err := table.ResolveList("draw+4, 0x250,score")
+	if err != nil {
+		t.Fatalf(`ResolveList() returned an error %v`, err)
+	}
+	if len(addrs) != 3 || addrs[0] != 0x21E || addrs[1] != 0x250 || addrs[2] != 0x300 {
+		t.Fatalf(`ResolveList() = %X, expected [21E 250 300]`, addrs)
+	}
+	if _, err := table.Resolve("nowhere"); err == nil {
+		t.Fatalf(`Resolve() of an unknown label did not return an error`)
+	}
+}
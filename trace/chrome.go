@@ -0,0 +1,190 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/symbols"
+)
+
+// Frames per second of the emulated time
+const framesPerSecond = 60
+
+// Threads of the trace
+const (
+	framesThread = 1
+	cpuThread    = 2
+)
+
+// chromeEvent is an event of the Chrome trace-event format
+type chromeEvent struct {
+	Name string `json:"name"`
+	Cat  string `json:"cat,omitempty"`
+	Ph   string `json:"ph"`
+	// Microseconds of emulated time
+	Ts   float64        `json:"ts"`
+	Dur  float64        `json:"dur,omitempty"`
+	Pid  int            `json:"pid"`
+	Tid  int            `json:"tid"`
+	S    string         `json:"s,omitempty"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+// ChromeTracer writes a timeline in the Chrome trace-event JSON format, which
+// Perfetto and chrome://tracing open. Frames and subroutine calls are spans,
+// key waits, sound timer changes and sprite draws are instant events.
+//
+// The time is the emulated one: every frame lasts 1/60 of a second. The
+// events are written as they happen, so a trace that was not closed can
+// still be opened.
+type ChromeTracer struct {
+	out *bufio.Writer
+	cpu *xip8.Cpu
+	// Labels used to name the subroutines
+	Symbols *symbols.Table
+
+	// Cycles that have run, including the ones waiting for a key
+	ticks      uint
+	frame      uint
+	frameStart uint
+	// Stack pointer when the tracer was attached and current open calls
+	baseSp byte
+	calls  int
+
+	started bool
+	err     error
+}
+
+func NewChromeTracer(out io.Writer, table *symbols.Table) *ChromeTracer {
+	return &ChromeTracer{
+		out:     bufio.NewWriter(out),
+		Symbols: table,
+	}
+}
+
+// Attach registers the hooks of the tracer in the CPU
+func (t *ChromeTracer) Attach(cpu *xip8.Cpu) {
+	t.cpu = cpu
+	t.frame = cpu.Frames()
+	t.baseSp = cpu.Sp
+
+	t.write(chromeEvent{Name: "process_name", Ph: "M", Pid: 1, Args: map[string]any{"name": "xip8"}})
+	t.write(chromeEvent{Name: "thread_name", Ph: "M", Pid: 1, Tid: framesThread, Args: map[string]any{"name": "frames"}})
+	t.write(chromeEvent{Name: "thread_name", Ph: "M", Pid: 1, Tid: cpuThread, Args: map[string]any{"name": "cpu"}})
+
+	cpu.AddBeforeCycleHook(t.beforeCycle)
+	cpu.AddAfterCycleHook(t.afterCycle)
+	cpu.AddAfterFrameHook(t.afterFrame)
+}
+
+// ts returns the emulated time of a tick in microseconds
+func (t *ChromeTracer) ts(tick uint) float64 {
+	return float64(tick) * 1e6 / framesPerSecond / float64(max(t.cpu.CyclesPerFrame, 1))
+}
+
+func (t *ChromeTracer) write(e chromeEvent) {
+	if t.err != nil {
+		return
+	}
+
+	content, err := json.Marshal(e)
+	if err != nil {
+		t.err = err
+		return
+	}
+
+	sep := ",\n"
+	if !t.started {
+		sep = "[\n"
+		t.started = true
+	}
+	t.out.WriteString(sep)
+	_, t.err = t.out.Write(content)
+}
+
+func (t *ChromeTracer) instant(name string, args map[string]any) {
+	t.write(chromeEvent{Name: name, Cat: "cpu", Ph: "i", Ts: t.ts(t.ticks), Pid: 1, Tid: cpuThread, S: "t", Args: args})
+}
+
+func (t *ChromeTracer) beforeCycle(cpu *xip8.Cpu) {
+	if int(cpu.Pc)+1 >= xip8.MEMORY_SIZE {
+		return
+	}
+	opCode := uint16(cpu.Memory[cpu.Pc])<<8 | uint16(cpu.Memory[cpu.Pc+1])
+	x := (opCode & 0x0F00) >> 8
+	y := (opCode & 0x00F0) >> 4
+
+	switch {
+	case opCode&0xF0FF == 0xF00A:
+		t.instant("wait for key", map[string]any{"register": fmt.Sprintf("V%X", x)})
+	case opCode&0xF0FF == 0xF018:
+		t.instant("sound", map[string]any{"timer": cpu.V[x]})
+	case opCode&0xF000 == 0xD000:
+		t.instant("draw", map[string]any{
+			"x":      cpu.V[x],
+			"y":      cpu.V[y],
+			"height": opCode & 0x000F,
+			"sprite": t.Symbols.Format(cpu.I),
+		})
+	}
+}
+
+func (t *ChromeTracer) afterCycle(cpu *xip8.Cpu) {
+	depth := int(cpu.Sp) - int(t.baseSp)
+	if depth > t.calls {
+		// CALL: the PC is the entry of the subroutine
+		t.write(chromeEvent{Name: t.Symbols.Format(cpu.Pc), Cat: "call", Ph: "B", Ts: t.ts(t.ticks), Pid: 1, Tid: cpuThread})
+		t.calls++
+	}
+	for ; depth < t.calls && t.calls > 0; t.calls-- {
+		// RET
+		t.write(chromeEvent{Ph: "E", Ts: t.ts(t.ticks + 1), Pid: 1, Tid: cpuThread})
+	}
+}
+
+func (t *ChromeTracer) afterFrame(cpu *xip8.Cpu) {
+	t.ticks++
+	if cpu.Frames() == t.frame {
+		return
+	}
+
+	t.endFrame()
+	t.frame = cpu.Frames()
+	t.out.Flush()
+}
+
+func (t *ChromeTracer) endFrame() {
+	start := t.ts(t.frameStart)
+	t.write(chromeEvent{
+		Name: fmt.Sprintf("frame %d", t.frame),
+		Cat:  "frame",
+		Ph:   "X",
+		Ts:   start,
+		Dur:  t.ts(t.ticks) - start,
+		Pid:  1,
+		Tid:  framesThread,
+	})
+	t.frameStart = t.ticks
+}
+
+// Close ends the open calls and the current frame and finishes the JSON array
+func (t *ChromeTracer) Close() error {
+	for ; t.calls > 0; t.calls-- {
+		t.write(chromeEvent{Ph: "E", Ts: t.ts(t.ticks), Pid: 1, Tid: cpuThread})
+	}
+	if t.ticks > t.frameStart {
+		t.endFrame()
+	}
+	if !t.started {
+		t.out.WriteString("[")
+	}
+	t.out.WriteString("\n]\n")
+
+	if t.err != nil {
+		return t.err
+	}
+	return t.out.Flush()
+}
@@ -0,0 +1,55 @@
+package trace_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/trace"
+)
+
+func TestChromeTracer(t *testing.T) {
+	cpu := xip8.NewCpu()
+	cpu.CyclesPerFrame = 4
+
+	program := []byte{
+		0x22, 0x04, // 0x200: CALL 0x204
+		0x12, 0x00, // 0x202: JP 0x200
+		0xD0, 0x01, // 0x204: DRW V0, V0, 1
+		0x00, 0xEE, // 0x206: RET
+	}
+	if err := cpu.LoadProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.Boot(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	tracer := trace.NewChromeTracer(out, nil)
+	tracer.Attach(cpu)
+
+	for range 8 {
+		if err := cpu.LoopOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []map[string]any
+	if err := json.Unmarshal(out.Bytes(), &events); err != nil {
+		t.Fatalf("the trace is not valid JSON: %v\n%s", err, out.String())
+	}
+
+	count := map[string]int{}
+	for _, e := range events {
+		count[e["ph"].(string)]++
+	}
+	// 2 frames, 2 calls and 2 draws
+	if count["X"] != 2 || count["B"] != 2 || count["E"] != 2 || count["i"] != 2 {
+		t.Fatalf("unexpected events %v:\n%s", count, out.String())
+	}
+}
@@ -0,0 +1,55 @@
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/analysis"
+	"github.com/guslan/xip8/symbols"
+)
+
+// Logger writes a line for every instruction executed by the CPU
+type Logger struct {
+	out *bufio.Writer
+	// Labels used to format the addresses
+	Symbols *symbols.Table
+}
+
+func NewLogger(out io.Writer, table *symbols.Table) *Logger {
+	return &Logger{
+		out:     bufio.NewWriter(out),
+		Symbols: table,
+	}
+}
+
+// Attach registers the hooks of the logger in the CPU
+func (l *Logger) Attach(cpu *xip8.Cpu) {
+	cpu.AddBeforeCycleHook(l.beforeCycle)
+	cpu.AddAfterFrameHook(l.afterFrame)
+}
+
+// Flush writes the buffered lines
+func (l *Logger) Flush() error {
+	return l.out.Flush()
+}
+
+func (l *Logger) beforeCycle(cpu *xip8.Cpu) {
+	ins := analysis.Decode(cpu.Memory[:], cpu.Pc)
+
+	fmt.Fprintf(l.out, "%8d %-20s %04X  %-28s I=%03X V=%X\n",
+		cpu.Cycles(),
+		l.Symbols.Format(cpu.Pc),
+		ins.OpCode,
+		ins.Format(l.Symbols),
+		cpu.I,
+		cpu.V,
+	)
+}
+
+func (l *Logger) afterFrame(cpu *xip8.Cpu) {
+	if cpu.Cycles()%cpu.CyclesPerFrame == 0 {
+		l.out.Flush()
+	}
+}
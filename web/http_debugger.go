@@ -7,6 +7,7 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/symbols"
 )
 
 type HttpDebugger struct {
@@ -15,7 +16,11 @@ type HttpDebugger struct {
 	Cycle         int
 
 	SendEvery int
-	send      chan xip8.Cpu
+	// Latest state not sent yet, the hooks never wait for a websocket client
+	send chan xip8.Cpu
+
+	// Labels used to show the addresses as label+offset
+	Symbols *symbols.Table
 }
 
 // NewHttpDebugger creates a new debugger
@@ -26,11 +31,9 @@ func NewHttpDebugger(cpu *xip8.Cpu) *HttpDebugger {
 		CurrentOpCode: 0,
 		Cycle:         0,
 		SendEvery:     1,
-		send:          make(chan xip8.Cpu),
+		send:          make(chan xip8.Cpu, 1),
 	}
 
-	deb.setupWs()
-
 	cpu.AddBeforeFrameHook(deb.beforeFrame)
 	cpu.AddBeforeCycleHook(deb.beforeCycle)
 	cpu.AddAfterCycleHook(deb.afterCycle)
@@ -44,38 +47,59 @@ func NewHttpDebugger(cpu *xip8.Cpu) *HttpDebugger {
 
 var upgrader = websocket.Upgrader{} // use default options
 
-func (d *HttpDebugger) setupWs() {
-	http.HandleFunc("/debugger", func(w http.ResponseWriter, r *http.Request) {
-		slog.Info("Connecting  to debugger")
-		conn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			log.Print("upgrade:", err)
+// serveWs sends the states of the CPU to a websocket client
+func (d *HttpDebugger) serveWs(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Connecting  to debugger")
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Print("upgrade:", err)
+		return
+	}
+	defer conn.Close()
+
+	d.Cpu.Exec(func() { d.publish(*d.Cpu) })
+
+	slog.Info("Listening for events")
+	for {
+		select {
+		case cpu := <-d.send:
+			err = conn.WriteMessage(websocket.BinaryMessage, d.formatAsEvent(cpu))
+			if err != nil {
+				slog.Error("Error writing debugger message")
+				return
+			}
+
+		case <-r.Context().Done():
 			return
 		}
-		defer conn.Close()
-
-		go func(cpu xip8.Cpu) {
-			d.send <- cpu
-		}(*d.Cpu)
-
-		slog.Info("Listening for events")
-		for {
-			running := true
-			for running {
-				select {
-				case cpu := <-d.send:
-					err = conn.WriteMessage(websocket.BinaryMessage, d.formatAsEvent(cpu))
-					if err != nil {
-						slog.Error("Error writing debugger message")
-						running = false
-					}
-
-				case <-r.Context().Done():
-					running = false
-				}
-			}
+	}
+}
+
+// publish queues the state for the client, replacing the one it did not read yet
+func (d *HttpDebugger) publish(cpu xip8.Cpu) {
+	for {
+		select {
+		case d.send <- cpu:
+			return
+		default:
 		}
-	})
+
+		select {
+		case <-d.send:
+		default:
+		}
+	}
+}
+
+// Refresh sends the state of the CPU after it changed outside of a cycle,
+// e.g. after stepping back
+func (d *HttpDebugger) Refresh() {
+	if int(d.Cpu.Pc)+1 < xip8.MEMORY_SIZE {
+		d.CurrentOpCode = uint16(d.Cpu.Memory[d.Cpu.Pc+0]) << 8
+		d.CurrentOpCode |= uint16(d.Cpu.Memory[d.Cpu.Pc+1]) << 0
+	}
+
+	d.publish(*d.Cpu)
 }
 
 func (d *HttpDebugger) beforeFrame(cpu *xip8.Cpu) {
@@ -88,7 +112,7 @@ func (d *HttpDebugger) beforeCycle(cpu *xip8.Cpu) {
 
 func (d *HttpDebugger) afterCycle(cpu *xip8.Cpu) {
 	if d.Cpu.Cycles()%uint(d.SendEvery) == 0 {
-		d.send <- *cpu
+		d.publish(*cpu)
 	}
 
 	// slog.Info("Cycle ran")
@@ -122,5 +146,14 @@ func (d HttpDebugger) formatAsEvent(cpu xip8.Cpu) []byte {
 	buf = append(buf, byte(cpu.ScreenSettings.Width))
 	buf = append(buf, byte(cpu.ScreenSettings.Height))
 
+	// Length-prefixed label of the PC, empty without symbols
+	label := ""
+	if d.Symbols.Len() > 0 {
+		label = d.Symbols.Format(cpu.Pc)
+	}
+	label = label[:min(len(label), 0xFF)]
+	buf = append(buf, byte(len(label)))
+	buf = append(buf, label...)
+
 	return buf
 }
@@ -1,24 +1,47 @@
 package web
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"sync"
 
 	"github.com/gorilla/websocket"
 	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/cheats"
+	"github.com/guslan/xip8/crash"
+	"github.com/guslan/xip8/heatmap"
+	"github.com/guslan/xip8/search"
+	"github.com/guslan/xip8/symbols"
 )
 
 var signal = struct{}{}
 
+// Number of candidates returned by /search
+const maxSearchCandidates = 256
+
 type Server struct {
 	*xip8.InMemoryKeyboard
 	*xip8.DummyBuzzer
 
 	cpu      *xip8.Cpu
 	debugger *HttpDebugger
+	// Memory accesses shown by the debugger
+	heatmap *heatmap.Heatmap
+	// Memory search of the debugger
+	search *search.Search
+
+	// SHA-1 of the loaded program
+	romHash  string
+	crashDir string
+	recorder *crash.Recorder
+
+	// Cheats of the loaded program
+	cheats     *cheats.Engine
+	cheatsPath string
 
 	socket  *websocket.Conn
 	wsMutex sync.RWMutex
@@ -30,6 +53,16 @@ type Server struct {
 type ServerConfig struct {
 	ScreenSettings xip8.ScreenSettings
 	UseDebugger    bool
+	// Labels shown by the debugger
+	Symbols *symbols.Table
+	// Number of cycles the debugger can step back
+	HistorySize int
+	// Directory where a crash dump is written when the program fails.
+	// Defaults to "" (no dumps)
+	CrashDir string
+	// Cheat file loaded with the cheats of the program found by its hash.
+	// Defaults to "" (only the cheats of the hash)
+	CheatsPath string
 }
 type ServerConfigCb func(config *ServerConfig)
 
@@ -37,6 +70,10 @@ func NewServer(mem *xip8.Memory, configs ...ServerConfigCb) *Server {
 	config := &ServerConfig{
 		ScreenSettings: xip8.SmallScreen,
 		UseDebugger:    false,
+		Symbols:        nil,
+		HistorySize:    xip8.DefaultHistorySize,
+		CrashDir:       "",
+		CheatsPath:     "",
 	}
 	for _, cb := range configs {
 		cb(config)
@@ -52,16 +89,33 @@ func NewServer(mem *xip8.Memory, configs ...ServerConfigCb) *Server {
 
 		renderCh: make(chan struct{}),
 		keyCh:    make(chan xip8.KeyboardState),
+
+		cheats:     cheats.NewEngine(),
+		cheatsPath: config.CheatsPath,
 	}
 
+	useDebugger, historySize := config.UseDebugger, config.HistorySize
 	s.cpu = xip8.NewCpu(func(config *xip8.CpuConfig) {
 		config.Memory = mem
 		config.Display = s
 		config.Keyboard = s
 		config.Buzzer = s
+		if useDebugger {
+			config.HistorySize = historySize
+		}
 	})
+	s.cheats.Attach(s.cpu)
+	if len(config.CrashDir) > 0 {
+		s.crashDir = config.CrashDir
+		s.recorder = crash.NewRecorder(crash.DefaultInstructions)
+		s.recorder.Attach(s.cpu)
+	}
 	if config.UseDebugger {
 		s.debugger = NewHttpDebugger(s.cpu)
+		s.debugger.Symbols = config.Symbols
+		s.heatmap = heatmap.New(heatmap.DefaultWindow)
+		s.heatmap.Attach(s.cpu)
+		s.search = search.New()
 	}
 
 	return s
@@ -77,6 +131,11 @@ func NewServer(mem *xip8.Memory, configs ...ServerConfigCb) *Server {
 // 	})...)
 // }
 
+// Cpu returns the underlying console
+func (server *Server) Cpu() *xip8.Cpu {
+	return server.cpu
+}
+
 func (server *Server) Speed(s int) {
 	server.cpu.SetSpeedInHz(uint(s))
 }
@@ -91,15 +150,26 @@ func (server *Server) Listen(port int) error {
 		server.cpu.Stop()
 		server.cpu.CyclesPerFrame = 1
 		if err := server.cpu.Loop(); err != nil {
+			server.writeCrashDump(err)
 			log.Fatalln(err)
 		}
 	}()
 
 	slog.Info("Listening on port", slog.Int("port", port))
 
-	http.Handle("/", http.FileServer(http.Dir("./static")))
+	return http.ListenAndServe(fmt.Sprintf(":%d", port), server.Handler())
+}
+
+// Handler returns the handler of the static files, the controls and the debugger
+func (server *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
 
-	http.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/", http.FileServer(http.Dir("./static")))
+	if server.debugger != nil {
+		mux.HandleFunc("/debugger", server.debugger.serveWs)
+	}
+
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Expose-Headers", "Content-Type")
 
@@ -108,7 +178,7 @@ func (server *Server) Listen(port int) error {
 		slog.Info("Starting")
 		server.cpu.Start()
 	})
-	http.HandleFunc("/stop", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/stop", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Expose-Headers", "Content-Type")
 
@@ -117,17 +187,29 @@ func (server *Server) Listen(port int) error {
 		slog.Info("Stopping")
 		server.cpu.Stop()
 	})
-	http.HandleFunc("/reset", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/reset", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Expose-Headers", "Content-Type")
 
 		w.Header().Set("Cache-Control", "no-cache")
 
-		slog.Info("Stopping and resetting")
-		server.cpu.Stop()
-		server.cpu.Reset()
+		// A soft reset keeps the memory as the program left it
+		var err error
+		server.cpu.Exec(func() {
+			server.cpu.Stop()
+			if r.URL.Query().Has("soft") {
+				slog.Info("Stopping and resetting the registers")
+				server.cpu.SoftReset()
+			} else {
+				slog.Info("Stopping and reloading the rom")
+				err = server.cpu.HardReset()
+			}
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+		}
 	})
-	http.HandleFunc("/step", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/step", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Expose-Headers", "Content-Type")
 
@@ -136,7 +218,147 @@ func (server *Server) Listen(port int) error {
 		slog.Info("Single Frame")
 		server.cpu.LoopOnce()
 	})
-	http.HandleFunc("/display", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/reverse-step", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Type")
+
+		w.Header().Set("Cache-Control", "no-cache")
+
+		slog.Info("Reverse step")
+		// The history is rewound between two cycles of the loop
+		var err error
+		server.cpu.Exec(func() {
+			server.cpu.Stop()
+			err = server.cpu.ReverseStep()
+			server.refreshDebugger()
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+		}
+	})
+	mux.HandleFunc("/reverse-continue", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Type")
+
+		w.Header().Set("Cache-Control", "no-cache")
+
+		slog.Info("Reverse continue")
+		var err error
+		server.cpu.Exec(func() {
+			server.cpu.Stop()
+			err = server.cpu.ReverseContinue()
+			server.refreshDebugger()
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+		}
+	})
+	mux.HandleFunc("/breakpoint", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Type")
+
+		w.Header().Set("Cache-Control", "no-cache")
+
+		var table *symbols.Table
+		if server.debugger != nil {
+			table = server.debugger.Symbols
+		}
+		addr, err := table.Resolve(r.URL.Query().Get("at"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if r.URL.Query().Has("delete") {
+			slog.Info("Deleting breakpoint", slog.String("at", table.Format(addr)))
+			server.cpu.ClearBreakpoint(addr)
+		} else {
+			slog.Info("Setting breakpoint", slog.String("at", table.Format(addr)))
+			server.cpu.SetBreakpoint(addr)
+		}
+	})
+	mux.HandleFunc("/heatmap.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Type")
+
+		w.Header().Set("Cache-Control", "no-cache")
+
+		if server.heatmap == nil {
+			http.Error(w, "the debugger is disabled", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		if err := server.heatmap.WritePNG(w); err != nil {
+			slog.Error("Error writing the heatmap", slog.Any("error", err))
+		}
+	})
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Type")
+
+		w.Header().Set("Cache-Control", "no-cache")
+
+		if server.search == nil {
+			http.Error(w, "the debugger is disabled", http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Has("filter") && r.Method != http.MethodPost {
+			http.Error(w, "the search is filtered with POST", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := server.searchMemory(r.URL.Query().Get("filter"), r.URL.Query().Get("value")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		result := struct {
+			Count      int                `json:"count"`
+			Candidates []search.Candidate `json:"candidates"`
+		}{server.search.Count(), server.search.Candidates(maxSearchCandidates)}
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			slog.Error("Error writing the search", slog.Any("error", err))
+		}
+	})
+	mux.HandleFunc("/cheats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Type")
+
+		w.Header().Set("Cache-Control", "no-cache")
+
+		if r.URL.Query().Has("toggle") && r.Method != http.MethodPost {
+			http.Error(w, "the cheats are toggled with POST", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Query().Has("toggle") {
+			i, err := strconv.Atoi(r.URL.Query().Get("toggle"))
+			if err != nil || !server.cheats.Toggle(i) {
+				http.Error(w, fmt.Sprintf("unknown cheat %q", r.URL.Query().Get("toggle")), http.StatusBadRequest)
+				return
+			}
+			slog.Info("Toggling cheat", slog.String("name", server.cheats.Cheats()[i].Name), slog.Bool("enabled", server.cheats.Cheats()[i].Enabled))
+		}
+
+		type jsonCheat struct {
+			Name    string   `json:"name"`
+			Codes   []string `json:"codes"`
+			Enabled bool     `json:"enabled"`
+		}
+		list := []jsonCheat{}
+		for _, c := range server.cheats.Cheats() {
+			codes := make([]string, len(c.Codes))
+			for i, code := range c.Codes {
+				codes[i] = code.String()
+			}
+			list = append(list, jsonCheat{Name: c.Name, Codes: codes, Enabled: c.Enabled})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(list); err != nil {
+			slog.Error("Error writing the cheats", slog.Any("error", err))
+		}
+	})
+	mux.HandleFunc("/display", func(w http.ResponseWriter, r *http.Request) {
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			log.Print("upgrade:", err)
@@ -159,10 +381,91 @@ func (server *Server) Listen(port int) error {
 		}
 	})
 
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+	return mux
+}
+
+// refreshDebugger sends the state to the debugger after it changed outside of a cycle.
+// It must run between two cycles, see xip8.Cpu.Exec.
+func (server *Server) refreshDebugger() {
+	if server.debugger != nil {
+		server.debugger.Refresh()
+	}
+}
+
+// searchMemory starts the search or filters its candidates. Without a filter
+// the candidates are left as they are. The snapshots are taken between two cycles.
+func (server *Server) searchMemory(filter, value string) error {
+	switch filter {
+	case "":
+		return nil
+	case "start":
+		slog.Info("Starting a memory search")
+		server.cpu.Exec(func() { server.search.Start(server.cpu.Memory) })
+		return nil
+	}
+
+	f, err := search.ParseFilter(filter)
+	if err != nil {
+		return err
+	}
+	var v uint16
+	if f == search.Value {
+		if v, err = symbols.ParseAddress(value); err != nil || v > 0xFF {
+			return fmt.Errorf("invalid value %q", value)
+		}
+	}
+
+	var n int
+	server.cpu.Exec(func() { n, err = server.search.Filter(server.cpu.Memory, f, byte(v)) })
+	if err == nil {
+		slog.Info("Filtering the memory search", slog.String("filter", f.String()), slog.Int("candidates", n))
+	}
+	return err
 }
 
-// LoadProgram loads the program into memory and sets the PC to the start-of-program address
+// LoadProgram loads the program into memory and sets the PC to the
+// start-of-program address. Its cheats are applied before the first cycle.
 func (server *Server) LoadProgram(program []byte) error {
-	return server.cpu.LoadProgram(program)
+	return server.LoadCartridge(xip8.NewCartridge("", program))
+}
+
+// LoadCartridge loads the rom of the cartridge like LoadProgram. The rom is
+// kept to load it again when the console is reset.
+func (server *Server) LoadCartridge(c *xip8.Cartridge) error {
+	server.romHash = c.Hash
+
+	list, err := cheats.Open(server.romHash, server.cheatsPath)
+	if err != nil {
+		return err
+	}
+	if err := server.cpu.LoadCartridge(c); err != nil {
+		return err
+	}
+
+	server.cheats.Load(list)
+	if len(list) > 0 {
+		slog.Info("Cheats loaded", slog.Int("count", len(list)))
+	}
+	return nil
+}
+
+// writeCrashDump saves the state of the console after err stopped it
+func (server *Server) writeCrashDump(err error) {
+	if server.recorder == nil {
+		return
+	}
+
+	var table *symbols.Table
+	if server.debugger != nil {
+		table = server.debugger.Symbols
+	}
+
+	dump := crash.New(server.cpu, err, server.recorder)
+	dump.RomHash = server.romHash
+	path, err := dump.WriteFile(server.crashDir, table)
+	if err != nil {
+		slog.Error("Error writing the crash dump", slog.Any("error", err))
+		return
+	}
+	slog.Info("Crash dump written", slog.String("path", path))
 }
@@ -0,0 +1,101 @@
+package web_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/guslan/xip8"
+	"github.com/guslan/xip8/web"
+)
+
+// TestServerWithoutDebuggerClient calls the endpoints that run between two
+// cycles while the program runs and no websocket client reads the debugger
+func TestServerWithoutDebuggerClient(t *testing.T) {
+	server := web.NewServer(xip8.NewMemory(), func(config *web.ServerConfig) {
+		config.UseDebugger = true
+	})
+	program := []byte{
+		0x70, 0x01, // 0x200: ADD V0, 0x01
+		0x12, 0x00, // 0x202: JP 0x200
+	}
+	if err := server.LoadProgram(program); err != nil {
+		t.Fatal(err)
+	}
+	cpu := server.Cpu()
+	if err := cpu.Boot(); err != nil {
+		t.Fatal(err)
+	}
+	go cpu.Loop()
+
+	handler := server.Handler()
+
+	requests := []struct {
+		method, path string
+	}{
+		{http.MethodGet, "/reverse-step"},
+		{http.MethodGet, "/reverse-continue"},
+		{http.MethodPost, "/search?filter=start"},
+		{http.MethodGet, "/reset"},
+	}
+	for _, r := range requests {
+		// Let the loop run a few cycles and fill the debugger channel
+		cpu.Exec(cpu.Start)
+		time.Sleep(10 * time.Millisecond)
+
+		// Rewinding may fail at the start of the history, hanging fails with a timeout
+		done := make(chan struct{})
+		go func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(r.method, r.path, nil))
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatalf(`%s %s did not return`, r.method, r.path)
+		}
+	}
+}
+
+// TestCheatsToggle only toggles the cheats with POST
+func TestCheatsToggle(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "cheats.cht")
+	if err := os.WriteFile(path, []byte("Infinite lives: freeze 0x300=03\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := web.NewServer(xip8.NewMemory(), func(config *web.ServerConfig) {
+		config.CheatsPath = path
+	})
+	if err := server.LoadProgram([]byte{0x12, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+	handler := server.Handler()
+
+	enabled := func(method string) (int, bool) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, "/cheats?toggle=0", nil))
+
+		list := []struct {
+			Enabled bool `json:"enabled"`
+		}{}
+		r := httptest.NewRecorder()
+		handler.ServeHTTP(r, httptest.NewRequest(http.MethodGet, "/cheats", nil))
+		if err := json.NewDecoder(r.Body).Decode(&list); err != nil || len(list) != 1 {
+			t.Fatalf(`/cheats returned %d cheats (%v), expected 1`, len(list), err)
+		}
+		return w.Code, list[0].Enabled
+	}
+
+	if code, on := enabled(http.MethodGet); code != http.StatusMethodNotAllowed || !on {
+		t.Fatalf(`GET /cheats?toggle=0 returned %d and the cheat is on: %v, expected 405 and the cheat left on`, code, on)
+	}
+	if code, on := enabled(http.MethodPost); code != http.StatusOK || on {
+		t.Fatalf(`POST /cheats?toggle=0 returned %d and the cheat is on: %v, expected 200 and the cheat turned off`, code, on)
+	}
+}